@@ -2,4 +2,7 @@ module github.com/MatthewTe/go_htmx_finance_app
 
 go 1.20
 
-require github.com/mattn/go-sqlite3 v1.14.17
+require (
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.17
+)
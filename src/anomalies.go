@@ -0,0 +1,407 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	anomalyKindDuplicate     = "duplicate"
+	anomalyKindPayeeAmount   = "payee_amount"
+	anomalyKindCategorySpike = "category_spike"
+
+	anomalyStatusOpen      = "open"
+	anomalyStatusDismissed = "dismissed"
+	anomalyStatusConfirmed = "confirmed"
+)
+
+const (
+	// A value is unusual when its modified z-score, based on the median absolute deviation, is above this:
+	anomalyScoreThreshold = 3.5
+
+	// and it is also at least this many times the median, so tight histories do not flag small changes:
+	anomalyMinRatio = 1.5
+
+	// Payees and categories need this much history before anything is compared against it:
+	anomalyMinHistory = 3
+
+	// Category spikes are compared against the monthly totals of up to this many earlier months:
+	anomalyCategoryMonths = 12
+
+	// Two charges this many days apart or closer with the same payee, amount and account may be a duplicate:
+	anomalyDuplicateDays = 1
+)
+
+// Anomaly is a transaction or a category month that looks unusual. Key identifies what was flagged so the same
+// anomaly is only ever recorded once, and a dismissed anomaly is not flagged again.
+type Anomaly struct {
+	UniqueId      int
+	Kind          string
+	Key           string
+	TransactionId string
+	Summary       string
+	DetectedAt    string
+	Status        string
+}
+
+// robustScore is the modified z-score of value against the history. A history without any spread is scaled by a
+// tenth of its median so a change is still measured against something.
+func robustScore(value float64, history []float64) (score float64, historyMedian float64) {
+	historyMedian = median(history)
+
+	deviations := []float64{}
+	for _, past := range history {
+		deviations = append(deviations, math.Abs(past-historyMedian))
+	}
+	scale := median(deviations) / 0.6745
+	if scale == 0 {
+		scale = math.Max(historyMedian*0.1, 0.01)
+	}
+
+	return (value - historyMedian) / scale, historyMedian
+}
+
+func isUnusual(value float64, history []float64) (bool, float64) {
+	if len(history) < anomalyMinHistory {
+		return false, 0.0
+	}
+	score, historyMedian := robustScore(value, history)
+	return score > anomalyScoreThreshold && value >= historyMedian*anomalyMinRatio, historyMedian
+}
+
+// DetectAnomalies looks for duplicate charges, charges far above a payee's usual amount and categories whose monthly
+// spending is far above usual, among the checked transactions. The rest of the transactions are the history they
+// are compared against.
+func DetectAnomalies(transactions []Transaction, checkedIds map[string]bool) []Anomaly {
+	anomalies := []Anomaly{}
+
+	byPayee := make(map[string][]Transaction)
+	for _, transaction := range transactions {
+		if transaction.IsTransfer {
+			continue
+		}
+		key := recurringKey(transaction)
+		if key == "" {
+			continue
+		}
+		byPayee[key] = append(byPayee[key], transaction)
+	}
+
+	for payee, payeeTransactions := range byPayee {
+		for _, transaction := range payeeTransactions {
+			if !checkedIds[transaction.UniqueId] || !transaction.IsDebit() {
+				continue
+			}
+
+			history := []float64{}
+			for _, other := range payeeTransactions {
+				if other.UniqueId == transaction.UniqueId || !other.IsDebit() {
+					continue
+				}
+				history = append(history, float64(other.Debit))
+
+				// The key is the same from either side of the pair so each pair is flagged once:
+				days := math.Abs(other.Date.Sub(transaction.Date).Hours() / 24)
+				if days <= anomalyDuplicateDays && other.Account == transaction.Account &&
+					toCents(float64(other.Debit)) == toCents(float64(transaction.Debit)) {
+					ids := []string{transaction.UniqueId, other.UniqueId}
+					sort.Strings(ids)
+					anomalies = append(anomalies, Anomaly{
+						Kind:          anomalyKindDuplicate,
+						Key:           strings.Join(ids, "|"),
+						TransactionId: transaction.UniqueId,
+						Summary: fmt.Sprintf("Possible duplicate charge: %s $%.2f on %s and %s", payee, transaction.Debit,
+							transaction.Date.Format("2006-01-02"), other.Date.Format("2006-01-02")),
+					})
+				}
+			}
+
+			unusual, usual := isUnusual(float64(transaction.Debit), history)
+			if unusual {
+				anomalies = append(anomalies, Anomaly{
+					Kind:          anomalyKindPayeeAmount,
+					Key:           transaction.UniqueId,
+					TransactionId: transaction.UniqueId,
+					Summary: fmt.Sprintf("%s charged $%.2f on %s, %.1f times its usual $%.2f", payee, transaction.Debit,
+						transaction.Date.Format("2006-01-02"), float64(transaction.Debit)/usual, usual),
+				})
+			}
+		}
+	}
+
+	anomalies = append(anomalies, detectCategorySpikes(transactions, checkedIds)...)
+
+	// Duplicates are found from both sides of the pair:
+	seen := make(map[string]bool)
+	unique := []Anomaly{}
+	for _, anomaly := range anomalies {
+		if seen[anomaly.Kind+anomaly.Key] {
+			continue
+		}
+		seen[anomaly.Kind+anomaly.Key] = true
+		unique = append(unique, anomaly)
+	}
+
+	return unique
+}
+
+// detectCategorySpikes compares the spending of each category in the months of the checked transactions with the
+// category's spending in the months before, counting months without any spending as zero.
+func detectCategorySpikes(transactions []Transaction, checkedIds map[string]bool) []Anomaly {
+	monthlySpend := make(map[string]map[time.Time]float64)
+	checkedMonths := make(map[string]map[time.Time]bool)
+	var firstMonth time.Time
+
+	for _, transaction := range transactions {
+		if transaction.IsTransfer {
+			continue
+		}
+		month := monthStart(transaction.Date)
+		if firstMonth.IsZero() || month.Before(firstMonth) {
+			firstMonth = month
+		}
+
+		for _, line := range transaction.CategoryLines() {
+			if monthlySpend[line.Category] == nil {
+				monthlySpend[line.Category] = make(map[time.Time]float64)
+				checkedMonths[line.Category] = make(map[time.Time]bool)
+			}
+			monthlySpend[line.Category][month] += line.Expenses
+			if checkedIds[transaction.UniqueId] && line.Expenses > 0 {
+				checkedMonths[line.Category][month] = true
+			}
+		}
+	}
+
+	anomalies := []Anomaly{}
+	for category, months := range checkedMonths {
+		for month := range months {
+			history := []float64{}
+			for previous := month.AddDate(0, -1, 0); !previous.Before(firstMonth) && len(history) < anomalyCategoryMonths; previous = previous.AddDate(0, -1, 0) {
+				history = append(history, monthlySpend[category][previous])
+			}
+
+			spent := monthlySpend[category][month]
+			unusual, usual := isUnusual(spent, history)
+			if !unusual {
+				continue
+			}
+			anomalies = append(anomalies, Anomaly{
+				Kind: anomalyKindCategorySpike,
+				Key:  category + "|" + month.Format("2006-01"),
+				Summary: fmt.Sprintf("%s spending of $%.2f in %s is well above its usual $%.2f a month", category, spent,
+					month.Format("January 2006"), usual),
+			})
+		}
+	}
+
+	return anomalies
+}
+
+func ReadAnomalies(db *sql.DB) (anomalies []Anomaly, err error) {
+	rows, err := db.Query(`SELECT unique_id, kind, key, COALESCE(transaction_id, ''), summary, detected_at, status
+		FROM anomalies ORDER BY detected_at DESC, unique_id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var anomaly Anomaly
+		err := rows.Scan(&anomaly.UniqueId, &anomaly.Kind, &anomaly.Key, &anomaly.TransactionId, &anomaly.Summary,
+			&anomaly.DetectedAt, &anomaly.Status)
+		if err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	return anomalies, rows.Err()
+}
+
+// RecordAnomalies stores the anomalies that have not been recorded before and returns how many were new.
+func RecordAnomalies(db *sql.DB, anomalies []Anomaly) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO anomalies(kind, key, transaction_id, summary, detected_at, status)
+		values(?, ?, NULLIF(?, ''), ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	numRecorded := 0
+	detectedAt := time.Now().Format("2006-01-02 15:04:05")
+	for _, anomaly := range anomalies {
+		result, err := stmt.Exec(anomaly.Kind, anomaly.Key, anomaly.TransactionId, anomaly.Summary, detectedAt, anomalyStatusOpen)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		numRecorded += int(inserted)
+	}
+
+	return numRecorded, tx.Commit()
+}
+
+// UpdateAnomalyStatus dismisses or confirms an anomaly, returning sql.ErrNoRows when it does not exist.
+func UpdateAnomalyStatus(db *sql.DB, anomalyId int, status string, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var oldStatus, summary string
+	err = tx.QueryRow("SELECT status, summary FROM anomalies WHERE unique_id = ?", anomalyId).Scan(&oldStatus, &summary)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE anomalies SET status = ? WHERE unique_id = ?", status, anomalyId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityAnomaly,
+		EntityId: strconv.Itoa(anomalyId),
+		Field:    "status",
+		OldValue: oldStatus,
+		NewValue: status + ": " + summary,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// detectAnomalies checks the given transactions against the full history and records anything unusual. No ids
+// checks every transaction.
+func (h *storeHandlers) detectAnomalies(transactionIds []string) (int, error) {
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		return 0, err
+	}
+
+	checkedIds := make(map[string]bool)
+	for _, transaction := range transactions {
+		checkedIds[transaction.UniqueId] = len(transactionIds) == 0
+	}
+	for _, transactionId := range transactionIds {
+		checkedIds[transactionId] = true
+	}
+
+	return h.anomalies.RecordAnomalies(DetectAnomalies(transactions, checkedIds))
+}
+
+type anomalyPanelContent struct {
+	Open                      []Anomaly
+	NumConfirmed, NumDetected int
+	Detected                  bool
+}
+
+func (h *storeHandlers) renderAnomalyPanel(w http.ResponseWriter, content anomalyPanelContent) {
+	anomalies, err := h.anomalies.ReadAnomalies()
+	if err != nil {
+		log.Println("Unable to query the anomalies:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, anomaly := range anomalies {
+		switch anomaly.Status {
+		case anomalyStatusOpen:
+			content.Open = append(content.Open, anomaly)
+		case anomalyStatusConfirmed:
+			content.NumConfirmed++
+		}
+	}
+
+	tmpl, err := template.ParseFiles("../templates/index.html")
+	if err != nil {
+		log.Fatal("Unable to load the index.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "anomalyPanel", content)
+	if err != nil {
+		log.Println("Unable to render the anomaly panel: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// anomaliesHandler renders the dashboard's anomaly panel. Anomalies can be dismissed when they are expected or
+// confirmed when they are a real problem, either way they leave the panel. A scan checks the whole history.
+func (h *storeHandlers) anomaliesHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.renderAnomalyPanel(w, anomalyPanelContent{})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := anomalyPanelContent{}
+	switch action := r.FormValue("action"); action {
+	case "scan":
+		numDetected, err := h.detectAnomalies(nil)
+		if err != nil {
+			log.Println("Unable to detect anomalies:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		content.Detected, content.NumDetected = true, numDetected
+
+	case "dismiss", "confirm":
+		anomalyId, err := strconv.Atoi(r.FormValue("anomaly_id"))
+		if err != nil {
+			http.Error(w, "Invalid anomaly_id", http.StatusBadRequest)
+			return
+		}
+
+		status := anomalyStatusDismissed
+		if action == "confirm" {
+			status = anomalyStatusConfirmed
+		}
+		err = h.anomalies.UpdateAnomalyStatus(anomalyId, status, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to update the anomaly:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	h.renderAnomalyPanel(w, content)
+}
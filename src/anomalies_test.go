@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRobustScore(t *testing.T) {
+	tests := []struct {
+		value   float64
+		history []float64
+		score   float64
+		median  float64
+	}{
+		{10, []float64{10, 10, 10}, 0, 10},
+		// A history without any spread is scaled by a tenth of its median:
+		{20, []float64{10, 10, 10}, 10, 10},
+		{20, []float64{10, 12, 14}, 2.698, 12},
+		{8, []float64{10, 12, 14}, -1.349, 12},
+		// or by a cent when the median is zero too:
+		{5, []float64{0, 0, 0}, 500, 0},
+		{5, []float64{}, 500, 0},
+	}
+
+	for _, test := range tests {
+		score, historyMedian := robustScore(test.value, test.history)
+		if math.Abs(score-test.score) > 0.001 || historyMedian != test.median {
+			t.Errorf("robustScore(%v, %v) = %.3f, %v, want %v, %v", test.value, test.history, score, historyMedian, test.score, test.median)
+		}
+	}
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	coffee := []Transaction{
+		testTransaction("coffee-1", "2023-05-01", "COFFEE HOUSE", 4, "Checking"),
+		testTransaction("coffee-2", "2023-05-03", "COFFEE HOUSE", 4, "Checking"),
+		testTransaction("coffee-3", "2023-05-05", "COFFEE HOUSE", 4.5, "Checking"),
+		testTransaction("coffee-4", "2023-05-07", "COFFEE HOUSE", 4, "Checking"),
+	}
+	withCoffee := func(date string, amount float32) []Transaction {
+		return append(append([]Transaction{}, coffee...), testTransaction("coffee-new", date, "COFFEE HOUSE", amount, "Checking"))
+	}
+
+	groceries := []Transaction{}
+	for i, date := range []string{"2023-01-10", "2023-02-10", "2023-03-10", "2023-04-10"} {
+		transaction := testTransaction(fmt.Sprintf("groceries-%d", i), date, "SUPERMARKET", 100, "Checking")
+		transaction.Category = "Groceries"
+		groceries = append(groceries, transaction)
+	}
+	withGroceries := func(amount float32) []Transaction {
+		transaction := testTransaction("bulk", "2023-05-10", "BULK STORE", amount, "Checking")
+		transaction.Category = "Groceries"
+		return append(append([]Transaction{}, groceries...), transaction)
+	}
+
+	transfer := testTransaction("transfer", "2023-05-09", "COFFEE HOUSE", 400, "Checking")
+	transfer.IsTransfer = true
+
+	tests := []struct {
+		name         string
+		transactions []Transaction
+		checked      []string
+		want         []string
+	}{
+		{
+			name:         "charge far above the payee's usual amount",
+			transactions: withCoffee("2023-05-09", 40),
+			checked:      []string{"coffee-new"},
+			want:         []string{"payee_amount coffee-new"},
+		},
+		{
+			name:         "only the checked transactions are flagged",
+			transactions: withCoffee("2023-05-09", 40),
+			checked:      []string{"coffee-1"},
+			want:         []string{},
+		},
+		{
+			// The score is well above the threshold but the charge is less than 1.5 times the usual amount:
+			name:         "small rise",
+			transactions: withCoffee("2023-05-09", 5.9),
+			checked:      []string{"coffee-new"},
+			want:         []string{},
+		},
+		{
+			name:         "too little history",
+			transactions: append(coffee[:2:2], testTransaction("coffee-new", "2023-05-09", "COFFEE HOUSE", 40, "Checking")),
+			checked:      []string{"coffee-new"},
+			want:         []string{},
+		},
+		{
+			name:         "transfers are not charges",
+			transactions: append(append([]Transaction{}, coffee...), transfer),
+			checked:      []string{"transfer"},
+			want:         []string{},
+		},
+		{
+			name:         "duplicate charge",
+			transactions: withCoffee("2023-05-08", 4),
+			checked:      []string{"coffee-new", "coffee-4"},
+			// Both charges are checked, the pair is still flagged once:
+			want: []string{"duplicate coffee-4|coffee-new"},
+		},
+		{
+			name: "same amount from another account",
+			transactions: append(append([]Transaction{}, coffee...),
+				testTransaction("coffee-new", "2023-05-07", "COFFEE HOUSE", 4, "Credit Card")),
+			checked: []string{"coffee-new"},
+			want:    []string{},
+		},
+		{
+			name:         "category spike",
+			transactions: withGroceries(400),
+			checked:      []string{"bulk"},
+			want:         []string{"category_spike Groceries|2023-05"},
+		},
+		{
+			name:         "category within its usual spending",
+			transactions: withGroceries(40),
+			checked:      []string{"bulk"},
+			want:         []string{},
+		},
+	}
+
+	for _, test := range tests {
+		checkedIds := make(map[string]bool)
+		for _, id := range test.checked {
+			checkedIds[id] = true
+		}
+
+		got := []string{}
+		for _, anomaly := range DetectAnomalies(test.transactions, checkedIds) {
+			got = append(got, anomaly.Kind+" "+anomaly.Key)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: DetectAnomalies flagged %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directory that all receipt and document attachments are written to. Each transaction gets its own sub-directory:
+const attachmentDir = "./attachments"
+
+type Attachment struct {
+	UniqueId      int
+	TransactionId string
+	FileName      string
+	ContentType   string
+	FilePath      string
+	FileSize      int64
+	DateUploaded  string
+}
+
+// IsImage is used by the templates to decide between rendering a thumbnail or a download link.
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
+
+// Only images and PDFs are accepted as attachments:
+func isAllowedAttachmentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") || contentType == "application/pdf"
+}
+
+// InsertAttachment records an attachment file already written to disk and adds it to the audit log of its transaction.
+func InsertAttachment(db *sql.DB, attachment Attachment, actor string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO attachments(
+		transaction_id,
+		filename,
+		content_type,
+		file_path,
+		file_size,
+		date_uploaded
+		) values(?, ?, ?, ?, ?, ?)`,
+		attachment.TransactionId,
+		attachment.FileName,
+		attachment.ContentType,
+		attachment.FilePath,
+		attachment.FileSize,
+		attachment.DateUploaded,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	attachmentId, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: attachment.TransactionId,
+		Field:    "attachment",
+		NewValue: attachment.FileName,
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return attachmentId, tx.Commit()
+}
+
+func scanAttachments(rows *sql.Rows) (attachments []Attachment, err error) {
+	defer rows.Close()
+
+	attachments = []Attachment{}
+	for rows.Next() {
+		var attachment Attachment
+		err := rows.Scan(
+			&attachment.UniqueId,
+			&attachment.TransactionId,
+			&attachment.FileName,
+			&attachment.ContentType,
+			&attachment.FilePath,
+			&attachment.FileSize,
+			&attachment.DateUploaded,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+func ReadTransactionAttachments(db *sql.DB, transactionId string) (attachments []Attachment, err error) {
+	rows, err := db.Query(`SELECT unique_id, transaction_id, filename, content_type, file_path, file_size, date_uploaded
+		FROM attachments WHERE transaction_id = ? ORDER BY unique_id`, transactionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+func ReadAttachment(db *sql.DB, attachmentId int) (attachment Attachment, err error) {
+	row := db.QueryRow(`SELECT unique_id, transaction_id, filename, content_type, file_path, file_size, date_uploaded
+		FROM attachments WHERE unique_id = ?`, attachmentId)
+
+	err = row.Scan(
+		&attachment.UniqueId,
+		&attachment.TransactionId,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.FilePath,
+		&attachment.FileSize,
+		&attachment.DateUploaded,
+	)
+
+	return attachment, err
+}
+
+func DeleteAttachment(db *sql.DB, attachment Attachment, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM attachments WHERE unique_id = ?", attachment.UniqueId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: attachment.TransactionId,
+		Field:    "attachment",
+		OldValue: attachment.FileName,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return removeAttachmentFile(attachment)
+}
+
+// removeAttachmentFile is called by every store once the attachment record is gone, so that a failure to remove the
+// file only ever leaves an orphaned file, never a dangling record.
+func removeAttachmentFile(attachment Attachment) error {
+	err := os.Remove(attachment.FilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+type transactionAttachmentsContent struct {
+	TransactionId string
+	Attachments   []Attachment
+}
+
+func (h *storeHandlers) renderAttachmentList(w http.ResponseWriter, transactionId string) {
+	attachments, err := h.attachments.ReadTransactionAttachments(transactionId)
+	if err != nil {
+		log.Println("Unable to query the attachments for a transaction:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("../templates/snippits/transactionInformationComponents.html")
+	if err != nil {
+		log.Fatal("Error in loading the template snippit: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "attachmentList", transactionAttachmentsContent{
+		TransactionId: transactionId,
+		Attachments:   attachments,
+	})
+	if err != nil {
+		log.Println("Unable to render the attachment list snippit: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *storeHandlers) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	transactionId := r.FormValue("transaction_id")
+	if transactionId == "" {
+		http.Error(w, "No transaction_id provided", http.StatusBadRequest)
+		return
+	}
+
+	// The transaction id is used as a directory name so it is only trusted once it matches an existing transaction:
+	_, err := h.transactions.ReadTransaction(transactionId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Unable to look up the transaction for an attachment:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	file, header, err := r.FormFile("attachmentFile")
+	if err != nil {
+		log.Println("Error in uploading the attachment file:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Sniffing the content type from the file itself rather than trusting the browser supplied header:
+	sniffBuffer := make([]byte, 512)
+	n, err := io.ReadFull(file, sniffBuffer)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		log.Println("Unable to read the uploaded attachment:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	contentType := http.DetectContentType(sniffBuffer[:n])
+	if !isAllowedAttachmentType(contentType) {
+		tmpl, err := template.ParseFiles("../templates/snippits/uploadedCsvTable.html")
+		if err != nil {
+			log.Fatal("Error in loading the template snippit: ", err)
+		}
+		tmpl.ExecuteTemplate(w, "ErrorComponent", ErrorMessage{
+			Error: "Attachments must be an image or a PDF.",
+		})
+		h.renderAttachmentList(w, transactionId)
+		return
+	}
+
+	transactionAttachmentDir := filepath.Join(attachmentDir, transactionId)
+	err = os.MkdirAll(transactionAttachmentDir, 0755)
+	if err != nil {
+		log.Println("Unable to create the attachment directory:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Prefixing the stored file with a timestamp so re-uploading the same receipt never overwrites the original:
+	storedFileName := fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(header.Filename))
+	storedFilePath := filepath.Join(transactionAttachmentDir, storedFileName)
+
+	storedFile, err := os.Create(storedFilePath)
+	if err != nil {
+		log.Println("Unable to create the attachment file on disk:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer storedFile.Close()
+
+	fileSize, err := io.Copy(storedFile, io.MultiReader(bytes.NewReader(sniffBuffer[:n]), file))
+	if err != nil {
+		log.Println("Unable to write the attachment file to disk:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.attachments.InsertAttachment(Attachment{
+		TransactionId: transactionId,
+		FileName:      filepath.Base(header.Filename),
+		ContentType:   contentType,
+		FilePath:      storedFilePath,
+		FileSize:      fileSize,
+		DateUploaded:  time.Now().Format("2006-01-02 15:04:05"),
+	}, actorFromRequest(r))
+	if err != nil {
+		os.Remove(storedFilePath)
+		log.Println("Unable to insert the attachment record:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderAttachmentList(w, transactionId)
+}
+
+func (h *storeHandlers) attachmentHandler(w http.ResponseWriter, r *http.Request) {
+
+	attachmentId, err := strconv.Atoi(r.URL.Query().Get("attachment_id"))
+	if err != nil {
+		http.Error(w, "Invalid attachment_id", http.StatusBadRequest)
+		return
+	}
+
+	attachment, err := h.attachments.ReadAttachment(attachmentId)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("Unable to query the attachment:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", attachment.ContentType)
+		if r.URL.Query().Get("download") != "" {
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.FileName))
+		}
+		http.ServeFile(w, r, attachment.FilePath)
+
+	case http.MethodDelete:
+		err = h.attachments.DeleteAttachment(attachment, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to delete the attachment:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.renderAttachmentList(w, attachment.TransactionId)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	auditEntityTransaction = "transaction"
+	auditEntityUpload      = "upload"
+	auditEntityTransfer    = "transfer"
+	auditEntityPayee       = "payee"
+	auditEntityBalance     = "balance"
+	auditEntityBudget      = "budget"
+	auditEntityScheduled   = "scheduled"
+	auditEntityAnomaly     = "anomaly"
+	auditEntityNetWorth    = "net_worth"
+	auditEntityGoal        = "goal"
+)
+
+// Cookie used to remember which household member is making changes when the app is not behind an authenticating proxy:
+const actorCookieName = "finance_actor"
+
+// The user headers of an authenticating reverse proxy are only trusted when FINANCE_TRUSTED_PROXY is set, otherwise
+// any browser could claim to be anyone by sending them:
+func trustedProxy() bool {
+	trusted, err := strconv.ParseBool(os.Getenv("FINANCE_TRUSTED_PROXY"))
+	return err == nil && trusted
+}
+
+// AuditEntry is a single field level change to financial data. Whole record creates and deletes are recorded with
+// a field of "*".
+type AuditEntry struct {
+	UniqueId  int
+	Entity    string
+	EntityId  string
+	Field     string
+	OldValue  string
+	NewValue  string
+	Actor     string
+	Timestamp string
+}
+
+type AuditFilter struct {
+	Entity   string
+	EntityId string
+	Actor    string
+	Field    string
+	From     string
+	To       string
+	Limit    int
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// actorFromRequest identifies who made a change. A user name set by a trusted authenticating reverse proxy is
+// preferred, then the name picked on the audit page, then "anonymous".
+func actorFromRequest(r *http.Request) string {
+	if trustedProxy() {
+		for _, header := range []string{"X-Forwarded-User", "Remote-User"} {
+			if user := strings.TrimSpace(r.Header.Get(header)); user != "" {
+				return user
+			}
+		}
+	}
+
+	cookie, err := r.Cookie(actorCookieName)
+	if err == nil && strings.TrimSpace(cookie.Value) != "" {
+		return strings.TrimSpace(cookie.Value)
+	}
+
+	return "anonymous"
+}
+
+// RecordAudit appends entries to the audit log. Every entry in a single call shares the same actor and timestamp.
+func RecordAudit(db execer, actor string, entries ...AuditEntry) error {
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+
+	for _, entry := range entries {
+		_, err := db.Exec(`INSERT INTO audit_log(
+			entity,
+			entity_id,
+			field,
+			old_value,
+			new_value,
+			actor,
+			timestamp
+			) values(?, ?, ?, ?, ?, ?, ?)`,
+			entry.Entity,
+			entry.EntityId,
+			entry.Field,
+			entry.OldValue,
+			entry.NewValue,
+			actor,
+			timestamp,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func describeTransaction(transaction Transaction) string {
+	return fmt.Sprintf("%s %s debit=%s credit=%s account=%s category=%s",
+		transaction.Date.Format("2006-01-02"),
+		transaction.Description,
+		formatStoredAmount(transaction.Debit),
+		formatStoredAmount(transaction.Credit),
+		transaction.Account,
+		transaction.Category,
+	)
+}
+
+func describeSplits(splits []TransactionSplit) string {
+	lines := []string{}
+	for _, split := range splits {
+		line := fmt.Sprintf("%s %.2f", split.Category, split.Amount)
+		if split.Note != "" {
+			line += " (" + split.Note + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "; ")
+}
+
+// diffTransactions returns one audit entry for each editable field that differs between the two transactions.
+func diffTransactions(oldTransaction Transaction, newTransaction Transaction) (entries []AuditEntry) {
+	fields := []struct {
+		name             string
+		oldValue, newVal string
+	}{
+		{"date", oldTransaction.Date.Format("2006-01-02"), newTransaction.Date.Format("2006-01-02")},
+		{"description", oldTransaction.Description, newTransaction.Description},
+		{"debit", formatStoredAmount(oldTransaction.Debit), formatStoredAmount(newTransaction.Debit)},
+		{"credit", formatStoredAmount(oldTransaction.Credit), formatStoredAmount(newTransaction.Credit)},
+	}
+
+	for _, field := range fields {
+		if field.oldValue != field.newVal {
+			entries = append(entries, AuditEntry{
+				Entity:   auditEntityTransaction,
+				EntityId: oldTransaction.UniqueId,
+				Field:    field.name,
+				OldValue: field.oldValue,
+				NewValue: field.newVal,
+			})
+		}
+	}
+
+	return entries
+}
+
+func ReadAuditLog(db *sql.DB, filter AuditFilter) (entries []AuditEntry, err error) {
+	query := `SELECT unique_id, entity, entity_id, field, old_value, new_value, actor, timestamp
+		FROM audit_log WHERE 1 = 1`
+	args := []any{}
+
+	if filter.Entity != "" {
+		query += " AND entity = ?"
+		args = append(args, filter.Entity)
+	}
+	if filter.EntityId != "" {
+		query += " AND entity_id = ?"
+		args = append(args, filter.EntityId)
+	}
+	if filter.Actor != "" {
+		query += " AND actor = ?"
+		args = append(args, filter.Actor)
+	}
+	if filter.Field != "" {
+		query += " AND field = ?"
+		args = append(args, filter.Field)
+	}
+	// Timestamps are stored as sortable text so the date bounds compare lexically:
+	if filter.From != "" {
+		query += " AND timestamp >= ?"
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		query += " AND timestamp < date(?, '+1 day')"
+		args = append(args, filter.To)
+	}
+
+	query += " ORDER BY unique_id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries = []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var oldValue, newValue sql.NullString
+		err := rows.Scan(&entry.UniqueId, &entry.Entity, &entry.EntityId, &entry.Field, &oldValue, &newValue, &entry.Actor, &entry.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		entry.OldValue = oldValue.String
+		entry.NewValue = newValue.String
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func readAuditActors(db *sql.DB) (actors []string, err error) {
+	rows, err := db.Query("SELECT DISTINCT actor FROM audit_log ORDER BY actor")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var actor string
+		err := rows.Scan(&actor)
+		if err != nil {
+			return nil, err
+		}
+		actors = append(actors, actor)
+	}
+
+	return actors, rows.Err()
+}
+
+type auditPageContent struct {
+	Filter       AuditFilter
+	Entries      []AuditEntry
+	Actors       []string
+	CurrentActor string
+}
+
+func (h *storeHandlers) auditHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Picking a name sets the cookie used to attribute every following change:
+	if r.Method == http.MethodPost {
+		http.SetCookie(w, &http.Cookie{
+			Name:     actorCookieName,
+			Value:    strings.TrimSpace(r.FormValue("actor")),
+			Path:     "/",
+			Expires:  time.Now().AddDate(1, 0, 0),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/audit", http.StatusSeeOther)
+		return
+	}
+
+	params := r.URL.Query()
+	filter := AuditFilter{
+		Entity:   params.Get("entity"),
+		EntityId: strings.TrimSpace(params.Get("entity_id")),
+		Actor:    params.Get("actor"),
+		Field:    strings.TrimSpace(params.Get("field")),
+		From:     params.Get("from"),
+		To:       params.Get("to"),
+		Limit:    500,
+	}
+
+	entries, err := h.audit.ReadAuditLog(filter)
+	if err != nil {
+		log.Println("Unable to query the audit log:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	actors, err := h.audit.ReadAuditActors()
+	if err != nil {
+		log.Println("Unable to query the audit log actors:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("../templates/audit.html")
+	if err != nil {
+		log.Fatal("Unable to load the audit.html template: ", err)
+	}
+
+	// Filter changes made through htmx only need the table body:
+	templateName := "audit.html"
+	if r.Header.Get("HX-Request") == "true" {
+		templateName = "auditRows"
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, auditPageContent{
+		Filter:       filter,
+		Entries:      entries,
+		Actors:       actors,
+		CurrentActor: actorFromRequest(r),
+	})
+	if err != nil {
+		log.Println("Unable to render the audit template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
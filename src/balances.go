@@ -0,0 +1,444 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	balanceKindOpening   = "opening"
+	balanceKindStatement = "statement"
+)
+
+// AccountBalance is a balance reported for an account. An opening balance is the balance at the start of its date,
+// before any of that day's transactions. A statement balance is the balance the bank reported at the end of its
+// date.
+type AccountBalance struct {
+	UniqueId int
+	Account  string
+	Date     time.Time
+	Balance  float64
+	Kind     string
+}
+
+func describeBalance(balance AccountBalance) string {
+	return fmt.Sprintf("%s %.2f", balance.Date.Format("2006-01-02"), balance.Balance)
+}
+
+// OpeningBalances holds the opening balance of every account that has one, keyed by account.
+type OpeningBalances map[string]AccountBalance
+
+func openingBalances(balances []AccountBalance) OpeningBalances {
+	openings := make(OpeningBalances)
+	for _, balance := range balances {
+		if balance.Kind == balanceKindOpening {
+			openings[balance.Account] = balance
+		}
+	}
+	return openings
+}
+
+// countsTowardsBalance reports whether a transaction moves its account's running balance. Transactions dated before
+// an account's opening balance are already included in it. Accounts without an opening balance start from zero.
+func (o OpeningBalances) countsTowardsBalance(transaction Transaction) bool {
+	opening, ok := o[transaction.Account]
+	return !ok || !transaction.Date.Before(opening.Date)
+}
+
+// balanceFlow is how much a transaction moves its account's balance. Transfers are included as they move money
+// between accounts even though they are neither income nor an expense.
+func (o OpeningBalances) balanceFlow(transaction Transaction) float64 {
+	if !o.countsTowardsBalance(transaction) {
+		return 0.0
+	}
+	return float64(transaction.Credit) - float64(transaction.Debit)
+}
+
+// flowsBefore sums the balance flow of every account over the transactions dated before day. Opening balances are
+// not included.
+func (o OpeningBalances) flowsBefore(transactions []Transaction, day time.Time) map[string]float64 {
+	flows := make(map[string]float64)
+	for _, transaction := range transactions {
+		if transaction.Date.Before(day) {
+			flows[transaction.Account] += o.balanceFlow(transaction)
+		}
+	}
+	return flows
+}
+
+// Reconciliation compares a statement balance with the balance computed from the transactions up to its date.
+type Reconciliation struct {
+	Statement AccountBalance
+	Computed  float64
+
+	// Difference is the statement balance less the computed balance, Change is how much the difference moved since
+	// the previous statement of the account:
+	Difference float64
+	Change     float64
+
+	// Statements dated before the account's opening balance cannot be reconciled:
+	BeforeOpening bool
+}
+
+func (r Reconciliation) Reconciled() bool {
+	return math.Abs(r.Difference) < 0.005
+}
+
+// Diverges reports whether the computed balance drifted away from the bank's between the previous statement and
+// this one, i.e. whether a transaction is missing, duplicated or wrong somewhere in between.
+func (r Reconciliation) Diverges() bool {
+	return !r.BeforeOpening && math.Abs(r.Change) >= 0.005
+}
+
+type AccountReconciliation struct {
+	Account        string
+	Opening        *AccountBalance
+	Statements     []Reconciliation
+	ClosingBalance float64
+}
+
+// ReconcileBalances computes the running balance of every account from its opening balance and transactions and
+// compares it against each of the account's statement balances.
+func ReconcileBalances(transactions []Transaction, balances []AccountBalance) []AccountReconciliation {
+	openings := openingBalances(balances)
+
+	accounts := make(map[string]*AccountReconciliation)
+	accountTransactions := make(map[string][]Transaction)
+	reconciliationFor := func(account string) *AccountReconciliation {
+		reconciliation, ok := accounts[account]
+		if !ok {
+			reconciliation = &AccountReconciliation{Account: account}
+			accounts[account] = reconciliation
+		}
+		return reconciliation
+	}
+
+	for _, transaction := range transactions {
+		reconciliationFor(transaction.Account)
+		accountTransactions[transaction.Account] = append(accountTransactions[transaction.Account], transaction)
+	}
+	for _, balance := range balances {
+		reconciliation := reconciliationFor(balance.Account)
+		if balance.Kind == balanceKindOpening {
+			opening := balance
+			reconciliation.Opening = &opening
+		} else {
+			reconciliation.Statements = append(reconciliation.Statements, Reconciliation{Statement: balance})
+		}
+	}
+
+	reconciliations := []AccountReconciliation{}
+	for account, reconciliation := range accounts {
+		transactions := accountTransactions[account]
+		sort.SliceStable(transactions, func(i, j int) bool {
+			return transactions[i].Date.Before(transactions[j].Date)
+		})
+		sort.Slice(reconciliation.Statements, func(i, j int) bool {
+			return reconciliation.Statements[i].Statement.Date.Before(reconciliation.Statements[j].Statement.Date)
+		})
+
+		openingBalance := 0.0
+		if reconciliation.Opening != nil {
+			openingBalance = reconciliation.Opening.Balance
+		}
+
+		// Both are in date order so each statement only adds the transactions since the previous one:
+		flow, next, previousDifference := 0.0, 0, 0.0
+		for i := range reconciliation.Statements {
+			statement := &reconciliation.Statements[i]
+			for next < len(transactions) && !transactions[next].Date.After(statement.Statement.Date) {
+				flow += openings.balanceFlow(transactions[next])
+				next++
+			}
+
+			if reconciliation.Opening != nil && statement.Statement.Date.Before(reconciliation.Opening.Date) {
+				statement.BeforeOpening = true
+				continue
+			}
+
+			statement.Computed = openingBalance + flow
+			// Rounded to cents so float error in the sums is never shown as a difference:
+			statement.Difference = float64(toCents(statement.Statement.Balance-statement.Computed)) / 100
+			statement.Change = float64(toCents(statement.Difference-previousDifference)) / 100
+			previousDifference = statement.Difference
+		}
+		for ; next < len(transactions); next++ {
+			flow += openings.balanceFlow(transactions[next])
+		}
+		reconciliation.ClosingBalance = openingBalance + flow
+
+		reconciliations = append(reconciliations, *reconciliation)
+	}
+
+	sort.Slice(reconciliations, func(i, j int) bool {
+		return reconciliations[i].Account < reconciliations[j].Account
+	})
+
+	return reconciliations
+}
+
+func ReadAccountBalances(db *sql.DB) (balances []AccountBalance, err error) {
+	rows, err := db.Query("SELECT unique_id, account, date, balance, kind FROM account_balances ORDER BY account, date")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var balance AccountBalance
+		var date string
+		err := rows.Scan(&balance.UniqueId, &balance.Account, &date, &balance.Balance, &balance.Kind)
+		if err != nil {
+			return nil, err
+		}
+		balance.Date, err = time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+
+	return balances, rows.Err()
+}
+
+// SaveAccountBalance records a balance. An account only has one opening balance so a new one replaces the old, and a
+// statement balance replaces any statement balance for the same account and date.
+func SaveAccountBalance(db *sql.DB, balance AccountBalance, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	replacedQuery := "SELECT unique_id, date, balance FROM account_balances WHERE account = ? AND kind = ? AND date = ?"
+	replacedArgs := []any{balance.Account, balance.Kind, balance.Date.Format("2006-01-02")}
+	if balance.Kind == balanceKindOpening {
+		replacedQuery = "SELECT unique_id, date, balance FROM account_balances WHERE account = ? AND kind = ?"
+		replacedArgs = replacedArgs[:2]
+	}
+
+	oldValue := ""
+	var replacedId int
+	var replacedDate string
+	var replacedBalance float64
+	err = tx.QueryRow(replacedQuery, replacedArgs...).Scan(&replacedId, &replacedDate, &replacedBalance)
+	if err == nil {
+		oldValue = fmt.Sprintf("%s %.2f", replacedDate, replacedBalance)
+		_, err = tx.Exec("DELETE FROM account_balances WHERE unique_id = ?", replacedId)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO account_balances(account, date, balance, kind) values(?, ?, ?, ?)",
+		balance.Account, balance.Date.Format("2006-01-02"), balance.Balance, balance.Kind)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityBalance,
+		EntityId: balance.Account,
+		Field:    balance.Kind,
+		OldValue: oldValue,
+		NewValue: describeBalance(balance),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteAccountBalance removes a balance, returning sql.ErrNoRows when it does not exist.
+func DeleteAccountBalance(db *sql.DB, balanceId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var balance AccountBalance
+	var date string
+	err = tx.QueryRow("SELECT account, date, balance, kind FROM account_balances WHERE unique_id = ?", balanceId).Scan(
+		&balance.Account, &date, &balance.Balance, &balance.Kind)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM account_balances WHERE unique_id = ?", balanceId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityBalance,
+		EntityId: balance.Account,
+		Field:    balance.Kind,
+		OldValue: fmt.Sprintf("%s %.2f", date, balance.Balance),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadBudget resamples the transactions of a date range with the running balance carried in from the transactions
+// before the range, so the dashboard shows the real balance of the accounts rather than the net flow of the range.
+func (h *storeHandlers) loadBudget(dateRange TransactionFilter, transactions []Transaction, frequency Frequency) (BudgetStatement, error) {
+	balances, err := h.balances.ReadAccountBalances()
+	if err != nil {
+		return BudgetStatement{}, err
+	}
+	openings := openingBalances(balances)
+
+	startingBalances := map[string]float64{}
+	if dateRange.From != "" {
+		from, err := time.Parse("2006-01-02", dateRange.From)
+		if err != nil {
+			return BudgetStatement{}, err
+		}
+
+		earlierTransactions, err := h.transactions.ReadTransactionsInRange(TransactionFilter{
+			To:      from.AddDate(0, 0, -1).Format("2006-01-02"),
+			Account: dateRange.Account,
+		})
+		if err != nil {
+			return BudgetStatement{}, err
+		}
+		startingBalances = openings.flowsBefore(earlierTransactions, from)
+	}
+
+	return LoadBudgetWithBalances(transactions, frequency, openings, startingBalances)
+}
+
+// parseBalanceForm reads the account, date and amount of a balance. Unlike transaction amounts a balance can be
+// negative, e.g. for a credit card.
+func parseBalanceForm(r *http.Request) (balance AccountBalance, err error) {
+	balance.Account = strings.TrimSpace(r.FormValue("account"))
+	if balance.Account == "" {
+		balance.Account = defaultAccount
+	}
+
+	balance.Date, err = time.Parse("2006-01-02", strings.TrimSpace(r.FormValue("date")))
+	if err != nil {
+		return balance, fmt.Errorf("the date must be in the format YYYY-MM-DD")
+	}
+
+	rawBalance := strings.TrimSpace(strings.Replace(strings.TrimSpace(r.FormValue("balance")), "$", "", 1))
+	balance.Balance, err = strconv.ParseFloat(rawBalance, 64)
+	if err != nil {
+		return balance, fmt.Errorf("%q is not a valid balance", rawBalance)
+	}
+
+	balance.Kind = r.FormValue("kind")
+	if balance.Kind != balanceKindOpening && balance.Kind != balanceKindStatement {
+		return balance, fmt.Errorf("unknown balance kind %q", balance.Kind)
+	}
+
+	return balance, nil
+}
+
+type balancesPageContent struct {
+	Accounts []AccountReconciliation
+	Error    string
+}
+
+func (h *storeHandlers) renderBalances(w http.ResponseWriter, templateName string, content balancesPageContent) {
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		log.Println("Unable to extract all transactions from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	balances, err := h.balances.ReadAccountBalances()
+	if err != nil {
+		log.Println("Unable to query the account balances:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content.Accounts = ReconcileBalances(transactions, balances)
+
+	tmpl, err := template.ParseFiles("../templates/balances.html")
+	if err != nil {
+		log.Fatal("Unable to load the balances.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, content)
+	if err != nil {
+		log.Println("Unable to render the balances template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// balancesHandler lists the opening and statement balances of every account and reconciles the statements against
+// the computed running balance.
+func (h *storeHandlers) balancesHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.renderBalances(w, "balances.html", balancesPageContent{})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := balancesPageContent{}
+	switch r.FormValue("action") {
+	case "save":
+		balance, err := parseBalanceForm(r)
+		if err != nil {
+			content.Error = err.Error()
+			break
+		}
+
+		err = h.balances.SaveAccountBalance(balance, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to save the account balance:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "delete":
+		balanceId, err := strconv.Atoi(r.FormValue("balance_id"))
+		if err != nil {
+			http.Error(w, "Invalid balance_id", http.StatusBadRequest)
+			return
+		}
+
+		err = h.balances.DeleteAccountBalance(balanceId, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to delete the account balance:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	h.renderBalances(w, "balanceContent", content)
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CategoryBudget is the amount planned to be spent in a category during a month. A budget that is carried forward
+// also applies to every following month until another budget is set for the category.
+type CategoryBudget struct {
+	UniqueId     int
+	Category     string
+	Month        time.Time
+	Amount       float64
+	CarryForward bool
+}
+
+func describeBudget(budget CategoryBudget) string {
+	description := fmt.Sprintf("%s %.2f", budget.Month.Format("2006-01"), budget.Amount)
+	if budget.CarryForward {
+		description += " carried forward"
+	}
+	return description
+}
+
+// monthStart truncates a date to the first day of its month.
+func monthStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// budgetsForMonth picks the budget that applies to each category in a month: the latest budget set on or before the
+// month, as long as it was set for that month or is carried forward. A budget that is not carried forward therefore
+// also ends the carrying forward of an earlier one.
+func budgetsForMonth(budgets []CategoryBudget, month time.Time) map[string]CategoryBudget {
+	latest := make(map[string]CategoryBudget)
+	for _, budget := range budgets {
+		if budget.Month.After(month) {
+			continue
+		}
+		current, ok := latest[budget.Category]
+		if !ok || budget.Month.After(current.Month) {
+			latest[budget.Category] = budget
+		}
+	}
+
+	applying := make(map[string]CategoryBudget)
+	for category, budget := range latest {
+		if budget.Month.Equal(month) || budget.CarryForward {
+			applying[category] = budget
+		}
+	}
+	return applying
+}
+
+// BudgetVariance compares the budget of a category with what was actually spent in it during the month.
+type BudgetVariance struct {
+	Category string
+	Budget   *CategoryBudget
+
+	// Spending is net of refunds, i.e. the expenses less the income of the category's lines:
+	Actual float64
+}
+
+func (v BudgetVariance) Amount() float64 {
+	if v.Budget == nil {
+		return 0.0
+	}
+	return v.Budget.Amount
+}
+
+// Variance is how much of the budget is left, negative once the category is over budget.
+func (v BudgetVariance) Variance() float64 {
+	return v.Amount() - v.Actual
+}
+
+func (v BudgetVariance) PercentUsed() float64 {
+	if v.Amount() <= 0 {
+		return 0.0
+	}
+	return v.Actual / v.Amount() * 100
+}
+
+// ProgressWidth is the width of the progress bar as a percentage, full once the budget is used up.
+func (v BudgetVariance) ProgressWidth() float64 {
+	return math.Max(0, math.Min(100, v.PercentUsed()))
+}
+
+func (v BudgetVariance) OverBudget() bool {
+	return v.Budget != nil && toCents(v.Actual) > toCents(v.Amount())
+}
+
+// CarriedForward reports whether the budget applying to the month was set in an earlier month.
+func (v BudgetVariance) CarriedForward(month time.Time) bool {
+	return v.Budget != nil && v.Budget.Month.Before(month)
+}
+
+// BuildBudgetVariances compares the budgets applying to a month with the transactions of that month. Categories that
+// were spent in without a budget are included so unplanned spending still shows up.
+func BuildBudgetVariances(transactions []Transaction, budgets []CategoryBudget, month time.Time) []BudgetVariance {
+	actuals := make(map[string]float64)
+	for _, transaction := range transactions {
+		if transaction.IsTransfer || !monthStart(transaction.Date).Equal(month) {
+			continue
+		}
+		for _, line := range transaction.CategoryLines() {
+			actuals[line.Category] += line.Expenses - line.Income
+		}
+	}
+
+	applying := budgetsForMonth(budgets, month)
+
+	variances := []BudgetVariance{}
+	for category, budget := range applying {
+		budget := budget
+		variances = append(variances, BudgetVariance{Category: category, Budget: &budget, Actual: actuals[category]})
+	}
+	for category, actual := range actuals {
+		if _, ok := applying[category]; ok || toCents(actual) <= 0 {
+			continue
+		}
+		variances = append(variances, BudgetVariance{Category: category, Actual: actual})
+	}
+
+	// Budgeted categories come first, most used first, followed by the unbudgeted spending:
+	sort.Slice(variances, func(i, j int) bool {
+		if (variances[i].Budget == nil) != (variances[j].Budget == nil) {
+			return variances[i].Budget != nil
+		}
+		if variances[i].PercentUsed() != variances[j].PercentUsed() {
+			return variances[i].PercentUsed() > variances[j].PercentUsed()
+		}
+		if variances[i].Actual != variances[j].Actual {
+			return variances[i].Actual > variances[j].Actual
+		}
+		return variances[i].Category < variances[j].Category
+	})
+
+	return variances
+}
+
+func ReadCategoryBudgets(db *sql.DB) (budgets []CategoryBudget, err error) {
+	rows, err := db.Query("SELECT unique_id, category, month, amount, carry_forward FROM category_budgets ORDER BY category, month")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var budget CategoryBudget
+		var month string
+		err := rows.Scan(&budget.UniqueId, &budget.Category, &month, &budget.Amount, &budget.CarryForward)
+		if err != nil {
+			return nil, err
+		}
+		budget.Month, err = time.Parse("2006-01", month)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, rows.Err()
+}
+
+// SaveCategoryBudget sets the budget of a category for a month, replacing any budget already set for that month.
+func SaveCategoryBudget(db *sql.DB, budget CategoryBudget, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	oldValue := ""
+	var replaced CategoryBudget
+	err = tx.QueryRow("SELECT amount, carry_forward FROM category_budgets WHERE category = ? AND month = ?",
+		budget.Category, budget.Month.Format("2006-01")).Scan(&replaced.Amount, &replaced.CarryForward)
+	if err == nil {
+		replaced.Month = budget.Month
+		oldValue = describeBudget(replaced)
+	} else if err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO category_budgets(category, month, amount, carry_forward) values(?, ?, ?, ?)
+		ON CONFLICT(category, month) DO UPDATE SET amount = excluded.amount, carry_forward = excluded.carry_forward`,
+		budget.Category, budget.Month.Format("2006-01"), budget.Amount, budget.CarryForward)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityBudget,
+		EntityId: budget.Category,
+		Field:    "amount",
+		OldValue: oldValue,
+		NewValue: describeBudget(budget),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCategoryBudget removes a budget, returning sql.ErrNoRows when it does not exist.
+func DeleteCategoryBudget(db *sql.DB, budgetId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var budget CategoryBudget
+	var month string
+	err = tx.QueryRow("SELECT category, month, amount, carry_forward FROM category_budgets WHERE unique_id = ?", budgetId).Scan(
+		&budget.Category, &month, &budget.Amount, &budget.CarryForward)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	budget.Month, _ = time.Parse("2006-01", month)
+
+	_, err = tx.Exec("DELETE FROM category_budgets WHERE unique_id = ?", budgetId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityBudget,
+		EntityId: budget.Category,
+		Field:    "amount",
+		OldValue: describeBudget(budget),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// parseBudgetMonth reads a month in the format YYYY-MM, defaulting to the current month.
+func parseBudgetMonth(rawMonth string) (time.Time, error) {
+	rawMonth = strings.TrimSpace(rawMonth)
+	if rawMonth == "" {
+		return monthStart(time.Now()), nil
+	}
+
+	month, err := time.Parse("2006-01", rawMonth)
+	if err != nil {
+		return month, fmt.Errorf("the month must be in the format YYYY-MM")
+	}
+	return month, nil
+}
+
+func parseBudgetForm(r *http.Request) (budget CategoryBudget, err error) {
+	budget.Month, err = parseBudgetMonth(r.FormValue("month"))
+	if err != nil {
+		return budget, err
+	}
+
+	budget.Category = strings.TrimSpace(r.FormValue("category"))
+	if budget.Category == "" {
+		return budget, fmt.Errorf("a budget needs a category")
+	}
+
+	amount, err := parseFormAmount(r.FormValue("amount"), "budget")
+	if err != nil {
+		return budget, err
+	}
+	budget.Amount = float64(amount)
+	budget.CarryForward = r.FormValue("carry_forward") != ""
+
+	return budget, nil
+}
+
+type budgetsPageContent struct {
+	Month      time.Time
+	Variances  []BudgetVariance
+	Categories []string
+	Error      string
+
+	TotalBudget, TotalActual float64
+}
+
+func (c budgetsPageContent) MonthURL(offset int) string {
+	return "/budgets?" + url.Values{"month": {c.Month.AddDate(0, offset, 0).Format("2006-01")}}.Encode()
+}
+
+func (c budgetsPageContent) TotalVariance() float64 {
+	return c.TotalBudget - c.TotalActual
+}
+
+func (h *storeHandlers) renderBudgets(w http.ResponseWriter, templateName string, content budgetsPageContent) {
+	transactions, err := h.transactions.ReadTransactionsInRange(TransactionFilter{
+		From: content.Month.Format("2006-01-02"),
+		To:   content.Month.AddDate(0, 1, -1).Format("2006-01-02"),
+	})
+	if err != nil {
+		log.Println("Unable to query the transactions of the month:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	budgets, err := h.budgets.ReadCategoryBudgets()
+	if err != nil {
+		log.Println("Unable to query the category budgets:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content.Variances = BuildBudgetVariances(transactions, budgets, content.Month)
+	for _, variance := range content.Variances {
+		content.TotalBudget += variance.Amount()
+		content.TotalActual += variance.Actual
+	}
+
+	// Every category that has ever been budgeted or appears this month is offered in the form:
+	categories := make(map[string]bool)
+	for _, budget := range budgets {
+		categories[budget.Category] = true
+	}
+	for _, variance := range content.Variances {
+		categories[variance.Category] = true
+	}
+	for category := range categories {
+		content.Categories = append(content.Categories, category)
+	}
+	sort.Strings(content.Categories)
+
+	tmpl, err := template.ParseFiles("../templates/budgets.html")
+	if err != nil {
+		log.Fatal("Unable to load the budgets.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, content)
+	if err != nil {
+		log.Println("Unable to render the budgets template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// budgetsHandler shows the budget of every category against what was spent in it during a month.
+func (h *storeHandlers) budgetsHandler(w http.ResponseWriter, r *http.Request) {
+
+	month, err := parseBudgetMonth(r.FormValue("month"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		h.renderBudgets(w, "budgets.html", budgetsPageContent{Month: month})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := budgetsPageContent{Month: month}
+	switch r.FormValue("action") {
+	case "save":
+		budget, err := parseBudgetForm(r)
+		if err != nil {
+			content.Error = err.Error()
+			break
+		}
+
+		err = h.budgets.SaveCategoryBudget(budget, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to save the category budget:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "delete":
+		budgetId, err := strconv.Atoi(r.FormValue("budget_id"))
+		if err != nil {
+			http.Error(w, "Invalid budget_id", http.StatusBadRequest)
+			return
+		}
+
+		err = h.budgets.DeleteCategoryBudget(budgetId, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to delete the category budget:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	h.renderBudgets(w, "budgetContent", content)
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestBudgetsForMonth(t *testing.T) {
+	budgets := []CategoryBudget{
+		{UniqueId: 1, Category: "Groceries", Month: testDate("2023-01-01"), Amount: 400, CarryForward: true},
+		{UniqueId: 2, Category: "Groceries", Month: testDate("2023-04-01"), Amount: 450, CarryForward: true},
+		{UniqueId: 3, Category: "Travel", Month: testDate("2023-02-01"), Amount: 1000},
+		{UniqueId: 4, Category: "Dining", Month: testDate("2023-01-01"), Amount: 150, CarryForward: true},
+		{UniqueId: 5, Category: "Dining", Month: testDate("2023-03-01"), Amount: 100},
+	}
+
+	tests := []struct {
+		month string
+		want  map[string]int
+	}{
+		{"2022-12-01", map[string]int{}},
+		{"2023-01-01", map[string]int{"Groceries": 1, "Dining": 4}},
+		// Travel is only budgeted for the month it was set in:
+		{"2023-02-01", map[string]int{"Groceries": 1, "Travel": 3, "Dining": 4}},
+		// A budget that is not carried forward ends the carrying forward of the earlier one after its month:
+		{"2023-03-01", map[string]int{"Groceries": 1, "Dining": 5}},
+		{"2023-04-01", map[string]int{"Groceries": 2}},
+		{"2024-01-01", map[string]int{"Groceries": 2}},
+	}
+
+	for _, test := range tests {
+		got := budgetsForMonth(budgets, testDate(test.month))
+		if len(got) != len(test.want) {
+			t.Errorf("budgetsForMonth(%s) = %+v, want the budgets %v", test.month, got, test.want)
+			continue
+		}
+		for category, budgetId := range test.want {
+			if got[category].UniqueId != budgetId {
+				t.Errorf("budgetsForMonth(%s) picked %+v for %s, want budget %d", test.month, got[category], category, budgetId)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Shades of the heatmap from no spending to the top quarter of spending days:
+var calendarLevelClasses = []string{"bg-gray-200", "bg-red-200", "bg-red-300", "bg-red-500", "bg-red-700"}
+
+// CalendarDay is one cell of the heatmap. Days of the neighbouring years pad the first and last weeks and are not
+// drawn.
+type CalendarDay struct {
+	Date     time.Time
+	Expenses float64
+	Level    int
+	InYear   bool
+}
+
+func (d CalendarDay) Class() string {
+	return calendarLevelClasses[d.Level]
+}
+
+// CalendarWeek is a column of the heatmap from Monday to Sunday, labelled with the month that starts in it.
+type CalendarWeek struct {
+	Days       [7]CalendarDay
+	MonthLabel string
+}
+
+// WeekdaySummary is the spending on one day of the week over the days of the year the transactions cover.
+type WeekdaySummary struct {
+	Weekday time.Weekday
+	Days    int
+	Total   float64
+}
+
+func (s WeekdaySummary) Average() float64 {
+	if s.Days == 0 {
+		return 0.0
+	}
+	return s.Total / float64(s.Days)
+}
+
+// SpendingCalendar is the daily spending of a year laid out as a heatmap of weeks, with the spending by day of the
+// week. Transactions are imported with a date but no time of day, so spending cannot be broken down by hour.
+type SpendingCalendar struct {
+	Year     int
+	Weeks    []CalendarWeek
+	Weekdays []WeekdaySummary
+	Total    float64
+	Busiest  CalendarDay
+}
+
+// weekdayColumn is the row of a day in the heatmap, with the weeks starting on a Monday like FrequencyWeek.
+func weekdayColumn(day time.Time) int {
+	return (int(day.Weekday()) + 6) % 7
+}
+
+// spendingLevels returns the quartiles of the days with any spending, the bounds of the heatmap's shades.
+func spendingLevels(daily map[time.Time]float64) []float64 {
+	amounts := []float64{}
+	for _, amount := range daily {
+		if toCents(amount) > 0 {
+			amounts = append(amounts, amount)
+		}
+	}
+	if len(amounts) == 0 {
+		return nil
+	}
+	sort.Float64s(amounts)
+
+	levels := []float64{}
+	for _, quantile := range []float64{0.25, 0.5, 0.75} {
+		levels = append(levels, amounts[int(quantile*float64(len(amounts)-1))])
+	}
+	return levels
+}
+
+func spendingLevel(amount float64, levels []float64) int {
+	if toCents(amount) <= 0 {
+		return 0
+	}
+	level := 1
+	for _, bound := range levels {
+		if amount > bound {
+			level++
+		}
+	}
+	return level
+}
+
+// BuildSpendingCalendar lays out a daily series over the weeks of a year. Only the days the series covers count
+// towards the weekday summary, so a year that is partly imported is not averaged over days without transactions.
+func BuildSpendingCalendar(year int, series Series) SpendingCalendar {
+	calendar := SpendingCalendar{Year: year}
+
+	daily := make(map[time.Time]float64)
+	for _, point := range series {
+		daily[dayIndex(point.PeriodStart)] += point.Expenses
+	}
+	levels := spendingLevels(daily)
+
+	for weekday := time.Monday; weekday <= time.Saturday; weekday++ {
+		calendar.Weekdays = append(calendar.Weekdays, WeekdaySummary{Weekday: weekday})
+	}
+	calendar.Weekdays = append(calendar.Weekdays, WeekdaySummary{Weekday: time.Sunday})
+	for day := range daily {
+		summary := &calendar.Weekdays[weekdayColumn(day)]
+		summary.Days++
+		summary.Total += daily[day]
+	}
+
+	firstDay := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	nextYear := firstDay.AddDate(1, 0, 0)
+	for weekStart := firstDay.AddDate(0, 0, -weekdayColumn(firstDay)); weekStart.Before(nextYear); weekStart = weekStart.AddDate(0, 0, 7) {
+		week := CalendarWeek{}
+		for i := range week.Days {
+			day := weekStart.AddDate(0, 0, i)
+			week.Days[i] = CalendarDay{Date: day, InYear: day.Year() == year}
+			if !week.Days[i].InYear {
+				continue
+			}
+
+			week.Days[i].Expenses = daily[day]
+			week.Days[i].Level = spendingLevel(daily[day], levels)
+			calendar.Total += daily[day]
+			if daily[day] > calendar.Busiest.Expenses {
+				calendar.Busiest = week.Days[i]
+			}
+			if day.Day() == 1 {
+				week.MonthLabel = day.Format("Jan")
+			}
+		}
+		calendar.Weeks = append(calendar.Weeks, week)
+	}
+
+	return calendar
+}
+
+type calendarPageContent struct {
+	SpendingCalendar
+	Years        []int
+	WeekdayNames []string
+}
+
+// calendarHandler renders the heatmap of daily spending for the year in the year parameter, by default the year of
+// the latest transaction.
+func (h *storeHandlers) calendarHandler(w http.ResponseWriter, r *http.Request) {
+
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		log.Println("Unable to extract all transactions from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	years := make(map[int]bool)
+	latest := time.Now()
+	for i, transaction := range transactions {
+		years[transaction.Date.Year()] = true
+		if i == 0 || transaction.Date.After(latest) {
+			latest = transaction.Date
+		}
+	}
+
+	year := latest.Year()
+	if raw := r.URL.Query().Get("year"); raw != "" {
+		year, err = strconv.Atoi(raw)
+		if err != nil || year < 1 || year > 9999 {
+			http.Error(w, fmt.Sprintf("%q is not a year", raw), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dateRange := TransactionFilter{From: fmt.Sprintf("%04d-01-01", year), To: fmt.Sprintf("%04d-12-31", year)}
+	yearTransactions, err := h.transactions.ReadTransactionsInRange(dateRange)
+	if err != nil {
+		log.Println("Unable to extract the transactions of the year:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	budget, err := h.loadBudget(dateRange, yearTransactions, FrequencyDay)
+	if err != nil {
+		log.Println("Unable to resample the daily spending:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content := calendarPageContent{
+		SpendingCalendar: BuildSpendingCalendar(year, budget.Series()),
+		WeekdayNames:     []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"},
+	}
+	for year := range years {
+		content.Years = append(content.Years, year)
+	}
+	sort.Ints(content.Years)
+
+	tmpl, err := template.ParseFiles("../templates/calendar.html")
+	if err != nil {
+		log.Fatal("Unable to load the calendar.html template: ", err)
+	}
+
+	err = tmpl.Execute(w, content)
+	if err != nil {
+		log.Println("Unable to render the calendar.html template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type calendarDayContent struct {
+	Date         time.Time
+	Transactions []Transaction
+}
+
+// calendarDayHandler renders the transactions of the day in the date parameter, loaded when a day of the heatmap is
+// clicked.
+func (h *storeHandlers) calendarDayHandler(w http.ResponseWriter, r *http.Request) {
+
+	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, "The date must be in the format YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	day := date.Format("2006-01-02")
+	transactions, err := h.transactions.ReadTransactionsInRange(TransactionFilter{From: day, To: day})
+	if err != nil {
+		log.Println("Unable to extract the transactions of the day:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("../templates/calendar.html")
+	if err != nil {
+		log.Fatal("Unable to load the calendar.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "calendarDay", calendarDayContent{Date: date, Transactions: transactions})
+	if err != nil {
+		log.Println("Unable to render the day's transactions: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildSpendingCalendar(t *testing.T) {
+	// The first of January 2023 is a Sunday. The 2nd only has income, so it is covered but spends nothing:
+	series := Series{
+		{PeriodStart: testDate("2023-01-01"), Expenses: 10},
+		{PeriodStart: testDate("2023-01-02"), Income: 500},
+		{PeriodStart: testDate("2023-01-09"), Expenses: 40},
+		{PeriodStart: testDate("2023-02-01"), Expenses: 20},
+		{PeriodStart: testDate("2023-06-15"), Expenses: 100},
+	}
+	calendar := BuildSpendingCalendar(2023, series)
+
+	days := make(map[time.Time]CalendarDay)
+	months := []string{}
+	for _, week := range calendar.Weeks {
+		for _, day := range week.Days {
+			days[day.Date] = day
+		}
+		if week.MonthLabel != "" {
+			months = append(months, week.MonthLabel)
+		}
+	}
+
+	// The quartiles of the spending days are 10, 20 and 40:
+	tests := []struct {
+		date     string
+		expenses float64
+		level    int
+		inYear   bool
+	}{
+		{"2022-12-26", 0, 0, false},
+		{"2023-01-01", 10, 1, true},
+		{"2023-01-02", 0, 0, true},
+		{"2023-01-09", 40, 3, true},
+		{"2023-02-01", 20, 2, true},
+		{"2023-06-15", 100, 4, true},
+		{"2023-12-31", 0, 0, true},
+	}
+	for _, test := range tests {
+		day, ok := days[testDate(test.date)]
+		if !ok || day.Expenses != test.expenses || day.Level != test.level || day.InYear != test.inYear {
+			t.Errorf("%s is %+v, want %v spent at level %d in the year %t", test.date, day, test.expenses, test.level, test.inYear)
+		}
+	}
+
+	// The first week starts on the Monday before the first of January and the last one ends on the 31st of December:
+	if len(calendar.Weeks) != 53 || !calendar.Weeks[0].Days[0].Date.Equal(testDate("2022-12-26")) {
+		t.Errorf("the calendar has %d weeks from %s, want 53 from 2022-12-26", len(calendar.Weeks), calendar.Weeks[0].Days[0].Date.Format("2006-01-02"))
+	}
+	if len(months) != 12 || months[0] != "Jan" || months[11] != "Dec" {
+		t.Errorf("the weeks are labelled %v, want every month from Jan to Dec", months)
+	}
+	if calendar.Total != 170 || !calendar.Busiest.Date.Equal(testDate("2023-06-15")) {
+		t.Errorf("the calendar totals %v with its busiest day on %s, want 170 on 2023-06-15", calendar.Total, calendar.Busiest.Date.Format("2006-01-02"))
+	}
+
+	weekdays := []WeekdaySummary{
+		{Weekday: time.Monday, Days: 2, Total: 40},
+		{Weekday: time.Tuesday},
+		{Weekday: time.Wednesday, Days: 1, Total: 20},
+		{Weekday: time.Thursday, Days: 1, Total: 100},
+		{Weekday: time.Friday},
+		{Weekday: time.Saturday},
+		{Weekday: time.Sunday, Days: 1, Total: 10},
+	}
+	if !reflect.DeepEqual(calendar.Weekdays, weekdays) || calendar.Weekdays[0].Average() != 20 {
+		t.Errorf("the weekdays are %+v, want %+v", calendar.Weekdays, weekdays)
+	}
+}
+
+func TestSpendingLevel(t *testing.T) {
+	tests := []struct {
+		amount float64
+		levels []float64
+		want   int
+	}{
+		{0, []float64{10, 20, 40}, 0},
+		{0.004, []float64{10, 20, 40}, 0},
+		{10, []float64{10, 20, 40}, 1},
+		{10.01, []float64{10, 20, 40}, 2},
+		{40, []float64{10, 20, 40}, 3},
+		{1000, []float64{10, 20, 40}, 4},
+		// Every spending day is the lightest shade when there are no levels:
+		{25, nil, 1},
+	}
+
+	for _, test := range tests {
+		if level := spendingLevel(test.amount, test.levels); level != test.want {
+			t.Errorf("spendingLevel(%v, %v) = %d, want %d", test.amount, test.levels, level, test.want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// ComparisonPeriod is an inclusive range of days on one side of a comparison report.
+type ComparisonPeriod struct {
+	From time.Time
+	To   time.Time
+}
+
+func (p ComparisonPeriod) Days() int {
+	return int(math.Round(p.To.Sub(p.From).Hours()/24)) + 1
+}
+
+func (p ComparisonPeriod) filter() TransactionFilter {
+	return TransactionFilter{From: p.From.Format("2006-01-02"), To: p.To.Format("2006-01-02")}
+}
+
+func (p ComparisonPeriod) String() string {
+	return p.From.Format("Jan 2, 2006") + " to " + p.To.Format("Jan 2, 2006")
+}
+
+// ComparisonRow is the spending of a category or payee in the base period and the compared period.
+type ComparisonRow struct {
+	Name    string
+	Base    float64
+	Current float64
+}
+
+func (r ComparisonRow) Change() float64 {
+	return r.Current - r.Base
+}
+
+// PercentChange is the change relative to the base period, which has none when nothing was spent in it.
+func (r ComparisonRow) PercentChange() (float64, bool) {
+	if toCents(r.Base) == 0 {
+		return 0.0, false
+	}
+	return r.Change() / r.Base * 100, true
+}
+
+func (r ComparisonRow) PercentDisplay() string {
+	percent, ok := r.PercentChange()
+	if !ok {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", percent)
+}
+
+// Comparison puts the spending of two periods side by side. Spending is the debits of each category and payee,
+// with split transactions counted under the category of each line, and transfers left out.
+type Comparison struct {
+	Base       ComparisonPeriod
+	Current    ComparisonPeriod
+	Total      ComparisonRow
+	Income     ComparisonRow
+	Categories []ComparisonRow
+	Payees     []ComparisonRow
+}
+
+func spendingByKey(transactions []Transaction) (categories map[string]float64, payees map[string]float64, expenses float64, income float64) {
+	categories = make(map[string]float64)
+	payees = make(map[string]float64)
+	for _, transaction := range transactions {
+		if transaction.IsTransfer {
+			continue
+		}
+		income += float64(transaction.Credit)
+		if !transaction.IsDebit() {
+			continue
+		}
+		expenses += float64(transaction.Debit)
+		payees[recurringKey(transaction)] += float64(transaction.Debit)
+		for _, line := range transaction.CategoryLines() {
+			categories[line.Category] += line.Expenses
+		}
+	}
+	return categories, payees, expenses, income
+}
+
+// comparisonRows pairs up the keys of both periods, the largest changes first.
+func comparisonRows(base map[string]float64, current map[string]float64) []ComparisonRow {
+	rows := []ComparisonRow{}
+	for name, amount := range base {
+		rows = append(rows, ComparisonRow{Name: name, Base: amount, Current: current[name]})
+	}
+	for name, amount := range current {
+		if _, ok := base[name]; !ok {
+			rows = append(rows, ComparisonRow{Name: name, Current: amount})
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		iChange, jChange := math.Abs(rows[i].Change()), math.Abs(rows[j].Change())
+		if toCents(iChange) != toCents(jChange) {
+			return iChange > jChange
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+func BuildComparison(base ComparisonPeriod, baseTransactions []Transaction, current ComparisonPeriod, currentTransactions []Transaction) Comparison {
+	baseCategories, basePayees, baseExpenses, baseIncome := spendingByKey(baseTransactions)
+	currentCategories, currentPayees, currentExpenses, currentIncome := spendingByKey(currentTransactions)
+
+	return Comparison{
+		Base:       base,
+		Current:    current,
+		Total:      ComparisonRow{Name: "Total spending", Base: baseExpenses, Current: currentExpenses},
+		Income:     ComparisonRow{Name: "Income", Base: baseIncome, Current: currentIncome},
+		Categories: comparisonRows(baseCategories, currentCategories),
+		Payees:     comparisonRows(basePayees, currentPayees),
+	}
+}
+
+// comparisonFrequency picks the size of the chart's aligned periods from the length of the longer period.
+func comparisonFrequency(base ComparisonPeriod, current ComparisonPeriod) Frequency {
+	days := base.Days()
+	if current.Days() > days {
+		days = current.Days()
+	}
+	switch {
+	case days <= 62:
+		return FrequencyDay
+	case days <= 182:
+		return FrequencyWeek
+	default:
+		return FrequencyMonth
+	}
+}
+
+// offset is the index of the aligned period date falls in, counted from the start of the period.
+func (p ComparisonPeriod) offset(date time.Time, frequency Frequency) int {
+	switch frequency {
+	case FrequencyWeek:
+		return int(date.Sub(p.From).Hours()/24) / 7
+	case FrequencyMonth:
+		return (date.Year()-p.From.Year())*12 + int(date.Month()) - int(p.From.Month())
+	default:
+		return int(date.Sub(p.From).Hours() / 24)
+	}
+}
+
+// comparisonChart is the overlaid chart of the report: the cumulative spending of both periods, aligned on the
+// days, weeks or months since the start of each period.
+type comparisonChart struct {
+	Labels  []string  `json:"labels"`
+	Base    []float64 `json:"base"`
+	Current []float64 `json:"current"`
+}
+
+func cumulativeSpending(period ComparisonPeriod, transactions []Transaction, frequency Frequency) []float64 {
+	spending := make([]float64, period.offset(period.To, frequency)+1)
+	for _, transaction := range transactions {
+		if transaction.IsTransfer || !transaction.IsDebit() {
+			continue
+		}
+		spending[period.offset(dayIndex(transaction.Date), frequency)] += float64(transaction.Debit)
+	}
+	for i := 1; i < len(spending); i++ {
+		spending[i] += spending[i-1]
+	}
+	return spending
+}
+
+func buildComparisonChart(comparison Comparison, baseTransactions []Transaction, currentTransactions []Transaction) comparisonChart {
+	frequency := comparisonFrequency(comparison.Base, comparison.Current)
+	chart := comparisonChart{
+		Labels:  []string{},
+		Base:    cumulativeSpending(comparison.Base, baseTransactions, frequency),
+		Current: cumulativeSpending(comparison.Current, currentTransactions, frequency),
+	}
+
+	unit := map[Frequency]string{FrequencyDay: "Day", FrequencyWeek: "Week", FrequencyMonth: "Month"}[frequency]
+	points := len(chart.Base)
+	if len(chart.Current) > points {
+		points = len(chart.Current)
+	}
+	for i := 1; i <= points; i++ {
+		chart.Labels = append(chart.Labels, fmt.Sprintf("%s %d", unit, i))
+	}
+
+	return chart
+}
+
+// parseComparisonPeriods reads the compared period from from and to, and the base period from base_from and base_to.
+// The compared period defaults to the year to date of the latest transaction and the base period to the same days a
+// year earlier.
+func parseComparisonPeriods(r *http.Request, latest time.Time) (base ComparisonPeriod, current ComparisonPeriod, err error) {
+	params := r.URL.Query()
+	parse := func(name string, fallback time.Time) (time.Time, error) {
+		raw := params.Get(name)
+		if raw == "" {
+			return fallback, nil
+		}
+		date, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return date, fmt.Errorf("%q is not a date in the format YYYY-MM-DD", raw)
+		}
+		return date, nil
+	}
+
+	latest = dayIndex(latest)
+	current.From, err = parse("from", time.Date(latest.Year(), time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return base, current, err
+	}
+	current.To, err = parse("to", latest)
+	if err != nil {
+		return base, current, err
+	}
+	base.From, err = parse("base_from", current.From.AddDate(-1, 0, 0))
+	if err != nil {
+		return base, current, err
+	}
+	base.To, err = parse("base_to", current.To.AddDate(-1, 0, 0))
+	if err != nil {
+		return base, current, err
+	}
+
+	for _, period := range []ComparisonPeriod{base, current} {
+		if period.From.After(period.To) {
+			return base, current, fmt.Errorf("the from date must be on or before the to date")
+		}
+	}
+
+	return base, current, nil
+}
+
+type comparisonTable struct {
+	Heading string
+	Rows    []ComparisonRow
+}
+
+type comparePageContent struct {
+	Comparison
+	Tables    []comparisonTable
+	ChartJSON template.JS
+
+	// Links that compare the same dates against the year before and against the period just before:
+	YearOverYearURL, PreviousPeriodURL string
+}
+
+func comparisonURL(base ComparisonPeriod, current ComparisonPeriod) string {
+	params := url.Values{}
+	params.Set("from", current.From.Format("2006-01-02"))
+	params.Set("to", current.To.Format("2006-01-02"))
+	params.Set("base_from", base.From.Format("2006-01-02"))
+	params.Set("base_to", base.To.Format("2006-01-02"))
+	return "/compare?" + params.Encode()
+}
+
+// compareHandler renders the comparison report of two periods, by default this year to date against the same days
+// last year.
+func (h *storeHandlers) compareHandler(w http.ResponseWriter, r *http.Request) {
+
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		log.Println("Unable to extract all transactions from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	latest := time.Now()
+	if len(transactions) > 0 {
+		latest = transactions[0].Date
+		for _, transaction := range transactions {
+			if transaction.Date.After(latest) {
+				latest = transaction.Date
+			}
+		}
+	}
+
+	base, current, err := parseComparisonPeriods(r, latest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	baseTransactions, err := h.transactions.ReadTransactionsInRange(base.filter())
+	if err != nil {
+		log.Println("Unable to extract the transactions of the base period:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	currentTransactions, err := h.transactions.ReadTransactionsInRange(current.filter())
+	if err != nil {
+		log.Println("Unable to extract the transactions of the compared period:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comparison := BuildComparison(base, baseTransactions, current, currentTransactions)
+	chartJSON, err := json.Marshal(buildComparisonChart(comparison, baseTransactions, currentTransactions))
+	if err != nil {
+		log.Println("Unable to encode the comparison chart:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	previousTo := current.From.AddDate(0, 0, -1)
+	content := comparePageContent{
+		Comparison: comparison,
+		Tables: []comparisonTable{
+			{Heading: "Category", Rows: comparison.Categories},
+			{Heading: "Payee", Rows: comparison.Payees},
+		},
+		ChartJSON: template.JS(chartJSON),
+		YearOverYearURL: comparisonURL(ComparisonPeriod{
+			From: current.From.AddDate(-1, 0, 0),
+			To:   current.To.AddDate(-1, 0, 0),
+		}, current),
+		PreviousPeriodURL: comparisonURL(ComparisonPeriod{
+			From: previousTo.AddDate(0, 0, 1-current.Days()),
+			To:   previousTo,
+		}, current),
+	}
+
+	tmpl, err := template.ParseFiles("../templates/compare.html")
+	if err != nil {
+		log.Fatal("Unable to load the compare.html template: ", err)
+	}
+
+	err = tmpl.Execute(w, content)
+	if err != nil {
+		log.Println("Unable to render the compare.html template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildComparison(t *testing.T) {
+	base := ComparisonPeriod{From: testDate("2022-01-01"), To: testDate("2022-03-31")}
+	current := ComparisonPeriod{From: testDate("2023-01-01"), To: testDate("2023-03-31")}
+
+	withCategory := func(transaction Transaction, category string) Transaction {
+		transaction.Category = category
+		return transaction
+	}
+	salary := func(id string, date string, amount float32) Transaction {
+		transaction := testTransaction(id, date, "ACME PAYROLL", 0, "Checking")
+		transaction.Credit = amount
+		return transaction
+	}
+
+	// A split transaction counts under the category of each line, but once under its payee:
+	split := withCategory(testTransaction("split", "2023-02-01", "SUPERMARKET", 100, "Checking"), "Groceries")
+	split.Splits = []TransactionSplit{{Category: "Groceries", Amount: 60}, {Category: "Household", Amount: 40}}
+	transfer := testTransaction("transfer", "2023-02-15", "TO SAVINGS", 1000, "Checking")
+	transfer.IsTransfer = true
+
+	baseTransactions := []Transaction{
+		salary("salary-1", "2022-01-25", 2000),
+		withCategory(testTransaction("rent-1", "2022-01-01", "LANDLORD", 900, "Checking"), "Rent"),
+		withCategory(testTransaction("groceries-1", "2022-02-01", "SUPERMARKET", 150, "Checking"), "Groceries"),
+		withCategory(testTransaction("gym-1", "2022-03-01", "GYM", 50, "Checking"), "Fitness"),
+	}
+	currentTransactions := []Transaction{
+		salary("salary-2", "2023-01-25", 2200),
+		withCategory(testTransaction("rent-2", "2023-01-01", "LANDLORD", 950, "Checking"), "Rent"),
+		split,
+		withCategory(testTransaction("dining-2", "2023-03-01", "BISTRO", 120, "Checking"), "Dining"),
+		transfer,
+	}
+
+	comparison := BuildComparison(base, baseTransactions, current, currentTransactions)
+
+	tests := []struct {
+		name       string
+		got, want  []ComparisonRow
+		percentage []string
+	}{
+		{
+			name: "totals",
+			got:  []ComparisonRow{comparison.Total, comparison.Income},
+			want: []ComparisonRow{
+				{Name: "Total spending", Base: 1100, Current: 1170},
+				{Name: "Income", Base: 2000, Current: 2200},
+			},
+			percentage: []string{"+6.4%", "+10.0%"},
+		},
+		{
+			// The largest changes first, with ties by name:
+			name: "categories",
+			got:  comparison.Categories,
+			want: []ComparisonRow{
+				{Name: "Dining", Current: 120},
+				{Name: "Groceries", Base: 150, Current: 60},
+				{Name: "Fitness", Base: 50},
+				{Name: "Rent", Base: 900, Current: 950},
+				{Name: "Household", Current: 40},
+			},
+			percentage: []string{"new", "-60.0%", "-100.0%", "+5.6%", "new"},
+		},
+		{
+			name: "payees",
+			got:  comparison.Payees,
+			want: []ComparisonRow{
+				{Name: "BISTRO", Current: 120},
+				{Name: "GYM", Base: 50},
+				{Name: "LANDLORD", Base: 900, Current: 950},
+				{Name: "SUPERMARKET", Base: 150, Current: 100},
+			},
+			percentage: []string{"new", "-100.0%", "+5.6%", "-33.3%"},
+		},
+		{
+			name: "nothing in either period",
+			got:  BuildComparison(base, nil, current, nil).Categories,
+			want: []ComparisonRow{},
+		},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: compared %+v, want %+v", test.name, test.got, test.want)
+			continue
+		}
+		for i, row := range test.got {
+			if row.PercentDisplay() != test.percentage[i] {
+				t.Errorf("%s: %s changed by %s, want %s", test.name, row.Name, row.PercentDisplay(), test.percentage[i])
+			}
+		}
+	}
+}
+
+func TestComparisonChart(t *testing.T) {
+	tests := []struct {
+		name          string
+		base, current ComparisonPeriod
+		labels        []string
+		baseSpending  []float64
+	}{
+		{
+			name:         "days",
+			base:         ComparisonPeriod{From: testDate("2023-01-01"), To: testDate("2023-01-04")},
+			current:      ComparisonPeriod{From: testDate("2023-02-01"), To: testDate("2023-02-03")},
+			labels:       []string{"Day 1", "Day 2", "Day 3", "Day 4"},
+			baseSpending: []float64{10, 10, 30, 30},
+		},
+		{
+			name:         "weeks",
+			base:         ComparisonPeriod{From: testDate("2023-01-01"), To: testDate("2023-03-31")},
+			current:      ComparisonPeriod{From: testDate("2023-04-01"), To: testDate("2023-04-30")},
+			labels:       []string{"Week 1", "Week 2", "Week 3", "Week 4", "Week 5", "Week 6", "Week 7", "Week 8", "Week 9", "Week 10", "Week 11", "Week 12", "Week 13"},
+			baseSpending: []float64{30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		},
+		{
+			name:         "months",
+			base:         ComparisonPeriod{From: testDate("2022-12-15"), To: testDate("2023-06-30")},
+			current:      ComparisonPeriod{From: testDate("2023-07-01"), To: testDate("2023-09-30")},
+			labels:       []string{"Month 1", "Month 2", "Month 3", "Month 4", "Month 5", "Month 6", "Month 7"},
+			baseSpending: []float64{0, 30, 30, 30, 30, 30, 30},
+		},
+	}
+
+	for _, test := range tests {
+		transactions := []Transaction{
+			testTransaction("first", "2023-01-01", "BAKERY", 10, "Checking"),
+			testTransaction("third", "2023-01-03", "BAKERY", 20, "Checking"),
+		}
+		comparison := BuildComparison(test.base, transactions, test.current, nil)
+		chart := buildComparisonChart(comparison, transactions, nil)
+		if !reflect.DeepEqual(chart.Labels, test.labels) || !reflect.DeepEqual(chart.Base, test.baseSpending) {
+			t.Errorf("%s: chart %v of %v, want %v of %v", test.name, chart.Labels, chart.Base, test.labels, test.baseSpending)
+		}
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"sort"
 	"strconv"
 	"time"
 
@@ -23,44 +22,361 @@ type Transaction struct {
 	Description string
 	Debit       float32
 	Credit      float32
+	Category    string
+	Account     string
+	Payee       string
+	Splits      []TransactionSplit
+
+	// Set when the transaction is one side of a confirmed transfer between two of our own accounts:
+	IsTransfer bool
 }
 
-func RebuildDatabase(dbPath string) (*sql.DB, error) {
+// Columns selected for every transaction read so that the scan order in scanTransaction is defined in one place. The
+// canonical payee name is looked up inline so every read path can keep selecting FROM transactions:
+const transactionColumns = `unique_id, date, description, debit, credit, category, account,
+	COALESCE((SELECT name FROM payees WHERE payees.unique_id = transactions.payee_id), '')`
 
-	os.Remove(dbPath)
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	db, err := sql.Open("sqlite3", dbPath)
+func scanTransaction(row rowScanner) (transaction Transaction, err error) {
+	var extractedUniqueId, extractedDate, extractedDescription, extractedDebit, extractedCredit, extractedCategory, extractedAccount, extractedPayee string
+
+	err = row.Scan(&extractedUniqueId, &extractedDate, &extractedDescription, &extractedDebit, &extractedCredit, &extractedCategory, &extractedAccount, &extractedPayee)
 	if err != nil {
-		log.Fatal(err)
+		return transaction, err
+	}
+
+	// Blank debit and credit values from the csv are stored as empty strings so they are formatted as 0.0:
+	var formattedCredit float32
+	if extractedCredit != "" {
+		formattedCredit64, err := strconv.ParseFloat(extractedCredit, 32)
+		if err != nil {
+			return transaction, fmt.Errorf("converting the credit value: %w", err)
+		}
+		formattedCredit = float32(formattedCredit64)
+	}
+	var formattedDebit float32
+	if extractedDebit != "" {
+		formattedDebit64, err := strconv.ParseFloat(extractedDebit, 32)
+		if err != nil {
+			return transaction, fmt.Errorf("converting the debit value: %w", err)
+		}
+		formattedDebit = float32(formattedDebit64)
+	}
+
+	transactionTime, err := time.Parse("2006-01-02", extractedDate)
+	if err != nil {
+		return transaction, fmt.Errorf("loading transaction time into a date struct: %w", err)
 	}
 
-	createCoreSchema := `
+	return Transaction{
+		UniqueId:    extractedUniqueId,
+		Date:        transactionTime,
+		Description: extractedDescription,
+		Debit:       formattedDebit,
+		Credit:      formattedCredit,
+		Category:    extractedCategory,
+		Account:     extractedAccount,
+		Payee:       extractedPayee,
+	}, nil
+}
+
+// requireAffectedRow turns an update or delete that matched nothing into sql.ErrNoRows, the same error a read of a
+// missing row returns.
+func requireAffectedRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// sqliteColumn is a column added to a table that already existed in an earlier version of the schema.
+type sqliteColumn struct {
+	table, name, definition string
+}
+
+// sqliteMigration is one step of the SQLite schema. ALTER TABLE has no IF NOT EXISTS, so new columns on existing tables
+// are listed separately and only added when they are missing.
+type sqliteMigration struct {
+	columns []sqliteColumn
+	schema  string
+}
+
+// The SQLite schema, applied in order on startup and by RebuildDatabase. Like postgresMigrations each step is recorded
+// in schema_migrations and new ones must only ever be appended to the end of the list. Every step is also safe to
+// re-run, as databases built before the steps were recorded start again from the first one.
+var sqliteMigrations = []sqliteMigration{
+	// 1: transactions and upload tracking
+	{schema: `
 	CREATE TABLE IF NOT EXISTS transactions (
 		unique_id BLOB not null primary key,
 		date TEXT not null,
 		description TEXT,
 		debit REAL,
 		credit REAL
-	);`
-
-	_, err = db.Exec(createCoreSchema)
-	if err != nil {
-		log.Fatal("Error in creating the transactions table in the SQLite db:", err)
-		return db, err
-	}
-
-	createUploadTrackingSchema := `
+	);
 	CREATE TABLE IF NOT EXISTS uploaded_files (
 		unique_id INTEGER PRIMARY KEY AUTOINCREMENT, 
 		filename TEXT, 
 		date_uploaded TEXT NOT NULL,
 		num_rows INTEGER, 
 		file_size REAL
-	);`
+	);`},
+
+	// 2: attachments, the files themselves live in attachmentDir
+	{schema: `
+	CREATE TABLE IF NOT EXISTS attachments (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		transaction_id BLOB NOT NULL REFERENCES transactions(unique_id),
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		file_size INTEGER,
+		date_uploaded TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_attachments_transaction_id ON attachments(transaction_id);`},
+
+	// 3: categories and split lines
+	{
+		columns: []sqliteColumn{{"transactions", "category", "TEXT NOT NULL DEFAULT 'Uncategorized'"}},
+		schema: `
+	CREATE TABLE IF NOT EXISTS transaction_splits (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		transaction_id BLOB NOT NULL REFERENCES transactions(unique_id),
+		category TEXT NOT NULL,
+		note TEXT,
+		amount REAL NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_transaction_splits_transaction_id ON transaction_splits(transaction_id);`,
+	},
+
+	// 4: accounts and transfers between them
+	{
+		columns: []sqliteColumn{{"transactions", "account", "TEXT NOT NULL DEFAULT 'Default'"}},
+		schema: `
+	CREATE TABLE IF NOT EXISTS transfer_links (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		debit_transaction_id BLOB NOT NULL REFERENCES transactions(unique_id),
+		credit_transaction_id BLOB NOT NULL REFERENCES transactions(unique_id),
+		status TEXT NOT NULL DEFAULT 'candidate',
+		date_detected TEXT NOT NULL,
+		UNIQUE(debit_transaction_id, credit_transaction_id)
+	);`,
+	},
+
+	// 5: payees and their aliases
+	{
+		columns: []sqliteColumn{{"transactions", "payee_id", "INTEGER REFERENCES payees(unique_id)"}},
+		schema: `
+	CREATE TABLE IF NOT EXISTS payees (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE IF NOT EXISTS payee_aliases (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		payee_id INTEGER NOT NULL REFERENCES payees(unique_id),
+		pattern TEXT NOT NULL,
+		UNIQUE(payee_id, pattern)
+	);`,
+	},
+
+	// 6: append-only audit log, the triggers reject any attempt to rewrite or remove history
+	{schema: `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entity TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		field TEXT NOT NULL,
+		old_value TEXT,
+		new_value TEXT,
+		actor TEXT NOT NULL,
+		timestamp TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity, entity_id);
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;`},
+
+	// 7: the trash, and the upload each transaction came from so a whole upload can be trashed
+	{columns: []sqliteColumn{
+		{"transactions", "upload_id", "INTEGER REFERENCES uploaded_files(unique_id)"},
+		{"transactions", "deleted_at", "TEXT"},
+		{"uploaded_files", "deleted_at", "TEXT"},
+	}},
+
+	// 8: date range reads
+	{schema: `
+	CREATE INDEX IF NOT EXISTS idx_transactions_date ON transactions(date);`},
+
+	// 9: balances reported for an account, either the opening balance the running balance starts from or a balance
+	// from a bank statement that the running balance is reconciled against
+	{schema: `
+	CREATE TABLE IF NOT EXISTS account_balances (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account TEXT NOT NULL,
+		date TEXT NOT NULL,
+		balance REAL NOT NULL,
+		kind TEXT NOT NULL,
+		UNIQUE(account, kind, date)
+	);`},
+
+	// 10: planned spending per category and month, months are stored as YYYY-MM
+	{schema: `
+	CREATE TABLE IF NOT EXISTS category_budgets (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		category TEXT NOT NULL,
+		month TEXT NOT NULL,
+		amount REAL NOT NULL,
+		carry_forward INTEGER NOT NULL DEFAULT 0,
+		UNIQUE(category, month)
+	);`},
+
+	// 11: upcoming transactions entered by hand for the forecast
+	{schema: `
+	CREATE TABLE IF NOT EXISTS scheduled_transactions (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date TEXT NOT NULL,
+		description TEXT NOT NULL,
+		debit REAL NOT NULL DEFAULT 0,
+		credit REAL NOT NULL DEFAULT 0,
+		account TEXT NOT NULL DEFAULT 'Default'
+	);`},
+
+	// 12: anomalies flagged after each import, kept once dismissed so they are not flagged again
+	{schema: `
+	CREATE TABLE IF NOT EXISTS anomalies (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		key TEXT NOT NULL,
+		transaction_id TEXT,
+		summary TEXT NOT NULL,
+		detected_at TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'open',
+		UNIQUE(kind, key)
+	);`},
+
+	// 13: assets and liabilities valued by hand for the net worth, with one valuation per account and date
+	{schema: `
+	CREATE TABLE IF NOT EXISTS net_worth_accounts (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		kind TEXT NOT NULL,
+		asset_class TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS valuations (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id INTEGER NOT NULL REFERENCES net_worth_accounts(unique_id),
+		date TEXT NOT NULL,
+		value REAL NOT NULL,
+		UNIQUE(account_id, date)
+	);`},
+
+	// 14: savings goals, linked to either an account or a category
+	{schema: `
+	CREATE TABLE IF NOT EXISTS savings_goals (
+		unique_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		target_amount REAL NOT NULL,
+		target_date TEXT NOT NULL,
+		account TEXT NOT NULL DEFAULT '',
+		category TEXT NOT NULL DEFAULT ''
+	);`},
+}
 
-	_, err = db.Exec(createUploadTrackingSchema)
+// migrateSQLite brings the database up to the latest schema, applying every migration that has not been recorded in
+// schema_migrations yet, and then sets up the search index.
+func migrateSQLite(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
 	if err != nil {
-		log.Fatal("Unable to create the schema for uploaded file tracking")
+		return err
+	}
+
+	var currentVersion int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&currentVersion)
+	if err != nil {
+		return err
+	}
+
+	for i := currentVersion; i < len(sqliteMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		err = applySQLiteMigration(tx, sqliteMigrations[i])
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO schema_migrations(version, applied_at) values(?, ?)", i+1, time.Now().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return ensureSearchIndex(db)
+}
+
+func applySQLiteMigration(tx *sql.Tx, migration sqliteMigration) error {
+	for _, column := range migration.columns {
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", column.table, column.name).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.table, column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	if migration.schema == "" {
+		return nil
+	}
+	_, err := tx.Exec(migration.schema)
+	return err
+}
+
+func RebuildDatabase(dbPath string) (*sql.DB, error) {
+
+	os.Remove(dbPath)
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Attachment files live outside of the database so they are cleared alongside it:
+	os.RemoveAll(attachmentDir)
+
+	err = migrateSQLite(db)
+	if err != nil {
+		log.Fatal("Unable to create the schema in the SQLite db:", err)
 		return db, err
 	}
 
@@ -132,56 +448,19 @@ func LoadTestData(testCsvPath string, db *sql.DB) (transactions []Transaction, e
 	fmt.Println("Inserted all test data into db.")
 
 	// Re-querying the inserted records from the database:
-	rows, err := db.Query("SELECT * FROM transactions")
+	rows, err := db.Query("SELECT " + transactionColumns + " FROM transactions WHERE deleted_at IS NULL")
 	if err != nil {
 		log.Fatal("Unable to query the newly inserted rows into the transaction table:", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var extractedUniqueId, extractedDate, extractedDescription, extractedDebit, extractedCredit string
-
-		err := rows.Scan(&extractedUniqueId, &extractedDate, &extractedDescription, &extractedDebit, &extractedCredit)
+		transaction, err := scanTransaction(rows)
 		if err != nil {
 			log.Fatal("Error in querying row from test database:", err)
 		}
 
-		// Correctly formatting all of the data from the db:
-		//fmt.Println(extractedUniqueId, extractedDate, extractedDescription, extractedDebit, extractedCredit)
-
-		var formattedCredit float32
-		if extractedCredit == "" {
-			formattedCredit = 0.0
-		} else {
-			formattedCredit64, err := strconv.ParseFloat(extractedCredit, 32)
-			formattedCredit = float32(formattedCredit64)
-			if err != nil {
-				log.Fatal("Error in converting the credit value to a format: ", err)
-			}
-		}
-		var formattedDebit float32
-		if extractedDebit == "" {
-			formattedDebit = 0.0
-		} else {
-			formattedDebit64, err := strconv.ParseFloat(extractedDebit, 32)
-			formattedDebit = float32(formattedDebit64)
-			if err != nil {
-				log.Fatal("Error in converting the debit value to a format: ", err)
-			}
-		}
-
-		transactionTime, err := time.Parse("2006-01-02", extractedDate)
-		if err != nil {
-			log.Fatal("Error in loading transaction time into a date struct", err)
-		}
-
-		transactions = append(transactions, Transaction{
-			UniqueId:    extractedUniqueId,
-			Date:        transactionTime,
-			Description: extractedDescription,
-			Debit:       formattedDebit,
-			Credit:      formattedCredit,
-		})
+		transactions = append(transactions, transaction)
 
 		err = rows.Err()
 		if err != nil {
@@ -193,67 +472,116 @@ func LoadTestData(testCsvPath string, db *sql.DB) (transactions []Transaction, e
 
 }
 
+// TransactionFilter narrows a read down to a window of dates and optionally a single account or category. Dates are
+// inclusive and use the YYYY-MM-DD format they are stored in, so they compare correctly as text and can use the index
+// on date. Empty fields are not filtered on.
+type TransactionFilter struct {
+	From     string
+	To       string
+	Account  string
+	Category string
+}
+
+func (f TransactionFilter) IsEmpty() bool {
+	return f.From == "" && f.To == "" && f.Account == "" && f.Category == ""
+}
+
+// whereClause returns the conditions on the transactions table for the filter. Trashed transactions are always
+// excluded and a category matches either the category of the transaction or one of its split lines.
+func (f TransactionFilter) whereClause() (where string, args []any) {
+	where = "transactions.deleted_at IS NULL"
+
+	if f.From != "" {
+		where += " AND transactions.date >= ?"
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		where += " AND transactions.date <= ?"
+		args = append(args, f.To)
+	}
+	if f.Account != "" {
+		where += " AND transactions.account = ?"
+		args = append(args, f.Account)
+	}
+	if f.Category != "" {
+		where += " AND (transactions.category = ? OR transactions.unique_id IN (SELECT transaction_id FROM transaction_splits WHERE transaction_splits.category = ?))"
+		args = append(args, f.Category, f.Category)
+	}
+
+	return where, args
+}
+
 func ReadAllTransactions(db *sql.DB) (transactions []Transaction, err error) {
-	// Re-querying the inserted records from the database:
-	rows, err := db.Query("SELECT * FROM transactions")
+	return ReadTransactionsInRange(db, TransactionFilter{})
+}
+
+// ReadTransactionsInRange reads only the transactions matching the filter, together with their split lines and
+// transfer flags, in date order.
+func ReadTransactionsInRange(db *sql.DB, filter TransactionFilter) (transactions []Transaction, err error) {
+	where, args := filter.whereClause()
+
+	rows, err := db.Query("SELECT "+transactionColumns+" FROM transactions WHERE "+where+" ORDER BY transactions.date, transactions.rowid", args...)
 	if err != nil {
-		log.Fatal("Unable to query the newly inserted rows into the transaction table:", err)
+		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var extractedUniqueId, extractedDate, extractedDescription, extractedDebit, extractedCredit string
-
-		err := rows.Scan(&extractedUniqueId, &extractedDate, &extractedDescription, &extractedDebit, &extractedCredit)
+		transaction, err := scanTransaction(rows)
 		if err != nil {
-			log.Fatal("Error in querying row from test database:", err)
+			return nil, err
 		}
 
-		// Correctly formatting all of the data from the db:
-		//fmt.Println(extractedUniqueId, extractedDate, extractedDescription, extractedDebit, extractedCredit)
-
-		var formattedCredit float32
-		if extractedCredit == "" {
-			formattedCredit = 0.0
-		} else {
-			formattedCredit64, err := strconv.ParseFloat(extractedCredit, 32)
-			formattedCredit = float32(formattedCredit64)
-			if err != nil {
-				log.Fatal("Error in converting the credit value to a format: ", err)
-			}
-		}
-		var formattedDebit float32
-		if extractedDebit == "" {
-			formattedDebit = 0.0
-		} else {
-			formattedDebit64, err := strconv.ParseFloat(extractedDebit, 32)
-			formattedDebit = float32(formattedDebit64)
-			if err != nil {
-				log.Fatal("Error in converting the debit value to a format: ", err)
-			}
-		}
+		transactions = append(transactions, transaction)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
 
-		transactionTime, err := time.Parse("2006-01-02", extractedDate)
-		if err != nil {
-			log.Fatal("Error in loading transaction time into a date struct", err)
-		}
+	splitRows, err := db.Query(`SELECT unique_id, transaction_id, category, note, amount FROM transaction_splits
+		WHERE transaction_id IN (SELECT unique_id FROM transactions WHERE `+where+`) ORDER BY unique_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	splits, err := scanSplits(splitRows)
+	if err != nil {
+		return nil, err
+	}
+	splitsByTransaction := make(map[string][]TransactionSplit)
+	for _, split := range splits {
+		splitsByTransaction[split.TransactionId] = append(splitsByTransaction[split.TransactionId], split)
+	}
 
-		transactions = append(transactions, Transaction{
-			UniqueId:    extractedUniqueId,
-			Date:        transactionTime,
-			Description: extractedDescription,
-			Debit:       formattedDebit,
-			Credit:      formattedCredit,
-		})
+	transferIds, err := ReadConfirmedTransferIds(db)
+	if err != nil {
+		return nil, err
+	}
 
-		err = rows.Err()
-		if err != nil {
-			log.Fatal("Error in closing the db query connection:", err)
-		}
+	for i := range transactions {
+		transactions[i].Splits = splitsByTransaction[transactions[i].UniqueId]
+		transactions[i].IsTransfer = transferIds[transactions[i].UniqueId]
 	}
 
 	return transactions, nil
+}
 
+func ReadTransaction(db *sql.DB, transactionId string) (transaction Transaction, err error) {
+	row := db.QueryRow("SELECT "+transactionColumns+" FROM transactions WHERE unique_id = ? AND deleted_at IS NULL", transactionId)
+
+	transaction, err = scanTransaction(row)
+	if err != nil {
+		return transaction, err
+	}
+
+	transaction.Splits, err = ReadTransactionSplits(db, transactionId)
+	if err != nil {
+		return transaction, err
+	}
+
+	transferIds, err := ReadConfirmedTransferIds(db)
+	transaction.IsTransfer = transferIds[transactionId]
+
+	return transaction, err
 }
 
 type TransactionHistory struct {
@@ -265,9 +593,10 @@ type TransactionHistory struct {
 }
 
 func ReadTransactionHistory(db *sql.DB) (transactionHistory []TransactionHistory, err error) {
-	rows, err := db.Query("SELECT * FROM uploaded_files")
+	rows, err := db.Query(`SELECT unique_id, filename, date_uploaded, num_rows, file_size
+		FROM uploaded_files WHERE deleted_at IS NULL`)
 	if err != nil {
-		log.Fatal("Unable to query the newly inserted rows into the transaction table:", err)
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -280,7 +609,6 @@ func ReadTransactionHistory(db *sql.DB) (transactionHistory []TransactionHistory
 
 		err := rows.Scan(&uniqueId, &fileName, &dateUploaded, &numRows, &fileSize)
 		if err != nil {
-			log.Fatal("Unable to query the transaction history:", err)
 			return nil, err
 		}
 
@@ -293,7 +621,7 @@ func ReadTransactionHistory(db *sql.DB) (transactionHistory []TransactionHistory
 		})
 	}
 
-	return history, err
+	return history, rows.Err()
 }
 
 // Database Transaction Resampling:
@@ -306,92 +634,199 @@ type Row struct {
 type BudgetStatement struct {
 	dateTimeIndex                       []time.Time
 	expenseTimeseries, incomeTimeseries []float64
-	dailyResample                       map[time.Time]Row
-}
 
-func (b *BudgetStatement) resampleTimeseriesDaily() {
-	// Function resamples the expense and income timeseries to a daily step.
+	// How much each transaction moves the running balance, and the balance of each account before the first
+	// transaction. Opening balances are added on their date:
+	balanceTimeseries []float64
+	startingBalances  map[string]float64
+	openings          OpeningBalances
 
-	// Step 1: Generate a full list of all dates between the date ranges in the timeseries:
-	var earliestDate, lastDate time.Time = b.dateTimeIndex[len(b.dateTimeIndex)-1], b.dateTimeIndex[0]
+	// Income, expenses and the running balance for each period of the frequency, in date order:
+	frequency Frequency
+	series    Series
+	trends    Trends
 
-	numDaysBetweenDates := int(lastDate.Sub(earliestDate).Hours() / 24)
+	// Category totals are built from split lines where a transaction has been split, so a single transaction can
+	// contribute to several categories. The balance in the series still uses each parent amount once:
+	categoryTotals     map[string]Row
+	categoryLineCounts map[string]int
 
-	for i := 0; i <= numDaysBetweenDates; i++ {
+	// Closing balance of each account, including the transfers that are excluded from the income and expense series:
+	accountBalances map[string]float64
+}
 
-		// Build the map from each newly generated date:
-		b.dailyResample[earliestDate.AddDate(0, 0, i)] = Row{}
+// resampleAccounts builds the closing balance of each account as of the last transaction, counting the opening
+// balances dated up to then.
+func (b *BudgetStatement) resampleAccounts(transactions []Transaction) {
+	var lastDate time.Time
+	for _, transaction := range transactions {
+		if transaction.Date.After(lastDate) {
+			lastDate = transaction.Date
+		}
 	}
 
-	fmt.Printf("First Day: %s,\nLast Date: %s\n", earliestDate, lastDate)
-	fmt.Printf("Number of Hours between these two dates: %d\n", numDaysBetweenDates)
-
-	// Step 2: Iterating through the primary date time index and updating the associated date in the new map.
-	for i, v := range b.dateTimeIndex {
-
-		var oldIncomeVal, oldExpenseVal float64 = b.dailyResample[v].income, b.dailyResample[v].expenses
+	for account, balance := range b.startingBalances {
+		b.accountBalances[account] += balance
+	}
+	for account, opening := range b.openings {
+		if !opening.Date.After(lastDate) {
+			b.accountBalances[account] += opening.Balance
+		}
+	}
+	for i, transaction := range transactions {
+		b.accountBalances[transaction.Account] += b.balanceTimeseries[i]
+	}
+}
 
-		b.dailyResample[v] = Row{
-			income:   oldIncomeVal + b.incomeTimeseries[i],
-			expenses: oldExpenseVal + b.expenseTimeseries[i]}
+func (b *BudgetStatement) resampleCategories(transactions []Transaction) {
+	for _, transaction := range transactions {
+		if transaction.IsTransfer {
+			continue
+		}
+		for _, line := range transaction.CategoryLines() {
+			total := b.categoryTotals[line.Category]
+			b.categoryTotals[line.Category] = Row{
+				income:   total.income + line.Income,
+				expenses: total.expenses + line.Expenses,
+			}
+			b.categoryLineCounts[line.Category]++
+		}
 	}
+}
 
-	// Resorting the resampled index after incorporating resampling the income and expense data:
-	sortedIndex := []time.Time{}
+// resampleTimeseries sums the income and expense timeseries into one row per period of the statement's frequency.
+// Every period between the first and the last transaction gets a row, even when nothing happened in it, and the
+// balance is the actual balance of the accounts at the end of each period: the starting balances, plus every opening
+// balance dated up to the end of the period, plus the flow of every transaction counted towards the balance.
+func (b *BudgetStatement) resampleTimeseries() {
 
-	for i := range b.dailyResample {
-		sortedIndex = append(sortedIndex, i)
+	// A date range with no transactions in it has nothing to resample:
+	if len(b.dateTimeIndex) == 0 {
+		return
 	}
 
-	sort.Slice(sortedIndex, func(i, j int) bool {
-		return sortedIndex[i].Before(sortedIndex[j])
-	})
+	// Step 1: Generate every period between the periods of the earliest and the latest transaction. The index is not
+	// guaranteed to be in any order so the range is taken from the extremes:
+	var earliestDate, lastDate time.Time = b.dateTimeIndex[0], b.dateTimeIndex[0]
+	for _, date := range b.dateTimeIndex {
+		if date.Before(earliestDate) {
+			earliestDate = date
+		}
+		if date.After(lastDate) {
+			lastDate = date
+		}
+	}
 
-	// Now we rebuild the new, sorted index and calculates the balance based on income and expense:
-	resortedResampleMap := map[time.Time]Row{}
-	currentBalance := 0.0
+	resampled := make(map[time.Time]Row)
+	periods := []time.Time{}
+	for period := b.frequency.PeriodStart(earliestDate); !period.After(lastDate); period = b.frequency.NextPeriod(period) {
+		periods = append(periods, period)
+		resampled[period] = Row{}
+	}
 
-	for _, v := range sortedIndex {
+	// Step 2: Adding every transaction to the period it falls in. The balance of a row is the flow within the
+	// period until step 3:
+	for i, v := range b.dateTimeIndex {
+		period := b.frequency.PeriodStart(v)
 
-		changeInBalance := b.dailyResample[v].income - b.dailyResample[v].expenses
-		currentBalance = currentBalance + changeInBalance
+		resampled[period] = Row{
+			income:   resampled[period].income + b.incomeTimeseries[i],
+			expenses: resampled[period].expenses + b.expenseTimeseries[i],
+			balance:  resampled[period].balance + b.balanceTimeseries[i]}
+	}
 
-		resortedResampleMap[v] = Row{
-			income:   b.dailyResample[v].income,
-			expenses: b.dailyResample[v].expenses,
-			balance:  currentBalance,
+	currentBalance := 0.0
+	for _, balance := range b.startingBalances {
+		currentBalance += balance
+	}
+	for _, opening := range b.openings {
+		period := b.frequency.PeriodStart(opening.Date)
+		if period.Before(periods[0]) {
+			currentBalance += opening.Balance
+		} else if row, ok := resampled[period]; ok {
+			row.balance += opening.Balance
+			resampled[period] = row
 		}
+	}
 
+	// Step 3: Periods were generated in order so the series and its running balance are built by walking them:
+	for _, period := range periods {
+		row := resampled[period]
+		currentBalance += row.balance
+
+		b.series = append(b.series, SeriesPoint{
+			PeriodStart: period,
+			Label:       b.frequency.Label(period),
+			Income:      row.income,
+			Expenses:    row.expenses,
+			Net:         row.income - row.expenses,
+			Balance:     currentBalance,
+		})
 	}
+}
 
-	b.dailyResample = resortedResampleMap
+// Series returns the resampled timeseries, one point per period in date order.
+func (b BudgetStatement) Series() Series {
+	return b.series
 }
 
 func LoadBudgetFromCSV(transactions []Transaction) (currentBudgetStatemen BudgetStatement, err error) {
+	return LoadBudgetAtFrequency(transactions, FrequencyDay)
+}
+
+// LoadBudgetAtFrequency builds a budget statement with its timeseries resampled into periods of the given frequency.
+func LoadBudgetAtFrequency(transactions []Transaction, frequency Frequency) (currentBudgetStatemen BudgetStatement, err error) {
+	return LoadBudgetWithBalances(transactions, frequency, OpeningBalances{}, map[string]float64{})
+}
+
+// LoadBudgetWithBalances builds a budget statement whose running balance starts from the balance of each account
+// before the first transaction and includes the opening balance of each account.
+func LoadBudgetWithBalances(transactions []Transaction, frequency Frequency, openings OpeningBalances, startingBalances map[string]float64) (currentBudgetStatemen BudgetStatement, err error) {
 
 	// Appending each date time string to array:
 	var dateTimeIndex = []time.Time{}
 	var expensesTimeseries = []float64{}
 	var incomeTimeseries = []float64{}
+	var balanceTimeseries = []float64{}
 
 	for i := 0; i < len(transactions); i++ {
 
 		currentTransaction := transactions[i]
 
 		dateTimeIndex = append(dateTimeIndex, currentTransaction.Date)
+		balanceTimeseries = append(balanceTimeseries, openings.balanceFlow(currentTransaction))
+
+		// Transfers between our own accounts are neither income nor an expense. Both sides still move the balance of
+		// their own account:
+		if currentTransaction.IsTransfer {
+			expensesTimeseries = append(expensesTimeseries, 0.0)
+			incomeTimeseries = append(incomeTimeseries, 0.0)
+			continue
+		}
+
 		expensesTimeseries = append(expensesTimeseries, float64(currentTransaction.Debit))
 		incomeTimeseries = append(incomeTimeseries, float64(currentTransaction.Credit))
 
 	}
 
 	currentBudgetStatement := BudgetStatement{
-		dateTimeIndex:     dateTimeIndex,
-		expenseTimeseries: expensesTimeseries,
-		incomeTimeseries:  incomeTimeseries,
-		dailyResample:     make(map[time.Time]Row),
+		dateTimeIndex:      dateTimeIndex,
+		expenseTimeseries:  expensesTimeseries,
+		incomeTimeseries:   incomeTimeseries,
+		balanceTimeseries:  balanceTimeseries,
+		startingBalances:   startingBalances,
+		openings:           openings,
+		frequency:          frequency,
+		series:             Series{},
+		categoryTotals:     make(map[string]Row),
+		categoryLineCounts: make(map[string]int),
+		accountBalances:    make(map[string]float64),
 	}
 
-	currentBudgetStatement.resampleTimeseriesDaily()
+	currentBudgetStatement.resampleTimeseries()
+	currentBudgetStatement.resampleTrends()
+	currentBudgetStatement.resampleCategories(transactions)
+	currentBudgetStatement.resampleAccounts(transactions)
 
 	return currentBudgetStatement, nil
 
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	minForecastMonths = 3
+	maxForecastMonths = 12
+
+	// Discretionary spending is averaged over this many days before the latest transaction:
+	forecastLookbackDays = 90
+
+	// The confidence band covers roughly 80% of outcomes if the monthly discretionary spend is normally distributed:
+	forecastBandZ = 1.28
+
+	daysPerMonth = 365.25 / 12
+)
+
+// ForecastOptions are the dashboard's forecast settings. A forecast is only drawn when Months is set.
+type ForecastOptions struct {
+	Months int
+	Band   bool
+}
+
+// parseForecastOptions reads the optional forecast (a number of months) and band query parameters.
+func parseForecastOptions(r *http.Request) (options ForecastOptions, err error) {
+	params := r.URL.Query()
+
+	if rawMonths := params.Get("forecast"); rawMonths != "" && rawMonths != "0" {
+		options.Months, err = strconv.Atoi(rawMonths)
+		if err != nil || options.Months < minForecastMonths || options.Months > maxForecastMonths {
+			return options, fmt.Errorf("the forecast must be between %d and %d months", minForecastMonths, maxForecastMonths)
+		}
+	}
+	options.Band = params.Get("band") != ""
+
+	return options, nil
+}
+
+// DiscretionarySpend is the average monthly spend of a category that is not part of a recurring charge.
+type DiscretionarySpend struct {
+	Category       string
+	MonthlyAverage float64
+}
+
+// Forecast projects the balance forward from the latest transaction. The first point is the period of the latest
+// transaction so the forecast line joins the end of the historical balance.
+type Forecast struct {
+	Points Series `json:"points"`
+
+	// Bounds of the confidence band for each point:
+	Lower []float64 `json:"lower"`
+	Upper []float64 `json:"upper"`
+
+	Discretionary []DiscretionarySpend `json:"-"`
+}
+
+func (f Forecast) roundedToCents() Forecast {
+	f.Points = f.Points.roundedToCents()
+	f.Lower = roundedToCents(f.Lower)
+	f.Upper = roundedToCents(f.Upper)
+	return f
+}
+
+// discretionarySpending averages the spending of each category over the lookback window, leaving out transfers and
+// the payees of recurring charges as those are forecast on their own dates. It also returns the standard deviation
+// of the total spend of each month-long slice of the window.
+func discretionarySpending(transactions []Transaction, recurringPayees map[string]bool, asOf time.Time) (spending []DiscretionarySpend, monthlyDeviation float64) {
+	start := asOf.AddDate(0, 0, -forecastLookbackDays)
+
+	// A short history is averaged over the days it covers:
+	windowDays := float64(forecastLookbackDays)
+	earliest := asOf
+	for _, transaction := range transactions {
+		if transaction.Date.Before(earliest) {
+			earliest = transaction.Date
+		}
+	}
+	if earliest.After(start) {
+		windowDays = math.Max(1, asOf.Sub(earliest).Hours()/24+1)
+	}
+
+	totals := make(map[string]float64)
+	slices := make([]float64, int(math.Max(1, math.Round(windowDays/daysPerMonth))))
+	for _, transaction := range transactions {
+		if transaction.IsTransfer || !transaction.Date.After(start) || transaction.Date.After(asOf) {
+			continue
+		}
+		if recurringPayees[recurringKey(transaction)] {
+			continue
+		}
+
+		spent := 0.0
+		for _, line := range transaction.CategoryLines() {
+			totals[line.Category] += line.Expenses
+			spent += line.Expenses
+		}
+
+		slice := int(asOf.Sub(transaction.Date).Hours() / 24 / daysPerMonth)
+		if slice < len(slices) {
+			slices[slice] += spent
+		}
+	}
+
+	for category, total := range totals {
+		if total > 0 {
+			spending = append(spending, DiscretionarySpend{Category: category, MonthlyAverage: total / windowDays * daysPerMonth})
+		}
+	}
+	sort.Slice(spending, func(i, j int) bool {
+		return spending[i].MonthlyAverage > spending[j].MonthlyAverage
+	})
+
+	if len(slices) > 1 {
+		mean := 0.0
+		for _, total := range slices {
+			mean += total
+		}
+		mean /= float64(len(slices))
+		for _, total := range slices {
+			monthlyDeviation += (total - mean) * (total - mean)
+		}
+		monthlyDeviation = math.Sqrt(monthlyDeviation / float64(len(slices)-1))
+	}
+
+	return spending, monthlyDeviation
+}
+
+// BuildForecast projects the balance from openingBalance on asOf, the date of the latest transaction, forward by the
+// given number of months. Recurring charges and income that have not stopped are forecast on their expected dates at
+// their latest amount, scheduled transactions on their own dates, and the average discretionary spend is spread
+// evenly over every day. The confidence band widens with the square root of the months ahead.
+func BuildForecast(transactions []Transaction, scheduled []ScheduledTransaction, openingBalance float64, asOf time.Time, months int, frequency Frequency) Forecast {
+	// A forecast from the 31st ends on the last day of a shorter month rather than spilling into the month after:
+	end := addMonthsClamped(asOf, months)
+	income := make(map[time.Time]float64)
+	expenses := make(map[time.Time]float64)
+
+	recurring := append(DetectRecurringCharges(transactions, asOf), DetectRecurringIncome(transactions, asOf)...)
+	recurringPayees := make(map[string]bool)
+	for _, charge := range recurring {
+		recurringPayees[charge.Payee] = true
+		if charge.Stopped {
+			continue
+		}
+
+		for n := 1; !charge.Cadence.after(charge.LastDate, n).After(end); n++ {
+			date := charge.Cadence.after(charge.LastDate, n)
+			// A charge that is a few days late but has not stopped is expected straight away:
+			day := date
+			if !day.After(asOf) {
+				day = asOf.AddDate(0, 0, 1)
+			}
+			if charge.Income {
+				income[day] += charge.LastAmount
+			} else {
+				expenses[day] += charge.LastAmount
+			}
+		}
+	}
+
+	for _, entry := range scheduled {
+		if entry.Date.After(asOf) && !entry.Date.After(end) {
+			income[entry.Date] += entry.Credit
+			expenses[entry.Date] += entry.Debit
+		}
+	}
+
+	spending, monthlyDeviation := discretionarySpending(transactions, recurringPayees, asOf)
+	dailySpend := 0.0
+	for _, category := range spending {
+		dailySpend += category.MonthlyAverage / daysPerMonth
+	}
+
+	forecast := Forecast{Discretionary: spending}
+	firstPeriod := frequency.PeriodStart(asOf)
+	forecast.Points = Series{{
+		PeriodStart: firstPeriod,
+		Label:       frequency.Label(firstPeriod),
+		Balance:     openingBalance,
+	}}
+	forecast.Lower = []float64{openingBalance}
+	forecast.Upper = []float64{openingBalance}
+
+	balance := openingBalance
+	for day := asOf.AddDate(0, 0, 1); !day.After(end); day = day.AddDate(0, 0, 1) {
+		period := frequency.PeriodStart(day)
+		last := &forecast.Points[len(forecast.Points)-1]
+		if !period.Equal(last.PeriodStart) {
+			forecast.Points = append(forecast.Points, SeriesPoint{PeriodStart: period, Label: frequency.Label(period)})
+			forecast.Lower = append(forecast.Lower, 0)
+			forecast.Upper = append(forecast.Upper, 0)
+			last = &forecast.Points[len(forecast.Points)-1]
+		}
+
+		dayIncome, dayExpenses := income[day], expenses[day]+dailySpend
+		balance += dayIncome - dayExpenses
+
+		// The first point keeps the historical income and expenses of its period out of the forecast:
+		if len(forecast.Points) > 1 {
+			last.Income += dayIncome
+			last.Expenses += dayExpenses
+			last.Net = last.Income - last.Expenses
+		}
+		last.Balance = balance
+
+		spread := forecastBandZ * monthlyDeviation * math.Sqrt(day.Sub(asOf).Hours()/24/daysPerMonth)
+		forecast.Lower[len(forecast.Lower)-1] = balance - spread
+		forecast.Upper[len(forecast.Upper)-1] = balance + spread
+	}
+
+	// The first point is where the forecast joins the history, so it stays at the historical balance:
+	forecast.Points[0].Balance = openingBalance
+	forecast.Lower[0], forecast.Upper[0] = openingBalance, openingBalance
+
+	return forecast
+}
+
+// buildForecast projects the balance at the end of the series forward from the latest transaction.
+func (h *storeHandlers) buildForecast(series Series, frequency Frequency, options ForecastOptions) (Forecast, error) {
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		return Forecast{}, err
+	}
+	scheduled, err := h.scheduled.ReadScheduledTransactions()
+	if err != nil {
+		return Forecast{}, err
+	}
+
+	var asOf time.Time
+	for _, transaction := range transactions {
+		if transaction.Date.After(asOf) {
+			asOf = transaction.Date
+		}
+	}
+
+	return BuildForecast(transactions, scheduled, series[len(series)-1].Balance, asOf, options.Months, frequency), nil
+}
+
+// withForecast extends the chart with the forecast balance, and the confidence band when asked for. The forecast
+// datasets are blank over the history apart from the last period, where they join the historical balance.
+func (c chartSeries) withForecast(forecast Forecast, band bool) chartSeries {
+	forecast = forecast.roundedToCents()
+	history := len(c.Labels) - 1
+	c.Forecast = make([]*float64, history)
+	if band {
+		c.Lower = make([]*float64, history)
+		c.Upper = make([]*float64, history)
+	}
+
+	for i, point := range forecast.Points {
+		point := point
+		if i > 0 {
+			c.Labels = append(c.Labels, point.Label)
+		}
+		c.Forecast = append(c.Forecast, &point.Balance)
+		if band {
+			c.Lower = append(c.Lower, &forecast.Lower[i])
+			c.Upper = append(c.Upper, &forecast.Upper[i])
+		}
+	}
+
+	return c
+}
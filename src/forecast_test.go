@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testSalary returns a credit from the same payer for every date.
+func testSalary(description string, amount float32, dates ...string) []Transaction {
+	salary := []Transaction{}
+	for i, date := range dates {
+		transaction := testTransaction(fmt.Sprintf("%s-%d", description, i), date, description, 0, "Checking")
+		transaction.Credit = amount
+		salary = append(salary, transaction)
+	}
+	return salary
+}
+
+func TestBuildForecast(t *testing.T) {
+	subscription := testCharges("SPOTIFY", []string{"2023-01-01", "2023-02-01", "2023-03-01"}, 10, 10, 10)
+
+	// 900 of groceries over the 90 days before the end of March, 200, 300 and 400 in its month-long slices:
+	groceries := []Transaction{
+		testTransaction("old", "2022-06-01", "CORNER SHOP", 50, "Checking"),
+		testTransaction("jan", "2023-01-15", "SUPERMARKET", 200, "Checking"),
+		testTransaction("feb", "2023-02-15", "FARMERS MARKET", 300, "Checking"),
+		testTransaction("mar", "2023-03-15", "GROCER", 400, "Checking"),
+	}
+	for i := range groceries {
+		groceries[i].Category = "Groceries"
+	}
+
+	tests := []struct {
+		name         string
+		transactions []Transaction
+		scheduled    []ScheduledTransaction
+		asOf         string
+		months       int
+
+		labels       []string
+		balances     []float64
+		lower, upper []float64
+	}{
+		{
+			name:         "recurring charges and income",
+			transactions: append(testSalary("ACME PAYROLL", 3000, "2023-01-25", "2023-02-25", "2023-03-25"), subscription...),
+			asOf:         "2023-03-25",
+			months:       3,
+			labels:       []string{"2023-03", "2023-04", "2023-05", "2023-06"},
+			balances:     []float64{1000, 3990, 6980, 9970},
+			lower:        []float64{1000, 3990, 6980, 9970},
+			upper:        []float64{1000, 3990, 6980, 9970},
+		},
+		{
+			name:         "late charge",
+			transactions: subscription,
+			asOf:         "2023-04-05",
+			months:       3,
+			labels:       []string{"2023-04", "2023-05", "2023-06", "2023-07"},
+			// The charge of the 1st of April is expected the day after the latest transaction, in April:
+			balances: []float64{1000, 980, 970, 960},
+			lower:    []float64{1000, 980, 970, 960},
+			upper:    []float64{1000, 980, 970, 960},
+		},
+		{
+			name:         "stopped charge",
+			transactions: subscription,
+			asOf:         "2023-05-01",
+			months:       3,
+			labels:       []string{"2023-05", "2023-06", "2023-07", "2023-08"},
+			balances:     []float64{1000, 1000, 1000, 1000},
+			lower:        []float64{1000, 1000, 1000, 1000},
+			upper:        []float64{1000, 1000, 1000, 1000},
+		},
+		{
+			name: "scheduled transactions",
+			scheduled: []ScheduledTransaction{
+				{Date: testDate("2023-03-01"), Credit: 100},
+				{Date: testDate("2023-04-15"), Credit: 500},
+				{Date: testDate("2023-05-20"), Debit: 250},
+				{Date: testDate("2023-07-01"), Debit: 100},
+			},
+			asOf:     "2023-03-31",
+			months:   3,
+			labels:   []string{"2023-03", "2023-04", "2023-05", "2023-06"},
+			balances: []float64{1000, 1500, 1250, 1250},
+			lower:    []float64{1000, 1500, 1250, 1250},
+			upper:    []float64{1000, 1500, 1250, 1250},
+		},
+		{
+			name:         "discretionary spending",
+			transactions: groceries,
+			asOf:         "2023-03-31",
+			months:       1,
+			labels:       []string{"2023-03", "2023-04"},
+			balances:     []float64{1000, 700},
+			// 1.28 standard deviations of 100 over 30 days:
+			lower: []float64{1000, 572.92},
+			upper: []float64{1000, 827.08},
+		},
+	}
+
+	for _, test := range tests {
+		forecast := BuildForecast(test.transactions, test.scheduled, 1000, testDate(test.asOf), test.months, FrequencyMonth).roundedToCents()
+
+		labels, balances := []string{}, []float64{}
+		for _, point := range forecast.Points {
+			labels = append(labels, point.Label)
+			balances = append(balances, point.Balance)
+		}
+		if !reflect.DeepEqual(labels, test.labels) {
+			t.Errorf("%s: forecast periods %v, want %v", test.name, labels, test.labels)
+			continue
+		}
+		if !reflect.DeepEqual(balances, test.balances) {
+			t.Errorf("%s: forecast balances %v, want %v", test.name, balances, test.balances)
+		}
+		if !reflect.DeepEqual(forecast.Lower, test.lower) || !reflect.DeepEqual(forecast.Upper, test.upper) {
+			t.Errorf("%s: forecast band %v to %v, want %v to %v", test.name, forecast.Lower, forecast.Upper, test.lower, test.upper)
+		}
+	}
+}
+
+func TestBuildForecastDiscretionary(t *testing.T) {
+	transactions := append(testCharges("SPOTIFY", []string{"2023-01-01", "2023-02-01", "2023-03-01"}, 10, 10, 10),
+		testTransaction("fuel", "2023-03-10", "PETROL STATION", 90, "Checking"))
+	for i := range transactions {
+		transactions[i].Category = "Transport"
+	}
+	transfer := testTransaction("transfer", "2023-03-12", "TO SAVINGS", 500, "Checking")
+	transfer.IsTransfer = true
+	transactions = append(transactions, transfer)
+
+	// The subscription and the transfer are left out, the fuel is averaged over the 90 days:
+	forecast := BuildForecast(transactions, nil, 1000, testDate("2023-03-31"), 3, FrequencyMonth)
+	want := []DiscretionarySpend{{Category: "Transport", MonthlyAverage: 90.0 / forecastLookbackDays * daysPerMonth}}
+	if !reflect.DeepEqual(forecast.Discretionary, want) {
+		t.Errorf("discretionary spending %+v, want %+v", forecast.Discretionary, want)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The pace of a goal is the average monthly contribution over this many days before the latest transaction:
+const goalPaceDays = 90
+
+// SavingsGoal is an amount to save by a target date. Progress is either the balance of the linked account, or the
+// money put into the linked category: the debits of the category less its credits, transfers included, as savings
+// are usually moved between our own accounts.
+type SavingsGoal struct {
+	UniqueId     int
+	Name         string
+	TargetAmount float64
+	TargetDate   time.Time
+	Account      string
+	Category     string
+}
+
+// Link describes where the goal's progress comes from.
+func (g SavingsGoal) Link() string {
+	if g.Account != "" {
+		return "Balance of " + g.Account
+	}
+	return "Saved to " + g.Category
+}
+
+func describeSavingsGoal(goal SavingsGoal) string {
+	return fmt.Sprintf("%s %.2f by %s from %s", goal.Name, goal.TargetAmount, goal.TargetDate.Format("2006-01-02"), goal.Link())
+}
+
+// GoalProgress is how far along a goal is as of the latest transaction, and whether it will be reached in time at
+// its recent pace.
+type GoalProgress struct {
+	Goal  SavingsGoal
+	AsOf  time.Time
+	Saved float64
+
+	// MonthlyPace is the average monthly contribution over the recent past, MonthlyNeeded what is needed from now on
+	// to reach the target by its date:
+	MonthlyPace   float64
+	MonthlyNeeded float64
+
+	// ProjectedDate is when the target is reached at the current pace, unset when the pace is not positive:
+	ProjectedDate *time.Time
+}
+
+func (p GoalProgress) Remaining() float64 {
+	return math.Max(0, p.Goal.TargetAmount-p.Saved)
+}
+
+func (p GoalProgress) Reached() bool {
+	return toCents(p.Remaining()) == 0
+}
+
+// Percent is the share of the target saved so far, capped at 100 for the progress bar.
+func (p GoalProgress) Percent() float64 {
+	if p.Goal.TargetAmount <= 0 {
+		return 100
+	}
+	return math.Max(0, math.Min(100, p.Saved/p.Goal.TargetAmount*100))
+}
+
+// OnTrack reports whether the goal is reached by its target date at the current pace.
+func (p GoalProgress) OnTrack() bool {
+	return p.Reached() || (p.ProjectedDate != nil && !p.ProjectedDate.After(p.Goal.TargetDate))
+}
+
+func (p GoalProgress) Overdue() bool {
+	return !p.Reached() && p.AsOf.After(p.Goal.TargetDate)
+}
+
+// goalContribution is how much a transaction adds to a goal.
+func goalContribution(goal SavingsGoal, transaction Transaction, openings OpeningBalances) float64 {
+	if goal.Account != "" {
+		if transaction.Account != goal.Account {
+			return 0.0
+		}
+		return openings.balanceFlow(transaction)
+	}
+
+	contribution := 0.0
+	for _, line := range transaction.CategoryLines() {
+		if line.Category == goal.Category {
+			contribution += line.Expenses - line.Income
+		}
+	}
+	return contribution
+}
+
+// BuildGoalProgress works out the progress of a goal from every transaction up to asOf. An account's balance includes
+// its opening balance.
+func BuildGoalProgress(goal SavingsGoal, transactions []Transaction, openings OpeningBalances, asOf time.Time) GoalProgress {
+	progress := GoalProgress{Goal: goal, AsOf: asOf}
+	if opening, ok := openings[goal.Account]; ok && goal.Account != "" && !opening.Date.After(asOf) {
+		progress.Saved += opening.Balance
+	}
+
+	paceStart := asOf.AddDate(0, 0, -goalPaceDays)
+	earliest := asOf
+	recent := 0.0
+	for _, transaction := range transactions {
+		if transaction.Date.After(asOf) {
+			continue
+		}
+		contribution := goalContribution(goal, transaction, openings)
+		progress.Saved += contribution
+		if contribution != 0 && transaction.Date.Before(earliest) {
+			earliest = transaction.Date
+		}
+		if transaction.Date.After(paceStart) {
+			recent += contribution
+		}
+	}
+
+	// A goal with a shorter history is paced over the days it covers:
+	paceDays := float64(goalPaceDays)
+	if earliest.After(paceStart) {
+		paceDays = math.Max(1, asOf.Sub(earliest).Hours()/24+1)
+	}
+	progress.MonthlyPace = recent / paceDays * daysPerMonth
+
+	// Whatever is left is needed straight away once the target date has passed:
+	monthsLeft := math.Max(1, goal.TargetDate.Sub(asOf).Hours()/24/daysPerMonth)
+	progress.MonthlyNeeded = progress.Remaining() / monthsLeft
+
+	if !progress.Reached() && progress.MonthlyPace > 0 {
+		projected := asOf.AddDate(0, 0, int(math.Ceil(progress.Remaining()/progress.MonthlyPace*daysPerMonth)))
+		progress.ProjectedDate = &projected
+	}
+
+	return progress
+}
+
+func ReadSavingsGoals(db *sql.DB) (goals []SavingsGoal, err error) {
+	rows, err := db.Query("SELECT unique_id, name, target_amount, target_date, account, category FROM savings_goals ORDER BY target_date, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var goal SavingsGoal
+		var targetDate string
+		err := rows.Scan(&goal.UniqueId, &goal.Name, &goal.TargetAmount, &targetDate, &goal.Account, &goal.Category)
+		if err != nil {
+			return nil, err
+		}
+		goal.TargetDate, err = time.Parse("2006-01-02", targetDate)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+
+	return goals, rows.Err()
+}
+
+func AddSavingsGoal(db *sql.DB, goal SavingsGoal, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("INSERT INTO savings_goals(name, target_amount, target_date, account, category) values(?, ?, ?, ?, ?)",
+		goal.Name, goal.TargetAmount, goal.TargetDate.Format("2006-01-02"), goal.Account, goal.Category)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	goalId, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityGoal,
+		EntityId: strconv.FormatInt(goalId, 10),
+		Field:    "*",
+		NewValue: describeSavingsGoal(goal),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteSavingsGoal removes a goal, returning sql.ErrNoRows when it does not exist.
+func DeleteSavingsGoal(db *sql.DB, goalId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var goal SavingsGoal
+	var targetDate string
+	err = tx.QueryRow("SELECT name, target_amount, target_date, account, category FROM savings_goals WHERE unique_id = ?", goalId).Scan(
+		&goal.Name, &goal.TargetAmount, &targetDate, &goal.Account, &goal.Category)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	goal.TargetDate, _ = time.Parse("2006-01-02", targetDate)
+
+	_, err = tx.Exec("DELETE FROM savings_goals WHERE unique_id = ?", goalId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityGoal,
+		EntityId: strconv.Itoa(goalId),
+		Field:    "*",
+		OldValue: describeSavingsGoal(goal),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func parseSavingsGoalForm(r *http.Request) (goal SavingsGoal, err error) {
+	goal.Name = strings.TrimSpace(r.FormValue("name"))
+	if goal.Name == "" {
+		return goal, fmt.Errorf("a goal needs a name")
+	}
+
+	rawAmount := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(r.FormValue("target_amount")), "$"))
+	goal.TargetAmount, err = strconv.ParseFloat(rawAmount, 64)
+	if err != nil || goal.TargetAmount <= 0 {
+		return goal, fmt.Errorf("the target amount must be a positive amount")
+	}
+
+	goal.TargetDate, err = time.Parse("2006-01-02", strings.TrimSpace(r.FormValue("target_date")))
+	if err != nil {
+		return goal, fmt.Errorf("the target date must be in the format YYYY-MM-DD")
+	}
+
+	goal.Account = strings.TrimSpace(r.FormValue("account"))
+	goal.Category = strings.TrimSpace(r.FormValue("category"))
+	if (goal.Account == "") == (goal.Category == "") {
+		return goal, fmt.Errorf("link the goal to either an account or a category")
+	}
+
+	return goal, nil
+}
+
+// goalProgress builds the progress of every goal as of the latest transaction.
+func (h *storeHandlers) goalProgress() ([]GoalProgress, error) {
+	goals, err := h.goals.ReadSavingsGoals()
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := h.balances.ReadAccountBalances()
+	if err != nil {
+		return nil, err
+	}
+	openings := openingBalances(balances)
+
+	asOf := dayIndex(time.Now())
+	if len(transactions) > 0 {
+		asOf = transactions[0].Date
+		for _, transaction := range transactions {
+			if transaction.Date.After(asOf) {
+				asOf = transaction.Date
+			}
+		}
+	}
+
+	progress := []GoalProgress{}
+	for _, goal := range goals {
+		progress = append(progress, BuildGoalProgress(goal, transactions, openings, asOf))
+	}
+	return progress, nil
+}
+
+type goalsPageContent struct {
+	Goals      []GoalProgress
+	Accounts   []string
+	Categories []string
+	Error      string
+}
+
+func (h *storeHandlers) renderGoals(w http.ResponseWriter, templatePath string, templateName string, content goalsPageContent) {
+	progress, err := h.goalProgress()
+	if err != nil {
+		log.Println("Unable to work out the progress of the goals:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content.Goals = progress
+
+	// The accounts and categories offered when linking a goal:
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		log.Println("Unable to extract all transactions from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accounts, categories := make(map[string]bool), make(map[string]bool)
+	for _, transaction := range transactions {
+		accounts[transaction.Account] = true
+		for _, line := range transaction.CategoryLines() {
+			categories[line.Category] = true
+		}
+	}
+	for account := range accounts {
+		content.Accounts = append(content.Accounts, account)
+	}
+	for category := range categories {
+		content.Categories = append(content.Categories, category)
+	}
+	sort.Strings(content.Accounts)
+	sort.Strings(content.Categories)
+
+	tmpl, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Fatal("Unable to load the goals template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, content)
+	if err != nil {
+		log.Println("Unable to render the goals template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// goalsHandler lists, adds and removes the savings goals.
+func (h *storeHandlers) goalsHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.renderGoals(w, "../templates/goals.html", "goals.html", goalsPageContent{})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := goalsPageContent{}
+	switch r.FormValue("action") {
+	case "add":
+		goal, err := parseSavingsGoalForm(r)
+		if err != nil {
+			content.Error = err.Error()
+			break
+		}
+
+		err = h.goals.AddSavingsGoal(goal, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to insert the savings goal:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "delete":
+		goalId, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		err = h.goals.DeleteSavingsGoal(goalId, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to delete the savings goal:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	h.renderGoals(w, "../templates/goals.html", "goalContent", content)
+}
+
+// goalCardsHandler renders the goal cards on the dashboard.
+func (h *storeHandlers) goalCardsHandler(w http.ResponseWriter, r *http.Request) {
+	h.renderGoals(w, "../templates/index.html", "goalCards", goalsPageContent{})
+}
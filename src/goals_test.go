@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBuildGoalProgress(t *testing.T) {
+	savings := func(id string, date string, credit float32, debit float32) Transaction {
+		transaction := testTransaction(id, date, "TRANSFER", debit, "Savings")
+		transaction.Credit = credit
+		transaction.IsTransfer = true
+		return transaction
+	}
+	holiday := func(id string, date string, debit float32, credit float32) Transaction {
+		transaction := testTransaction(id, date, "TRAVEL FUND", debit, "Checking")
+		transaction.Credit = credit
+		transaction.Category = "Holiday"
+		return transaction
+	}
+
+	// A split line counts towards the goal's category, the rest of the transaction does not:
+	split := testTransaction("split", "2023-03-01", "TRAVEL AGENT", 150, "Checking")
+	split.Splits = []TransactionSplit{{Category: "Holiday", Amount: 100}, {Category: "Dining", Amount: 50}}
+
+	transactions := []Transaction{
+		// Already included in the opening balance of the savings account:
+		savings("before-opening", "2022-12-20", 500, 0),
+		savings("savings-1", "2023-01-15", 300, 0),
+		savings("savings-2", "2023-02-15", 300, 0),
+		savings("savings-3", "2023-03-15", 300, 0),
+		testTransaction("checking", "2023-03-20", "SUPERMARKET", 80, "Checking"),
+		savings("after", "2023-04-15", 300, 0),
+		holiday("holiday-1", "2022-10-10", 200, 0),
+		holiday("holiday-2", "2023-02-10", 200, 0),
+		split,
+		// Taking money out of the category takes it off the goal:
+		holiday("withdrawal", "2023-03-20", 0, 50),
+	}
+	openings := OpeningBalances{"Savings": {Account: "Savings", Date: testDate("2023-01-01"), Balance: 1000, Kind: balanceKindOpening}}
+
+	tests := []struct {
+		name string
+		goal SavingsGoal
+		asOf string
+
+		saved, pace, needed float64
+		projected           string
+		onTrack, overdue    bool
+	}{
+		{
+			// Paced over the 76 days since the first contribution:
+			name:      "account balance",
+			goal:      SavingsGoal{Account: "Savings", TargetAmount: 5000, TargetDate: testDate("2023-12-31")},
+			asOf:      "2023-03-31",
+			saved:     1900,
+			pace:      360.44,
+			needed:    343.11,
+			projected: "2023-12-18",
+			onTrack:   true,
+		},
+		{
+			// Paced over the full 90 days, October's contribution is before them:
+			name:      "category",
+			goal:      SavingsGoal{Category: "Holiday", TargetAmount: 1000, TargetDate: testDate("2023-04-30")},
+			asOf:      "2023-03-31",
+			saved:     450,
+			pace:      84.55,
+			needed:    550,
+			projected: "2023-10-15",
+		},
+		{
+			name:    "reached",
+			goal:    SavingsGoal{Account: "Savings", TargetAmount: 1500, TargetDate: testDate("2023-12-31")},
+			asOf:    "2023-03-31",
+			saved:   1900,
+			pace:    360.44,
+			onTrack: true,
+		},
+		{
+			// Everything that is left is needed straight away:
+			name:      "overdue",
+			goal:      SavingsGoal{Account: "Savings", TargetAmount: 5000, TargetDate: testDate("2023-03-01")},
+			asOf:      "2023-03-31",
+			saved:     1900,
+			pace:      360.44,
+			needed:    3100,
+			projected: "2023-12-18",
+			overdue:   true,
+		},
+		{
+			name:   "no contributions yet",
+			goal:   SavingsGoal{Category: "Car", TargetAmount: 1200, TargetDate: testDate("2023-12-31")},
+			asOf:   "2023-03-31",
+			needed: 132.82,
+		},
+	}
+
+	round := func(amount float64) float64 {
+		return math.Round(amount*100) / 100
+	}
+	for _, test := range tests {
+		progress := BuildGoalProgress(test.goal, transactions, openings, testDate(test.asOf))
+
+		projected := ""
+		if progress.ProjectedDate != nil {
+			projected = progress.ProjectedDate.Format("2006-01-02")
+		}
+		if round(progress.Saved) != test.saved || round(progress.MonthlyPace) != test.pace || round(progress.MonthlyNeeded) != test.needed {
+			t.Errorf("%s: saved %.2f at %.2f a month needing %.2f, want %.2f at %.2f needing %.2f", test.name, progress.Saved,
+				progress.MonthlyPace, progress.MonthlyNeeded, test.saved, test.pace, test.needed)
+		}
+		if projected != test.projected || progress.OnTrack() != test.onTrack || progress.Overdue() != test.overdue {
+			t.Errorf("%s: projected %q, on track %t and overdue %t, want %q, %t and %t", test.name, projected,
+				progress.OnTrack(), progress.Overdue(), test.projected, test.onTrack, test.overdue)
+		}
+	}
+}
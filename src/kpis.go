@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	kpiUnitMoney   = "money"
+	kpiUnitPercent = "percent"
+	kpiUnitDays    = "days"
+)
+
+// KPI is one statistic of the dashboard's KPI panel for the selected range, with its value over the previous period
+// of the same length when that period has any transactions. Detail names what the value belongs to, e.g. the largest
+// expense category.
+type KPI struct {
+	Label  string
+	Detail string
+	Unit   string
+	Value  float64
+
+	// HasValue is unset when the statistic is undefined for the range, e.g. a savings rate without any income:
+	HasValue bool
+
+	Previous       float64
+	HasPrevious    bool
+	HigherIsBetter bool
+}
+
+func formatKPIValue(value float64, unit string) string {
+	switch unit {
+	case kpiUnitPercent:
+		return fmt.Sprintf("%.1f%%", value)
+	case kpiUnitDays:
+		return fmt.Sprintf("%.0f days", value)
+	default:
+		if value < 0 {
+			return fmt.Sprintf("-$%.2f", -value)
+		}
+		return fmt.Sprintf("$%.2f", value)
+	}
+}
+
+func (k KPI) Display() string {
+	if !k.HasValue {
+		return "n/a"
+	}
+	return formatKPIValue(k.Value, k.Unit)
+}
+
+// Delta is the change against the previous period, in percentage points for percentages.
+func (k KPI) Delta() float64 {
+	return k.Value - k.Previous
+}
+
+func (k KPI) DeltaDisplay() string {
+	sign := "+"
+	if k.Delta() < 0 {
+		sign = "-"
+	}
+	if k.Unit == kpiUnitPercent {
+		return fmt.Sprintf("%s%.1f pts", sign, math.Abs(k.Delta()))
+	}
+	return sign + formatKPIValue(math.Abs(k.Delta()), k.Unit)
+}
+
+// ShowDelta is set when both periods have a value and they differ.
+func (k KPI) ShowDelta() bool {
+	return k.HasValue && k.HasPrevious && math.Abs(k.Delta()) >= 0.005
+}
+
+// Improved reports whether the change against the previous period is a change for the better.
+func (k KPI) Improved() bool {
+	return (k.Delta() > 0) == k.HigherIsBetter
+}
+
+// periodStatistics are the figures of one period that the KPIs are built from.
+type periodStatistics struct {
+	days                    float64
+	income, expenses        float64
+	closingBalance          float64
+	hasBalance              bool
+	largestCategory         string
+	largestCategoryExpenses float64
+	categoryTotals          map[string]Row
+	hasTransactions         bool
+}
+
+func statisticsOf(budget BudgetStatement, from time.Time, to time.Time) (stats periodStatistics) {
+	stats.days = to.Sub(from).Hours()/24 + 1
+
+	series := budget.Series()
+	summary := series.Summary()
+	stats.income, stats.expenses = summary.TotalIncome, summary.TotalExpenses
+	stats.hasTransactions = len(series) > 0
+	if stats.hasTransactions {
+		stats.closingBalance, stats.hasBalance = summary.ClosingBalance, true
+	}
+
+	stats.categoryTotals = budget.categoryTotals
+	for category, row := range budget.categoryTotals {
+		if row.expenses > stats.largestCategoryExpenses ||
+			(row.expenses == stats.largestCategoryExpenses && row.expenses > 0 && category < stats.largestCategory) {
+			stats.largestCategory, stats.largestCategoryExpenses = category, row.expenses
+		}
+	}
+
+	return stats
+}
+
+func (s periodStatistics) categoryExpenses(category string) float64 {
+	return s.categoryTotals[category].expenses
+}
+
+func (s periodStatistics) savingsRate() (float64, bool) {
+	if s.income <= 0 {
+		return 0.0, false
+	}
+	return (s.income - s.expenses) / s.income * 100, true
+}
+
+func (s periodStatistics) monthlySpend() float64 {
+	if s.days <= 0 {
+		return 0.0
+	}
+	return s.expenses / (s.days / daysPerMonth)
+}
+
+// runway is how many days the closing balance lasts at the period's average daily spending.
+func (s periodStatistics) runway() (float64, bool) {
+	if !s.hasBalance || s.expenses <= 0 {
+		return 0.0, false
+	}
+	return math.Max(0, s.closingBalance/(s.expenses/s.days)), true
+}
+
+// BuildKPIs compares the statistics of the selected period with those of the previous period of the same length.
+// Expense growth is itself a comparison with the previous period so it has no delta of its own.
+func BuildKPIs(current periodStatistics, previous periodStatistics) []KPI {
+	kpis := []KPI{}
+
+	savingsRate, hasSavingsRate := current.savingsRate()
+	previousSavingsRate, hasPreviousSavingsRate := previous.savingsRate()
+	kpis = append(kpis, KPI{
+		Label: "Savings Rate", Unit: kpiUnitPercent, HigherIsBetter: true,
+		Value: savingsRate, HasValue: hasSavingsRate,
+		Previous: previousSavingsRate, HasPrevious: hasPreviousSavingsRate,
+	})
+
+	kpis = append(kpis, KPI{
+		Label: "Average Monthly Spend", Unit: kpiUnitMoney,
+		Value: current.monthlySpend(), HasValue: current.hasTransactions,
+		Previous: previous.monthlySpend(), HasPrevious: previous.hasTransactions,
+	})
+
+	// The previous value is the same category's spending, so the delta shows whether it grew:
+	largest := KPI{
+		Label: "Largest Expense Category", Detail: current.largestCategory, Unit: kpiUnitMoney,
+		Value: current.largestCategoryExpenses, HasValue: current.largestCategory != "",
+	}
+	if previous.hasTransactions && largest.HasValue {
+		largest.Previous, largest.HasPrevious = previous.categoryExpenses(current.largestCategory), true
+	}
+	kpis = append(kpis, largest)
+
+	growth := KPI{Label: "Expense Growth", Detail: "vs the previous period", Unit: kpiUnitPercent}
+	if previous.expenses > 0 {
+		growth.Value, growth.HasValue = (current.expenses-previous.expenses)/previous.expenses*100, true
+	}
+	kpis = append(kpis, growth)
+
+	runway, hasRunway := current.runway()
+	previousRunway, hasPreviousRunway := previous.runway()
+	kpis = append(kpis, KPI{
+		Label: "Runway", Detail: "at the current burn rate", Unit: kpiUnitDays, HigherIsBetter: true,
+		Value: runway, HasValue: hasRunway,
+		Previous: previousRunway, HasPrevious: hasPreviousRunway,
+	})
+
+	return kpis
+}
+
+// buildKPIs works out the bounds of the selected period, which is the span of its transactions when the range is
+// open ended, and loads the previous period of the same length to compare it with.
+func (h *storeHandlers) buildKPIs(dateRange TransactionFilter, transactions []Transaction, budget BudgetStatement) ([]KPI, error) {
+	var from, to time.Time
+	for _, transaction := range transactions {
+		if from.IsZero() || transaction.Date.Before(from) {
+			from = transaction.Date
+		}
+		if transaction.Date.After(to) {
+			to = transaction.Date
+		}
+	}
+	if dateRange.From != "" {
+		from, _ = time.Parse("2006-01-02", dateRange.From)
+	}
+	if dateRange.To != "" {
+		to, _ = time.Parse("2006-01-02", dateRange.To)
+	}
+	if from.IsZero() || to.IsZero() {
+		return BuildKPIs(periodStatistics{}, periodStatistics{}), nil
+	}
+	from, to = dayIndex(from), dayIndex(to)
+
+	current := statisticsOf(budget, from, to)
+
+	previousTo := from.AddDate(0, 0, -1)
+	previousFrom := previousTo.AddDate(0, 0, 1-int(math.Round(current.days)))
+	previousRange := TransactionFilter{From: previousFrom.Format("2006-01-02"), To: previousTo.Format("2006-01-02")}
+	previousTransactions, err := h.transactions.ReadTransactionsInRange(previousRange)
+	if err != nil {
+		return nil, err
+	}
+	previousBudget, err := h.loadBudget(previousRange, previousTransactions, FrequencyMonth)
+	if err != nil {
+		return nil, err
+	}
+	previous := statisticsOf(previousBudget, previousFrom, previousTo)
+
+	return BuildKPIs(current, previous), nil
+}
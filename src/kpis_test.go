@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBuildKPIs(t *testing.T) {
+	// Two months of spending in both periods:
+	current := periodStatistics{
+		days: 2 * daysPerMonth, income: 4000, expenses: 3000, closingBalance: 6000, hasBalance: true,
+		largestCategory: "Rent", largestCategoryExpenses: 1500, hasTransactions: true,
+		categoryTotals: map[string]Row{"Rent": {expenses: 1500}, "Groceries": {expenses: 900}, "Dining": {expenses: 600}},
+	}
+	previous := periodStatistics{
+		days: 2 * daysPerMonth, income: 4000, expenses: 2000, closingBalance: 5000, hasBalance: true,
+		largestCategory: "Rent", largestCategoryExpenses: 1200, hasTransactions: true,
+		categoryTotals: map[string]Row{"Rent": {expenses: 1200}, "Groceries": {expenses: 800}},
+	}
+	overdrawn := periodStatistics{
+		days: 10, expenses: 500, closingBalance: -100, hasBalance: true,
+		largestCategory: "Groceries", largestCategoryExpenses: 500, hasTransactions: true,
+		categoryTotals: map[string]Row{"Groceries": {expenses: 500}},
+	}
+
+	type want struct {
+		value       float64
+		hasValue    bool
+		previous    float64
+		hasPrevious bool
+	}
+	tests := []struct {
+		name              string
+		current, previous periodStatistics
+		want              map[string]want
+	}{
+		{
+			name:     "both periods",
+			current:  current,
+			previous: previous,
+			want: map[string]want{
+				"Savings Rate":          {25, true, 50, true},
+				"Average Monthly Spend": {1500, true, 1000, true},
+				// The previous period's spending in the current largest category:
+				"Largest Expense Category": {1500, true, 1200, true},
+				"Expense Growth":           {50, true, 0, false},
+				"Runway":                   {121.75, true, 152.19, true},
+			},
+		},
+		{
+			// Without income there is no savings rate, and a negative balance has no runway left:
+			name:     "no previous period",
+			current:  overdrawn,
+			previous: periodStatistics{},
+			want: map[string]want{
+				"Savings Rate":             {0, false, 0, false},
+				"Average Monthly Spend":    {1521.88, true, 0, false},
+				"Largest Expense Category": {500, true, 0, false},
+				"Expense Growth":           {0, false, 0, false},
+				"Runway":                   {0, true, 0, false},
+			},
+		},
+		{
+			name:     "a category the previous period did not have",
+			current:  periodStatistics{days: 31, expenses: 600, largestCategory: "Dining", largestCategoryExpenses: 600, hasTransactions: true},
+			previous: previous,
+			want: map[string]want{
+				"Savings Rate":             {0, false, 50, true},
+				"Average Monthly Spend":    {589.11, true, 1000, true},
+				"Largest Expense Category": {600, true, 0, true},
+				"Expense Growth":           {-70, true, 0, false},
+				"Runway":                   {0, false, 152.19, true},
+			},
+		},
+		{
+			name: "no transactions",
+			want: map[string]want{
+				"Savings Rate":             {},
+				"Average Monthly Spend":    {},
+				"Largest Expense Category": {},
+				"Expense Growth":           {},
+				"Runway":                   {},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		kpis := BuildKPIs(test.current, test.previous)
+		if len(kpis) != len(test.want) {
+			t.Errorf("%s: built %d KPIs, want %d", test.name, len(kpis), len(test.want))
+			continue
+		}
+		for _, kpi := range kpis {
+			expected, ok := test.want[kpi.Label]
+			got := want{math.Round(kpi.Value*100) / 100, kpi.HasValue, math.Round(kpi.Previous*100) / 100, kpi.HasPrevious}
+			if !ok || got != expected {
+				t.Errorf("%s: %s is %+v, want %+v", test.name, kpi.Label, got, expected)
+			}
+		}
+	}
+}
+
+func TestKPIDelta(t *testing.T) {
+	tests := []struct {
+		kpi      KPI
+		display  string
+		delta    string
+		show     bool
+		improved bool
+	}{
+		{KPI{Unit: kpiUnitPercent, HigherIsBetter: true, Value: 25, HasValue: true, Previous: 50, HasPrevious: true}, "25.0%", "-25.0 pts", true, false},
+		{KPI{Unit: kpiUnitMoney, Value: 1500, HasValue: true, Previous: 1000, HasPrevious: true}, "$1500.00", "+$500.00", true, false},
+		{KPI{Unit: kpiUnitMoney, Value: -20, HasValue: true, Previous: -20.001, HasPrevious: true}, "-$20.00", "+$0.00", false, false},
+		{KPI{Unit: kpiUnitDays, HigherIsBetter: true, Value: 121.75, HasValue: true, Previous: 90, HasPrevious: true}, "122 days", "+32 days", true, true},
+		{KPI{Unit: kpiUnitDays, Value: 10, HasValue: true}, "10 days", "+10 days", false, false},
+		{KPI{Unit: kpiUnitPercent, HigherIsBetter: true}, "n/a", "+0.0 pts", false, false},
+	}
+
+	for _, test := range tests {
+		kpi := test.kpi
+		if kpi.Display() != test.display || kpi.DeltaDisplay() != test.delta || kpi.ShowDelta() != test.show || kpi.Improved() != test.improved {
+			t.Errorf("%+v shows %q, %q, %t and improved %t, want %q, %q, %t and %t", kpi, kpi.Display(), kpi.DeltaDisplay(),
+				kpi.ShowDelta(), kpi.Improved(), test.display, test.delta, test.show, test.improved)
+		}
+	}
+}
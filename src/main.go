@@ -6,11 +6,14 @@ import (
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -20,38 +23,134 @@ type RequestData struct {
 	UniqueId string `json:"uniqueId"`
 }
 
-func mainHandler(w http.ResponseWriter, r *http.Request) {
+// storeHandlers are the handlers that read and write through the storage interfaces rather than opening the
+// database themselves, so they work the same against any backend returned by openStore.
+type storeHandlers struct {
+	transactions TransactionStore
+	uploads      UploadStore
+	balances     BalanceStore
+	budgets      BudgetStore
+	scheduled    ScheduleStore
+	anomalies    AnomalyStore
+	netWorth     NetWorthStore
+	goals        GoalStore
+	edits        TransactionEditStore
+	splits       SplitStore
+	attachments  AttachmentStore
+	audit        AuditStore
+	trash        TrashStore
+	transfers    TransferStore
+	payees       PayeeStore
+	search       SearchStore
+}
 
-	dbPath := "./finance_database.sqlite"
+// newStoreHandlers serves every page from the same store.
+func newStoreHandlers(store Store) *storeHandlers {
+	return &storeHandlers{
+		transactions: store,
+		uploads:      store,
+		balances:     store,
+		budgets:      store,
+		scheduled:    store,
+		anomalies:    store,
+		netWorth:     store,
+		goals:        store,
+		edits:        store,
+		splits:       store,
+		attachments:  store,
+		audit:        store,
+		trash:        store,
+		transfers:    store,
+		payees:       store,
+		search:       store,
+	}
+}
 
-	/*
+// parseDateRange reads the optional from and to query parameters that limit the dashboard to a window of dates.
+func parseDateRange(r *http.Request) (filter TransactionFilter, err error) {
+	params := r.URL.Query()
+	filter.From = strings.TrimSpace(params.Get("from"))
+	filter.To = strings.TrimSpace(params.Get("to"))
 
-		db, err := RebuildDatabase(dbPath)
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		_, err := time.Parse("2006-01-02", date)
 		if err != nil {
-			log.Fatal(err)
+			return filter, fmt.Errorf("%q is not a date in the format YYYY-MM-DD", date)
 		}
+	}
+	if filter.From != "" && filter.To != "" && filter.From > filter.To {
+		return filter, fmt.Errorf("the from date must be on or before the to date")
+	}
 
-			_, err = LoadTestData("../data/test_transactions.csv", db)
-			if err != nil {
-				log.Fatal(err)
-			}
+	return filter, nil
+}
 
-			db, err := sql.Open("sqlite3", dbPath)
-			if err != nil {
-				log.Fatal(err)
-			}
-	*/
-	db, err := sql.Open("sqlite3", dbPath)
+// dashboardQuery is the query string that reloads the dashboard with the same window of dates, frequency and forecast.
+func dashboardQuery(dateRange TransactionFilter, frequency Frequency, forecast ForecastOptions, trends TrendOptions) string {
+	params := url.Values{}
+	if frequency != FrequencyDay {
+		params.Set("frequency", string(frequency))
+	}
+	if forecast.Months > 0 {
+		params.Set("forecast", strconv.Itoa(forecast.Months))
+	}
+	if forecast.Band {
+		params.Set("band", "1")
+	}
+	for _, trend := range trends.values() {
+		params.Add("trend", trend)
+	}
+	if dateRange.From != "" {
+		params.Set("from", dateRange.From)
+	}
+	if dateRange.To != "" {
+		params.Set("to", dateRange.To)
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "?" + params.Encode()
+}
+
+func (h *storeHandlers) mainHandler(w http.ResponseWriter, r *http.Request) {
+
+	dateRange, err := parseDateRange(r)
 	if err != nil {
-		log.Fatal(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	frequency, err := ParseFrequency(r.URL.Query().Get("frequency"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	forecastOptions, err := parseForecastOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	transactions, err := ReadAllTransactions(db)
+	trendOptions, err := parseTrendOptions(r)
 	if err != nil {
-		log.Fatal("Unable to extract all transactions from the database")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if len(transactions) == 0 {
+	// Only the requested window is loaded and resampled:
+	transactions, err := h.transactions.ReadTransactionsInRange(dateRange)
+	if err != nil {
+		log.Println("Unable to extract all transactions from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// An empty window still renders the dashboard so the range can be changed, only an empty database does not:
+	if len(transactions) == 0 && dateRange.IsEmpty() {
 		tmpl, err := template.ParseFiles("../templates/index.html")
 		if err != nil {
 			log.Fatal("Unable to load the index.html template: ", err)
@@ -71,74 +170,81 @@ func mainHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+
+		return
 	}
 
-	// Resampling Transactions for daily timeseries:
-	resampleTransactionTimeseries, err := LoadBudgetFromCSV(transactions)
+	// Resampling Transactions into the requested periods:
+	resampleTransactionTimeseries, err := h.loadBudget(dateRange, transactions, frequency)
 	if err != nil {
-		log.Fatal("Unable to resample the transaction timeseries")
+		log.Println("Unable to resample the transaction timeseries:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// Destructuring the dailyResample component to get the timeseries arrays to pass to template from map:
-	var resampledDatetime = []time.Time{}
-	var resampledIncome = []float64{}
-	var resampledExpense = []float64{}
-	var resampledBalance = []float64{}
-
-	// Generating the statistics from the budget:
-	var TotalIncome float64 = 0.0
-	var TotalExpenses float64 = 0.0
-	var NetIncome float64 = 0.0
-
-	for i, v := range resampleTransactionTimeseries.dailyResample {
-		resampledDatetime = append(resampledDatetime, i)
-
-		resampledIncome = append(resampledIncome, v.income)
-		TotalIncome += v.income
-		TotalExpenses += v.expenses
-
-		resampledExpense = append(resampledExpense, v.expenses)
+	// The series is already in date order so the chart can plot it as it is:
+	series := resampleTransactionTimeseries.Series()
+	summary := series.Summary()
 
-		resampledBalance = append(resampledBalance, v.balance)
+	trends := resampleTransactionTimeseries.Trends()
+	chart := series.chart().withTrends(trends, trendOptions)
 
+	// The forecast continues from the latest transaction so it is only drawn when the window runs up to it:
+	if forecastOptions.Months > 0 && dateRange.To == "" && len(series) > 0 {
+		forecast, err := h.buildForecast(series, frequency, forecastOptions)
+		if err != nil {
+			log.Println("Unable to build the forecast:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		chart = chart.withForecast(forecast, forecastOptions.Band)
 	}
 
-	NetIncome = TotalIncome - TotalExpenses
-
-	// Converting slices to JSON to pass to template:
-	DatetimeJSON, err := json.Marshal(resampledDatetime)
+	kpis, err := h.buildKPIs(dateRange, transactions, resampleTransactionTimeseries)
 	if err != nil {
-		log.Fatal(err)
-	}
-	IncomeJSON, err := json.Marshal(resampledIncome)
-	if err != nil {
-		log.Fatal(err)
-	}
-	ExpenseJSON, err := json.Marshal(resampledExpense)
-	if err != nil {
-		log.Fatal(err)
+		log.Println("Unable to build the KPIs:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	BalanceJSON, err := json.Marshal(resampledBalance)
+
+	ChartJSON, err := json.Marshal(chart)
 	if err != nil {
-		log.Fatal(err)
+		log.Println("Unable to encode the chart series:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	data := struct {
-		Transactions                          []Transaction
-		DatetimeJSON                          string
-		IncomeJSON                            string
-		ExpenseJSON                           string
-		BalanceJSON                           string
+		ChartJSON                             template.JS
 		TotalIncome, TotalExpenses, NetIncome string
+		AccountBalances                       map[string]float64
+		KPIs                                  []KPI
+		DateRange                             TransactionFilter
+		Frequency                             Frequency
+		Frequencies                           []Frequency
+		Forecast                              ForecastOptions
+		ForecastMonths                        []int
+		Trend                                 TrendOptions
+		Trends                                Trends
+		RollingWindows                        []int
+		DashboardQuery                        string
 	}{
-		Transactions:  transactions,
-		DatetimeJSON:  string(DatetimeJSON),
-		IncomeJSON:    string(IncomeJSON),
-		ExpenseJSON:   string(ExpenseJSON),
-		BalanceJSON:   string(BalanceJSON),
-		TotalIncome:   fmt.Sprintf("%.2f", TotalIncome),
-		TotalExpenses: fmt.Sprintf("%.2f", TotalExpenses),
-		NetIncome:     fmt.Sprintf("%.f", NetIncome),
+		DateRange:      dateRange,
+		Frequency:      frequency,
+		Frequencies:    frequencies,
+		Forecast:       forecastOptions,
+		ForecastMonths: []int{3, 6, 9, 12},
+		Trend:          trendOptions,
+		Trends:         trends,
+		RollingWindows: rollingWindows,
+		DashboardQuery: dashboardQuery(dateRange, frequency, forecastOptions, trendOptions),
+		ChartJSON:      template.JS(ChartJSON),
+		TotalIncome:    fmt.Sprintf("%.2f", summary.TotalIncome),
+		TotalExpenses:  fmt.Sprintf("%.2f", summary.TotalExpenses),
+		NetIncome:      fmt.Sprintf("%.2f", summary.NetIncome),
+		KPIs:           kpis,
+
+		AccountBalances: resampleTransactionTimeseries.accountBalances,
 	}
 
 	fmt.Println(resampleTransactionTimeseries)
@@ -150,7 +256,13 @@ func mainHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = tmpl.Execute(w, data)
+	// Changing the frequency only swaps the chart:
+	templateName := "index.html"
+	if r.Header.Get("HX-Target") == "dashboardChart" {
+		templateName = "dashboardChart"
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, data)
 	if err != nil {
 
 		if strings.Contains(err.Error(), "broken pipe") {
@@ -164,7 +276,7 @@ func mainHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func handleUpload(w http.ResponseWriter, r *http.Request) {
+func (h *storeHandlers) handleUpload(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == "GET" {
 		tmpl, err := template.ParseFiles("../templates/upload.html")
@@ -180,51 +292,38 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == "POST" {
-		// TODO: Extract and upload all transactions from the csv:
-
-		dbPath := "./finance_database.sqlite"
-		db, err := sql.Open("sqlite3", dbPath)
-		if err != nil {
-			log.Fatal(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
 		file, header, err := r.FormFile("csvFile")
 		if err != nil {
-			log.Fatal("Error in Uploading the CSV File", err)
+			log.Println("Error in Uploading the CSV File", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		defer file.Close()
 
-		reader := csv.NewReader(file)
-		records, err := reader.ReadAll()
-		if err != nil {
-			log.Fatal("Unable to read rows from the csv:", err)
-
+		// Every row in a csv export belongs to the account it was downloaded from:
+		account := strings.TrimSpace(r.FormValue("account"))
+		if account == "" {
+			account = defaultAccount
 		}
 
-		tx, err := db.Begin()
-		if err != nil {
-			log.Fatal("Error in connecting to a database:", err)
-		}
-		stmt, err := tx.Prepare(`INSERT INTO transactions(
-			unique_id, 
-			date, 
-			description, 
-			debit, 
-			credit
-			) values(?, ?, ?, ? , ?)`)
+		reader := csv.NewReader(file)
+		records, err := reader.ReadAll()
 		if err != nil {
-			log.Fatal("Error in constructing transactions insert query", err)
+			log.Println("Unable to read rows from the csv:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		defer stmt.Close()
 
+		uploadedTransactions := []Transaction{}
 		for i := 0; i < len(records); i++ {
 
 			// Get a unique MD5 Hash for all elements for each row in the csv:
 			var rawDate, rawDescription, rawDebit, rawCredit string
 			record := records[i]
+			if len(record) < 4 {
+				http.Error(w, fmt.Sprintf("Row %d of the csv needs a date, description, debit and credit column", i+1), http.StatusBadRequest)
+				return
+			}
 			rawDate = record[0]
 			rawDescription = record[1]
 			rawDebit = record[2]
@@ -237,69 +336,95 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 			io.WriteString(h, rawDebit)
 			io.WriteString(h, rawCredit)
 
+			// The same charge can legitimately appear in two accounts so the account is part of the hash:
+			if account != defaultAccount {
+				io.WriteString(h, account)
+			}
+
 			// The last value appended to the array of csv rows is an MD5 hash for al existing records:
 			transactionHash := hex.EncodeToString((h.Sum(nil)))
 
-			_, err = stmt.Exec(transactionHash, record[0], record[1], record[2], record[3])
+			transaction, err := parseUploadedRecord(rawDate, rawDescription, rawDebit, rawCredit)
 			if err != nil {
-				log.Fatal("Unable to insert a specific test transaction row into db:", err)
+				http.Error(w, fmt.Sprintf("Row %d of the csv: %s", i+1, err), http.StatusBadRequest)
+				return
 			}
-		}
+			transaction.UniqueId = transactionHash
+			transaction.Account = account
+			transaction.Category = defaultCategory
 
-		err = tx.Commit()
-		if err != nil {
-			log.Fatal("Unable to execute full insert query for test data:", err)
+			uploadedTransactions = append(uploadedTransactions, transaction)
 		}
 
-		// Inserting tracking record for the uploaded csv:
-		tx, err = db.Begin()
-		if err != nil {
-			log.Fatal("Error in connecting to a database:", err)
-		}
-		stmt, err = tx.Prepare(`INSERT INTO uploaded_files(
-			filename,
-			date_uploaded,
-			num_rows,
-			file_size
-			) values(?, ?, ?, ?)`)
+		_, err = h.uploads.InsertUpload(UploadedFile{
+			FileName: header.Filename,
+			FileSize: header.Size,
+			NumRows:  len(records),
+			Account:  account,
+		}, uploadedTransactions, actorFromRequest(r))
 		if err != nil {
-			log.Fatal("Error in constructing tracking insert query", err)
+			log.Println("Unable to insert the uploaded csv:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		defer stmt.Close()
 
-		today := time.Now()
-		uploadedTime := today.Format("2006-01-02 15:04:05")
-		_, err = stmt.Exec(header.Filename, uploadedTime, len(records), header.Size)
-		if err != nil {
-			log.Fatal("Unable to execute the insert query for the tracking record", err)
-		}
+		fmt.Println("Sucessfully Inserted all data into db.")
 
-		err = tx.Commit()
+		// The upload is already stored, so a failed check is only logged:
+		uploadedIds := []string{}
+		for _, transaction := range uploadedTransactions {
+			uploadedIds = append(uploadedIds, transaction.UniqueId)
+		}
+		numAnomalies, err := h.detectAnomalies(uploadedIds)
 		if err != nil {
-			log.Fatal("Unable to execute full insert query for transaction data:", err)
+			log.Println("Unable to check the upload for anomalies:", err)
+		} else if numAnomalies > 0 {
+			fmt.Printf("Flagged %d anomalies in the upload.\n", numAnomalies)
 		}
 
-		fmt.Println("Sucessfully Inserted all data into db.")
-
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
 
-func uploadHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "GET" {
+// parseUploadedRecord converts the raw date, description, debit and credit columns of a csv row. Blank amounts are
+// read as 0.0.
+func parseUploadedRecord(rawDate, rawDescription, rawDebit, rawCredit string) (transaction Transaction, err error) {
+	transaction.Date, err = time.Parse("2006-01-02", strings.TrimSpace(rawDate))
+	if err != nil {
+		return transaction, fmt.Errorf("the date %q must be in the format YYYY-MM-DD", rawDate)
+	}
+	transaction.Description = rawDescription
 
-		dbPath := "./finance_database.sqlite"
-		db, err := sql.Open("sqlite3", dbPath)
+	for _, amount := range []struct {
+		raw    string
+		parsed *float32
+	}{
+		{rawDebit, &transaction.Debit},
+		{rawCredit, &transaction.Credit},
+	} {
+		raw := strings.TrimSpace(amount.raw)
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(raw, 32)
 		if err != nil {
-			log.Fatal(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return transaction, fmt.Errorf("%q is not a valid amount", amount.raw)
 		}
+		*amount.parsed = float32(parsed)
+	}
 
-		transactionHistory, err := ReadTransactionHistory(db)
+	return transaction, nil
+}
+
+func (h *storeHandlers) uploadHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+
+		transactionHistory, err := h.uploads.ReadTransactionHistory()
 		fmt.Println(transactionHistory)
 		if err != nil {
-			log.Fatal("Error in querying all of the transactions from the database")
+			log.Println("Error in querying all of the transactions from the database:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		tmpl, err := template.ParseFiles("../templates/upload_history.html")
@@ -335,6 +460,10 @@ type ErrorMessage struct {
 	Error string
 }
 
+type SuccessMessage struct {
+	Message string
+}
+
 func displayUploadedCSVTable(w http.ResponseWriter, r *http.Request) {
 
 	tmpl, err := template.ParseFiles("../templates/snippits/uploadedCsvTable.html")
@@ -407,10 +536,17 @@ func displayUploadedCSVTable(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func debugActionsHandler(w http.ResponseWriter, r *http.Request) {
+// debugActionsHandler rebuilds or seeds the SQLite database. The actions work on the database file directly so they
+// are refused when another backend is in use.
+func (h *storeHandlers) debugActionsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 
-		dbPath := "./finance_database.sqlite"
+		sqliteStore, ok := h.transactions.(*SQLiteStore)
+		if !ok {
+			http.Error(w, "The debug actions are only available with the SQLite store", http.StatusBadRequest)
+			return
+		}
+		dbPath := sqliteStore.dbPath
 
 		r.ParseForm()
 
@@ -440,70 +576,93 @@ func debugActionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func displayTransactionContainer(w http.ResponseWriter, r *http.Request) {
+func (h *storeHandlers) displayTransactionContainer(w http.ResponseWriter, r *http.Request) {
 
 	params := r.URL.Query()
 	var transactionId string = params.Get("transaction_id")
 	fmt.Println(transactionId)
 
 	// Querying the transaction based on the ID
-	dbPath := "./finance_database.sqlite"
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatal(err)
+	individualTransaction, err := h.transactions.ReadTransaction(transactionId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
 	}
-	rows := db.QueryRow("SELECT * FROM transactions WHERE unique_id = ?", transactionId)
 	if err != nil {
-		log.Fatal("Error in querying a single transaction from the database:", err)
+		log.Println("Error in querying a single transaction from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	defer db.Close()
 
-	var extractedUniqueId, extractedDate, extractedDescription, extractedDebit, extractedCredit string
-	err = rows.Scan(&extractedUniqueId, &extractedDate, &extractedDescription, &extractedDebit, &extractedCredit)
+	h.renderTransactionDetails(w, individualTransaction, "")
+}
+
+// renderTransactionContainer renders the full detail snippet for a single transaction. The optional error message is
+// shown at the top of the snippet, e.g. when an edit was rejected.
+func (h *storeHandlers) renderTransactionContainer(w http.ResponseWriter, transactionId string, errorMessage string) {
+
+	individualTransaction, err := h.transactions.ReadTransaction(transactionId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Fatal("Error in querying row from test database:", err)
+		log.Println("Error in querying a single transaction from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	var formattedCredit float32
-	if extractedCredit == "" {
-		formattedCredit = 0.0
-	} else {
-		formattedCredit64, err := strconv.ParseFloat(extractedCredit, 32)
-		formattedCredit = float32(formattedCredit64)
-		if err != nil {
-			log.Fatal("Error in converting the credit value to a format: ", err)
-		}
+	h.renderTransactionDetails(w, individualTransaction, errorMessage)
+}
 
+func (h *storeHandlers) renderTransactionDetails(w http.ResponseWriter, individualTransaction Transaction, errorMessage string) {
+
+	attachments, err := h.attachments.ReadTransactionAttachments(individualTransaction.UniqueId)
+	if err != nil {
+		log.Println("Error in querying the attachments for a transaction:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	var formattedDebit float32
-	if extractedDebit == "" {
-		formattedDebit = 0.0
-	} else {
-		formattedDebit64, err := strconv.ParseFloat(extractedDebit, 32)
-		formattedDebit = float32(formattedDebit64)
-		if err != nil {
-			log.Fatal("Error in converting the debit value to a format: ", err)
-		}
+
+	categories, err := h.splits.ReadCategories()
+	if err != nil {
+		log.Println("Error in querying the list of categories:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	transactionTime, err := time.Parse("2006-01-02", extractedDate)
+	history, err := h.audit.ReadAuditLog(AuditFilter{Entity: auditEntityTransaction, EntityId: individualTransaction.UniqueId})
 	if err != nil {
-		log.Fatal("Error in loading transaction time into a date struct", err)
+		log.Println("Error in querying the audit history for a transaction:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	individualTransaction := Transaction{
-		UniqueId:    extractedUniqueId,
-		Date:        transactionTime,
-		Description: extractedDescription,
-		Debit:       formattedDebit,
-		Credit:      formattedCredit,
+	transactionContent := struct {
+		Transaction
+		History        []AuditEntry
+		Error          string
+		AttachmentList transactionAttachmentsContent
+		SplitEditor    splitEditorContent
+	}{
+		Transaction: individualTransaction,
+		History:     history,
+		Error:       errorMessage,
+		AttachmentList: transactionAttachmentsContent{
+			TransactionId: individualTransaction.UniqueId,
+			Attachments:   attachments,
+		},
+		SplitEditor: splitEditorContent{
+			Transaction: individualTransaction,
+			Categories:  categories,
+		},
 	}
 
 	tmpl, err := template.ParseFiles("../templates/snippits/transactionInformationComponents.html")
 	if err != nil {
 		log.Fatal("Error in loading the template snippit: ", err)
 	}
-	err = tmpl.Execute(w, individualTransaction)
+	err = tmpl.Execute(w, transactionContent)
 	if err != nil {
 		log.Fatal("Unable to render the template snippit for an individual transaction: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -515,17 +674,59 @@ func displayTransactionContainer(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 
-	http.HandleFunc("/", mainHandler)
-	http.HandleFunc("/upload", handleUpload)
-	http.HandleFunc("/upload_history", uploadHistoryHandler)
-	http.HandleFunc("/debug_actions", debugActionsHandler)
+	copySQLitePath := flag.String("copy-sqlite", "", "copy the SQLite database at this path into the Postgres database in FINANCE_DATABASE_URL and exit")
+	flag.Parse()
+
+	if *copySQLitePath != "" {
+		runSQLiteCopy(*copySQLitePath, os.Getenv("FINANCE_DATABASE_URL"))
+		return
+	}
+
+	store, err := openStore("./finance_database.sqlite")
+	if err != nil {
+		log.Fatal(err)
+	}
+	handlers := newStoreHandlers(store)
+
+	http.HandleFunc("/", handlers.mainHandler)
+	http.HandleFunc("/upload", handlers.handleUpload)
+	http.HandleFunc("/upload_history", handlers.uploadHistoryHandler)
+	http.HandleFunc("/categories", handlers.categoryReportHandler)
+	http.HandleFunc("/transfers", handlers.transfersHandler)
+	http.HandleFunc("/payees", handlers.payeesHandler)
+	http.HandleFunc("/audit", handlers.auditHandler)
+	http.HandleFunc("/trash", handlers.trashHandler)
+	http.HandleFunc("/balances", handlers.balancesHandler)
+	http.HandleFunc("/budgets", handlers.budgetsHandler)
+	http.HandleFunc("/recurring", handlers.recurringHandler)
+	http.HandleFunc("/scheduled", handlers.scheduledHandler)
+	http.HandleFunc("/anomalies", handlers.anomaliesHandler)
+	http.HandleFunc("/compare", handlers.compareHandler)
+	http.HandleFunc("/net_worth", handlers.netWorthHandler)
+	http.HandleFunc("/net_worth/chart", handlers.netWorthChartHandler)
+	http.HandleFunc("/goals", handlers.goalsHandler)
+	http.HandleFunc("/goals/cards", handlers.goalCardsHandler)
+	http.HandleFunc("/calendar", handlers.calendarHandler)
+	http.HandleFunc("/calendar/day", handlers.calendarDayHandler)
+	http.HandleFunc("/debug_actions", handlers.debugActionsHandler)
+	http.HandleFunc("/api/series", handlers.seriesHandler)
 
 	// HTMX functions:
-	http.HandleFunc("/get_transactions", displayTransactionContainer)
+	http.HandleFunc("/get_transactions", handlers.displayTransactionContainer)
 	http.HandleFunc("/render_csv", displayUploadedCSVTable)
+	http.HandleFunc("/upload_attachment", handlers.uploadAttachmentHandler)
+	http.HandleFunc("/attachment", handlers.attachmentHandler)
+	http.HandleFunc("/splits", handlers.transactionSplitsHandler)
+	http.HandleFunc("/split_line", blankSplitLineHandler)
+	http.HandleFunc("/transaction_category", handlers.transactionCategoryHandler)
+	http.HandleFunc("/transaction", handlers.transactionHandler)
+	http.HandleFunc("/search", handlers.searchHandler)
+	http.HandleFunc("/transactions", handlers.transactionTableHandler)
 
 	http.Handle("/css/", http.StripPrefix("/css/", http.FileServer(http.Dir("../css"))))
 	http.Handle("/js/", http.StripPrefix("/js/", http.FileServer(http.Dir("../js"))))
 
+	go purgeTrashPeriodically(store, trashRetentionDays())
+
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
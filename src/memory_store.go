@@ -0,0 +1,1646 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps everything in memory. It backs the app when there is no database file to work with, e.g. for a
+// throwaway demo or when exercising the handlers in isolation.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	transactions  []Transaction
+	uploads       []TransactionHistory
+	balances      []AccountBalance
+	budgets       []CategoryBudget
+	scheduled     []ScheduledTransaction
+	anomalies     []Anomaly
+	netWorth      []NetWorthAccount
+	goals         []SavingsGoal
+	auditLog      []AuditEntry
+	attachments   []Attachment
+	payees        []Payee
+	transferLinks []memoryTransferLink
+
+	// Columns of the SQL transactions and uploaded_files tables that are not part of Transaction or
+	// TransactionHistory, keyed by the transaction or upload id:
+	deletedAt       map[string]string
+	uploadIds       map[string]int64
+	payeeIds        map[string]int
+	uploadDeletedAt map[string]string
+}
+
+// memoryTransferLink is a row of the SQL transfer_links table, the transactions are only joined in when it is read.
+type memoryTransferLink struct {
+	uniqueId          int
+	debitId, creditId string
+	status            string
+	dateDetected      string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		deletedAt:       make(map[string]string),
+		uploadIds:       make(map[string]int64),
+		payeeIds:        make(map[string]int),
+		uploadDeletedAt: make(map[string]string),
+	}
+}
+
+// recordAudit appends entries to the audit log in the same way as RecordAudit, every entry shares the same actor and
+// timestamp.
+func (s *MemoryStore) recordAudit(actor string, entries ...AuditEntry) {
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	for _, entry := range entries {
+		entry.UniqueId = len(s.auditLog) + 1
+		entry.Actor = actor
+		entry.Timestamp = timestamp
+		s.auditLog = append(s.auditLog, entry)
+	}
+}
+
+// copyTransaction stops callers from modifying the stored splits through the returned transaction:
+func copyTransaction(transaction Transaction) Transaction {
+	if transaction.Splits != nil {
+		transaction.Splits = append([]TransactionSplit(nil), transaction.Splits...)
+	}
+	return transaction
+}
+
+// readTransaction copies a stored transaction and fills in the payee name and the transfer flag, which the SQL stores
+// join in from the payees and transfer_links tables.
+func (s *MemoryStore) readTransaction(transaction Transaction) Transaction {
+	transaction = copyTransaction(transaction)
+
+	transaction.Payee = ""
+	if payeeId, ok := s.payeeIds[transaction.UniqueId]; ok {
+		for _, payee := range s.payees {
+			if payee.UniqueId == payeeId {
+				transaction.Payee = payee.Name
+			}
+		}
+	}
+
+	transaction.IsTransfer = false
+	for _, link := range s.transferLinks {
+		if link.status == transferStatusConfirmed && (link.debitId == transaction.UniqueId || link.creditId == transaction.UniqueId) {
+			transaction.IsTransfer = true
+		}
+	}
+
+	return transaction
+}
+
+// liveTransactions returns every transaction outside of the trash in the order they were added.
+func (s *MemoryStore) liveTransactions() []Transaction {
+	transactions := []Transaction{}
+	for _, transaction := range s.transactions {
+		if _, trashed := s.deletedAt[transaction.UniqueId]; !trashed {
+			transactions = append(transactions, s.readTransaction(transaction))
+		}
+	}
+	return transactions
+}
+
+// findTransaction returns the index of a transaction in s.transactions whether or not it is in the trash.
+func (s *MemoryStore) findTransaction(transactionId string) (int, bool) {
+	for i, transaction := range s.transactions {
+		if transaction.UniqueId == transactionId {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// findLiveTransaction returns the index of a transaction that is not in the trash.
+func (s *MemoryStore) findLiveTransaction(transactionId string) (int, bool) {
+	i, found := s.findTransaction(transactionId)
+	if !found {
+		return -1, false
+	}
+	if _, trashed := s.deletedAt[transactionId]; trashed {
+		return -1, false
+	}
+	return i, true
+}
+
+func (s *MemoryStore) ReadAllTransactions() ([]Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.liveTransactions(), nil
+}
+
+// matches applies the same rules as TransactionFilter.whereClause to a single transaction.
+func (f TransactionFilter) matches(transaction Transaction) bool {
+	date := transaction.Date.Format("2006-01-02")
+	if (f.From != "" && date < f.From) || (f.To != "" && date > f.To) {
+		return false
+	}
+	if f.Account != "" && transaction.Account != f.Account {
+		return false
+	}
+	if f.Category != "" && transaction.Category != f.Category {
+		for _, split := range transaction.Splits {
+			if split.Category == f.Category {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (s *MemoryStore) ReadTransactionsInRange(filter TransactionFilter) ([]Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	transactions := []Transaction{}
+	for _, transaction := range s.liveTransactions() {
+		if filter.matches(transaction) {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.Before(transactions[j].Date)
+	})
+
+	return transactions, nil
+}
+
+// compareForPage orders two transactions by the sort column and then by id, matching the ORDER BY of the SQL stores.
+func compareForPage(a Transaction, b Transaction, sort string) int {
+	if numericSortColumns[sort] {
+		aValue, _ := strconv.ParseFloat(transactionSortValue(a, sort), 64)
+		bValue, _ := strconv.ParseFloat(transactionSortValue(b, sort), 64)
+		if aValue != bValue {
+			if aValue < bValue {
+				return -1
+			}
+			return 1
+		}
+	} else if aValue, bValue := transactionSortValue(a, sort), transactionSortValue(b, sort); aValue != bValue {
+		if aValue < bValue {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.UniqueId, b.UniqueId)
+}
+
+func (s *MemoryStore) ReadTransactionPage(query TransactionPageQuery) (TransactionPage, error) {
+	transactions, err := s.ReadTransactionsInRange(query.Filter)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return compareForPage(transactions[i], transactions[j], query.Sort)*direction < 0
+	})
+
+	// The cursor is compared as if it were a transaction with the cursor's sort value and id:
+	var cursor Transaction
+	if !query.IsFirstPage() {
+		cursor = Transaction{UniqueId: query.AfterId}
+		switch query.Sort {
+		case "payee":
+			cursor.Payee = query.AfterValue
+		case "account":
+			cursor.Account = query.AfterValue
+		case "debit", "credit":
+			amount, err := strconv.ParseFloat(query.AfterValue, 32)
+			if err != nil {
+				return TransactionPage{}, fmt.Errorf("invalid cursor value %q", query.AfterValue)
+			}
+			cursor.Debit, cursor.Credit = float32(amount), float32(amount)
+		default:
+			cursor.Date, err = time.Parse("2006-01-02", query.AfterValue)
+			if err != nil {
+				return TransactionPage{}, fmt.Errorf("invalid cursor value %q", query.AfterValue)
+			}
+		}
+	}
+
+	matching := []Transaction{}
+	for _, transaction := range transactions {
+		if query.Search != "" && !strings.Contains(strings.ToLower(transaction.Description), strings.ToLower(query.Search)) {
+			continue
+		}
+		if !query.IsFirstPage() && compareForPage(transaction, cursor, query.Sort)*direction <= 0 {
+			continue
+		}
+		matching = append(matching, transaction)
+		if len(matching) > query.PageSize {
+			break
+		}
+	}
+
+	return newTransactionPage(matching, query), nil
+}
+
+func (s *MemoryStore) ReadTransaction(transactionId string) (Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, found := s.findLiveTransaction(transactionId)
+	if !found {
+		return Transaction{}, sql.ErrNoRows
+	}
+
+	return s.readTransaction(s.transactions[i]), nil
+}
+
+func (s *MemoryStore) ReadTransactionHistory() ([]TransactionHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := []TransactionHistory{}
+	for _, upload := range s.uploads {
+		if _, trashed := s.uploadDeletedAt[upload.UniqueId]; !trashed {
+			history = append(history, upload)
+		}
+	}
+
+	return history, nil
+}
+
+// InsertUpload also runs the payee aliases and transfer detection over the new transactions, in the same way as the
+// SQLite store.
+func (s *MemoryStore) InsertUpload(upload UploadedFile, transactions []Transaction, actor string) (uploadId int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Matching the primary key on the SQLite transactions table, a duplicate id rejects the whole upload:
+	existingIds := make(map[string]bool)
+	for _, transaction := range s.transactions {
+		existingIds[transaction.UniqueId] = true
+	}
+	for _, transaction := range transactions {
+		if existingIds[transaction.UniqueId] {
+			return 0, fmt.Errorf("inserting transaction %s %s: duplicate transaction id %s",
+				transaction.Date.Format("2006-01-02"), transaction.Description, transaction.UniqueId)
+		}
+		existingIds[transaction.UniqueId] = true
+	}
+
+	// Ids are never reused, even once an upload is purged from the trash:
+	uploadId = 1
+	for _, existing := range s.uploads {
+		existingId, _ := strconv.ParseInt(existing.UniqueId, 10, 64)
+		if existingId >= uploadId {
+			uploadId = existingId + 1
+		}
+	}
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+
+	for _, transaction := range transactions {
+		transaction = copyTransaction(transaction)
+		if transaction.Category == "" {
+			transaction.Category = defaultCategory
+		}
+		s.transactions = append(s.transactions, transaction)
+		s.uploadIds[transaction.UniqueId] = uploadId
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityTransaction,
+			EntityId: transaction.UniqueId,
+			Field:    "*",
+			NewValue: describeTransaction(transaction) + " (uploaded from " + upload.FileName + ")",
+		})
+	}
+
+	s.uploads = append(s.uploads, TransactionHistory{
+		UniqueId:     strconv.FormatInt(uploadId, 10),
+		FileName:     upload.FileName,
+		DateUploaded: timestamp,
+		NumRows:      upload.NumRows,
+		FileSize:     float64(upload.FileSize),
+	})
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityUpload,
+		EntityId: strconv.FormatInt(uploadId, 10),
+		Field:    "*",
+		NewValue: fmt.Sprintf("%s, %d rows into account %s", upload.FileName, upload.NumRows, upload.Account),
+	})
+
+	_, err = s.applyPayeeAliases(true)
+	if err != nil {
+		return uploadId, fmt.Errorf("applying the payee aliases: %w", err)
+	}
+	s.detectTransferCandidates(transferMatchWindowDays, actor)
+
+	return uploadId, nil
+}
+
+func (s *MemoryStore) ReadAccountBalances() ([]AccountBalance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	balances := append([]AccountBalance{}, s.balances...)
+	sort.SliceStable(balances, func(i, j int) bool {
+		if balances[i].Account != balances[j].Account {
+			return balances[i].Account < balances[j].Account
+		}
+		return balances[i].Date.Before(balances[j].Date)
+	})
+
+	return balances, nil
+}
+
+// SaveAccountBalance replaces balances in the same way as the SQLite store.
+func (s *MemoryStore) SaveAccountBalance(balance AccountBalance, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldValue := ""
+	nextId := 1
+	balances := []AccountBalance{}
+	for _, existing := range s.balances {
+		if existing.UniqueId >= nextId {
+			nextId = existing.UniqueId + 1
+		}
+		replaced := existing.Account == balance.Account && existing.Kind == balance.Kind &&
+			(balance.Kind == balanceKindOpening || existing.Date.Equal(balance.Date))
+		if replaced {
+			oldValue = describeBalance(existing)
+			continue
+		}
+		balances = append(balances, existing)
+	}
+
+	balance.UniqueId = nextId
+	s.balances = append(balances, balance)
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityBalance,
+		EntityId: balance.Account,
+		Field:    balance.Kind,
+		OldValue: oldValue,
+		NewValue: describeBalance(balance),
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteAccountBalance(balanceId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, balance := range s.balances {
+		if balance.UniqueId != balanceId {
+			continue
+		}
+		s.balances = append(s.balances[:i], s.balances[i+1:]...)
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityBalance,
+			EntityId: balance.Account,
+			Field:    balance.Kind,
+			OldValue: describeBalance(balance),
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) ReadCategoryBudgets() ([]CategoryBudget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	budgets := append([]CategoryBudget{}, s.budgets...)
+	sort.SliceStable(budgets, func(i, j int) bool {
+		if budgets[i].Category != budgets[j].Category {
+			return budgets[i].Category < budgets[j].Category
+		}
+		return budgets[i].Month.Before(budgets[j].Month)
+	})
+
+	return budgets, nil
+}
+
+func (s *MemoryStore) SaveCategoryBudget(budget CategoryBudget, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldValue := ""
+	nextId := 1
+	replaced := false
+	for i, existing := range s.budgets {
+		if existing.UniqueId >= nextId {
+			nextId = existing.UniqueId + 1
+		}
+		if existing.Category == budget.Category && existing.Month.Equal(budget.Month) {
+			oldValue = describeBudget(existing)
+			budget.UniqueId = existing.UniqueId
+			s.budgets[i] = budget
+			replaced = true
+		}
+	}
+	if !replaced {
+		budget.UniqueId = nextId
+		s.budgets = append(s.budgets, budget)
+	}
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityBudget,
+		EntityId: budget.Category,
+		Field:    "amount",
+		OldValue: oldValue,
+		NewValue: describeBudget(budget),
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteCategoryBudget(budgetId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, budget := range s.budgets {
+		if budget.UniqueId != budgetId {
+			continue
+		}
+		s.budgets = append(s.budgets[:i], s.budgets[i+1:]...)
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityBudget,
+			EntityId: budget.Category,
+			Field:    "amount",
+			OldValue: describeBudget(budget),
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) ReadScheduledTransactions() ([]ScheduledTransaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scheduled := append([]ScheduledTransaction{}, s.scheduled...)
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		return scheduled[i].Date.Before(scheduled[j].Date)
+	})
+
+	return scheduled, nil
+}
+
+func (s *MemoryStore) InsertScheduledTransaction(scheduled ScheduledTransaction, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled.UniqueId = 1
+	for _, existing := range s.scheduled {
+		if existing.UniqueId >= scheduled.UniqueId {
+			scheduled.UniqueId = existing.UniqueId + 1
+		}
+	}
+	s.scheduled = append(s.scheduled, scheduled)
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityScheduled,
+		EntityId: strconv.Itoa(scheduled.UniqueId),
+		Field:    "*",
+		NewValue: describeScheduledTransaction(scheduled),
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteScheduledTransaction(scheduledId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, scheduled := range s.scheduled {
+		if scheduled.UniqueId != scheduledId {
+			continue
+		}
+		s.scheduled = append(s.scheduled[:i], s.scheduled[i+1:]...)
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityScheduled,
+			EntityId: strconv.Itoa(scheduledId),
+			Field:    "*",
+			OldValue: describeScheduledTransaction(scheduled),
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) ReadAnomalies() ([]Anomaly, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Newest first, as they were appended in the order they were detected:
+	anomalies := []Anomaly{}
+	for i := len(s.anomalies) - 1; i >= 0; i-- {
+		anomalies = append(anomalies, s.anomalies[i])
+	}
+
+	return anomalies, nil
+}
+
+func (s *MemoryStore) RecordAnomalies(anomalies []Anomaly) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recorded := make(map[string]bool)
+	for _, existing := range s.anomalies {
+		recorded[existing.Kind+"|"+existing.Key] = true
+	}
+
+	numRecorded := 0
+	detectedAt := time.Now().Format("2006-01-02 15:04:05")
+	for _, anomaly := range anomalies {
+		if recorded[anomaly.Kind+"|"+anomaly.Key] {
+			continue
+		}
+		recorded[anomaly.Kind+"|"+anomaly.Key] = true
+
+		anomaly.UniqueId = len(s.anomalies) + 1
+		anomaly.DetectedAt = detectedAt
+		anomaly.Status = anomalyStatusOpen
+		s.anomalies = append(s.anomalies, anomaly)
+		numRecorded++
+	}
+
+	return numRecorded, nil
+}
+
+func (s *MemoryStore) UpdateAnomalyStatus(anomalyId int, status string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.anomalies {
+		if s.anomalies[i].UniqueId != anomalyId {
+			continue
+		}
+		oldStatus := s.anomalies[i].Status
+		s.anomalies[i].Status = status
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityAnomaly,
+			EntityId: strconv.Itoa(anomalyId),
+			Field:    "status",
+			OldValue: oldStatus,
+			NewValue: status + ": " + s.anomalies[i].Summary,
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) ReadNetWorthAccounts() ([]NetWorthAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accounts := []NetWorthAccount{}
+	for _, account := range s.netWorth {
+		account.Valuations = append([]Valuation{}, account.Valuations...)
+		accounts = append(accounts, account)
+	}
+	sort.SliceStable(accounts, func(i, j int) bool {
+		if accounts[i].Kind != accounts[j].Kind {
+			return accounts[i].Kind < accounts[j].Kind
+		}
+		return accounts[i].Name < accounts[j].Name
+	})
+
+	return accounts, nil
+}
+
+func (s *MemoryStore) AddNetWorthAccount(account NetWorthAccount, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account.UniqueId = 1
+	for _, existing := range s.netWorth {
+		if existing.Name == account.Name {
+			return fmt.Errorf("there is already an account named %s", account.Name)
+		}
+		if existing.UniqueId >= account.UniqueId {
+			account.UniqueId = existing.UniqueId + 1
+		}
+	}
+	account.Valuations = nil
+	s.netWorth = append(s.netWorth, account)
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityNetWorth,
+		EntityId: strconv.Itoa(account.UniqueId),
+		Field:    "*",
+		NewValue: describeNetWorthAccount(account),
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteNetWorthAccount(accountId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, account := range s.netWorth {
+		if account.UniqueId != accountId {
+			continue
+		}
+		s.netWorth = append(s.netWorth[:i], s.netWorth[i+1:]...)
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityNetWorth,
+			EntityId: strconv.Itoa(accountId),
+			Field:    "*",
+			OldValue: describeNetWorthAccount(account),
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) SaveValuation(valuation Valuation, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Valuation ids are unique across every account:
+	nextId := 1
+	for _, account := range s.netWorth {
+		for _, existing := range account.Valuations {
+			if existing.UniqueId >= nextId {
+				nextId = existing.UniqueId + 1
+			}
+		}
+	}
+
+	for i := range s.netWorth {
+		account := &s.netWorth[i]
+		if account.UniqueId != valuation.AccountId {
+			continue
+		}
+
+		oldValue := ""
+		valuations := []Valuation{}
+		for _, existing := range account.Valuations {
+			if existing.Date.Equal(valuation.Date) {
+				oldValue = fmt.Sprintf("%.2f", existing.Value)
+				valuation.UniqueId = existing.UniqueId
+				continue
+			}
+			valuations = append(valuations, existing)
+		}
+		if valuation.UniqueId == 0 {
+			valuation.UniqueId = nextId
+		}
+		account.Valuations = append(valuations, valuation)
+		sort.SliceStable(account.Valuations, func(i, j int) bool {
+			return account.Valuations[i].Date.Before(account.Valuations[j].Date)
+		})
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityNetWorth,
+			EntityId: strconv.Itoa(account.UniqueId),
+			Field:    "valuation " + valuation.Date.Format("2006-01-02"),
+			OldValue: oldValue,
+			NewValue: describeValuation(account.Name, valuation),
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) DeleteValuation(valuationId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.netWorth {
+		account := &s.netWorth[i]
+		for j, valuation := range account.Valuations {
+			if valuation.UniqueId != valuationId {
+				continue
+			}
+			account.Valuations = append(account.Valuations[:j], account.Valuations[j+1:]...)
+
+			s.recordAudit(actor, AuditEntry{
+				Entity:   auditEntityNetWorth,
+				EntityId: strconv.Itoa(account.UniqueId),
+				Field:    "valuation " + valuation.Date.Format("2006-01-02"),
+				OldValue: describeValuation(account.Name, valuation),
+			})
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) ReadSavingsGoals() ([]SavingsGoal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	goals := append([]SavingsGoal{}, s.goals...)
+	sort.SliceStable(goals, func(i, j int) bool {
+		if !goals[i].TargetDate.Equal(goals[j].TargetDate) {
+			return goals[i].TargetDate.Before(goals[j].TargetDate)
+		}
+		return goals[i].Name < goals[j].Name
+	})
+
+	return goals, nil
+}
+
+func (s *MemoryStore) AddSavingsGoal(goal SavingsGoal, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	goal.UniqueId = 1
+	for _, existing := range s.goals {
+		if existing.UniqueId >= goal.UniqueId {
+			goal.UniqueId = existing.UniqueId + 1
+		}
+	}
+	s.goals = append(s.goals, goal)
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityGoal,
+		EntityId: strconv.Itoa(goal.UniqueId),
+		Field:    "*",
+		NewValue: describeSavingsGoal(goal),
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteSavingsGoal(goalId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, goal := range s.goals {
+		if goal.UniqueId != goalId {
+			continue
+		}
+		s.goals = append(s.goals[:i], s.goals[i+1:]...)
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityGoal,
+			EntityId: strconv.Itoa(goalId),
+			Field:    "*",
+			OldValue: describeSavingsGoal(goal),
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) InsertTransaction(transaction Transaction, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.findTransaction(transaction.UniqueId); found {
+		return fmt.Errorf("duplicate transaction id %s", transaction.UniqueId)
+	}
+	transaction = copyTransaction(transaction)
+	s.transactions = append(s.transactions, transaction)
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transaction.UniqueId,
+		Field:    "*",
+		NewValue: describeTransaction(transaction),
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) UpdateTransaction(existingTransaction Transaction, transaction Transaction, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, found := s.findLiveTransaction(transaction.UniqueId)
+	if !found {
+		return sql.ErrNoRows
+	}
+	stored := &s.transactions[i]
+	stored.Date = transaction.Date
+	stored.Description = transaction.Description
+	stored.Debit = transaction.Debit
+	stored.Credit = transaction.Credit
+
+	s.recordAudit(actor, diffTransactions(existingTransaction, transaction)...)
+
+	return nil
+}
+
+func (s *MemoryStore) SoftDeleteTransaction(transaction Transaction, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.findLiveTransaction(transaction.UniqueId); !found {
+		return sql.ErrNoRows
+	}
+	s.deletedAt[transaction.UniqueId] = time.Now().Format("2006-01-02 15:04:05")
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transaction.UniqueId,
+		Field:    "deleted_at",
+		OldValue: describeTransaction(transaction),
+		NewValue: "trashed",
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) ReplaceTransactionSplits(transactionId string, splits []TransactionSplit, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, found := s.findTransaction(transactionId)
+	if !found {
+		return sql.ErrNoRows
+	}
+
+	// Split ids are unique across every transaction:
+	nextId := 1
+	for _, transaction := range s.transactions {
+		for _, split := range transaction.Splits {
+			if split.UniqueId >= nextId {
+				nextId = split.UniqueId + 1
+			}
+		}
+	}
+
+	oldSplits := s.transactions[i].Splits
+	var newSplits []TransactionSplit
+	for _, split := range splits {
+		split.UniqueId = nextId
+		split.TransactionId = transactionId
+		newSplits = append(newSplits, split)
+		nextId++
+	}
+	s.transactions[i].Splits = newSplits
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "splits",
+		OldValue: describeSplits(oldSplits),
+		NewValue: describeSplits(splits),
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) UpdateTransactionCategory(transactionId string, category string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, found := s.findLiveTransaction(transactionId)
+	if !found {
+		return sql.ErrNoRows
+	}
+	oldCategory := s.transactions[i].Category
+	s.transactions[i].Category = category
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "category",
+		OldValue: oldCategory,
+		NewValue: category,
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) ReadCategories() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := make(map[string]bool)
+	categories := []string{}
+	for _, transaction := range s.liveTransactions() {
+		for _, line := range append([]TransactionSplit{{Category: transaction.Category}}, transaction.Splits...) {
+			if !found[line.Category] {
+				found[line.Category] = true
+				categories = append(categories, line.Category)
+			}
+		}
+	}
+	sort.Strings(categories)
+
+	return categories, nil
+}
+
+func (s *MemoryStore) ReadTransactionAttachments(transactionId string) ([]Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	attachments := []Attachment{}
+	for _, attachment := range s.attachments {
+		if attachment.TransactionId == transactionId {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	return attachments, nil
+}
+
+func (s *MemoryStore) ReadAttachment(attachmentId int) (Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, attachment := range s.attachments {
+		if attachment.UniqueId == attachmentId {
+			return attachment, nil
+		}
+	}
+
+	return Attachment{}, sql.ErrNoRows
+}
+
+func (s *MemoryStore) InsertAttachment(attachment Attachment, actor string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attachment.UniqueId = 1
+	for _, existing := range s.attachments {
+		if existing.UniqueId >= attachment.UniqueId {
+			attachment.UniqueId = existing.UniqueId + 1
+		}
+	}
+	s.attachments = append(s.attachments, attachment)
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: attachment.TransactionId,
+		Field:    "attachment",
+		NewValue: attachment.FileName,
+	})
+
+	return int64(attachment.UniqueId), nil
+}
+
+func (s *MemoryStore) DeleteAttachment(attachment Attachment, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.attachments {
+		if existing.UniqueId != attachment.UniqueId {
+			continue
+		}
+		s.attachments = append(s.attachments[:i], s.attachments[i+1:]...)
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityTransaction,
+			EntityId: attachment.TransactionId,
+			Field:    "attachment",
+			OldValue: attachment.FileName,
+		})
+		return removeAttachmentFile(attachment)
+	}
+
+	return sql.ErrNoRows
+}
+
+// ReadAuditLog applies the filter in the same way as the SQL query in ReadAuditLog, newest entries first.
+func (s *MemoryStore) ReadAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []AuditEntry{}
+	for i := len(s.auditLog) - 1; i >= 0; i-- {
+		entry := s.auditLog[i]
+		if (filter.Entity != "" && entry.Entity != filter.Entity) ||
+			(filter.EntityId != "" && entry.EntityId != filter.EntityId) ||
+			(filter.Actor != "" && entry.Actor != filter.Actor) ||
+			(filter.Field != "" && entry.Field != filter.Field) ||
+			(filter.From != "" && entry.Timestamp < filter.From) ||
+			(filter.To != "" && entry.Timestamp[:len("2006-01-02")] > filter.To) {
+			continue
+		}
+		entries = append(entries, entry)
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *MemoryStore) ReadAuditActors() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := make(map[string]bool)
+	actors := []string{}
+	for _, entry := range s.auditLog {
+		if !found[entry.Actor] {
+			found[entry.Actor] = true
+			actors = append(actors, entry.Actor)
+		}
+	}
+	sort.Strings(actors)
+
+	return actors, nil
+}
+
+func (s *MemoryStore) ReadTrashedTransactions() ([]TrashedTransaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	trashed := []TrashedTransaction{}
+	for _, transaction := range s.transactions {
+		if deletedAt, ok := s.deletedAt[transaction.UniqueId]; ok {
+			trashed = append(trashed, TrashedTransaction{Transaction: s.readTransaction(transaction), DeletedAt: deletedAt})
+		}
+	}
+	sort.SliceStable(trashed, func(i, j int) bool {
+		return trashed[i].DeletedAt > trashed[j].DeletedAt
+	})
+
+	return trashed, nil
+}
+
+func (s *MemoryStore) ReadTrashedUploads() ([]TrashedUpload, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	trashed := []TrashedUpload{}
+	for _, upload := range s.uploads {
+		deletedAt, ok := s.uploadDeletedAt[upload.UniqueId]
+		if !ok {
+			continue
+		}
+		numTransactions := len(s.uploadTransactionIds(upload.UniqueId, deletedAt))
+		trashed = append(trashed, TrashedUpload{TransactionHistory: upload, DeletedAt: deletedAt, NumTransactions: numTransactions})
+	}
+	sort.SliceStable(trashed, func(i, j int) bool {
+		return trashed[i].DeletedAt > trashed[j].DeletedAt
+	})
+
+	return trashed, nil
+}
+
+// uploadTransactionIds returns the ids of the transactions from an upload that were trashed at deletedAt, or that are
+// not in the trash when deletedAt is empty.
+func (s *MemoryStore) uploadTransactionIds(uploadId string, deletedAt string) (transactionIds []string) {
+	for _, transaction := range s.transactions {
+		if strconv.FormatInt(s.uploadIds[transaction.UniqueId], 10) != uploadId {
+			continue
+		}
+		if s.deletedAt[transaction.UniqueId] == deletedAt {
+			transactionIds = append(transactionIds, transaction.UniqueId)
+		}
+	}
+	return transactionIds
+}
+
+// uploadDeleted looks up whether an upload exists and when it was trashed, which is empty when it is not in the trash.
+func (s *MemoryStore) uploadDeleted(uploadId int) (deletedAt string, found bool) {
+	for _, upload := range s.uploads {
+		if upload.UniqueId == strconv.Itoa(uploadId) {
+			return s.uploadDeletedAt[upload.UniqueId], true
+		}
+	}
+	return "", false
+}
+
+// SoftDeleteUpload trashes the upload together with its transactions under the same deleted_at, in the same way as
+// the SQLite store.
+func (s *MemoryStore) SoftDeleteUpload(uploadId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deletedAt, found := s.uploadDeleted(uploadId)
+	if !found || deletedAt != "" {
+		return sql.ErrNoRows
+	}
+
+	deletedAt = time.Now().Format("2006-01-02 15:04:05")
+	for _, transactionId := range s.uploadTransactionIds(strconv.Itoa(uploadId), "") {
+		s.deletedAt[transactionId] = deletedAt
+	}
+	s.uploadDeletedAt[strconv.Itoa(uploadId)] = deletedAt
+
+	s.recordAudit(actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "deleted_at", NewValue: "trashed"})
+
+	return nil
+}
+
+func (s *MemoryStore) RestoreUpload(uploadId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deletedAt, found := s.uploadDeleted(uploadId)
+	if !found || deletedAt == "" {
+		return sql.ErrNoRows
+	}
+
+	for _, transactionId := range s.uploadTransactionIds(strconv.Itoa(uploadId), deletedAt) {
+		delete(s.deletedAt, transactionId)
+	}
+	delete(s.uploadDeletedAt, strconv.Itoa(uploadId))
+
+	s.recordAudit(actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "deleted_at", OldValue: "trashed"})
+
+	return nil
+}
+
+// purgeTransaction removes a trashed transaction together with its attachment records and transfer links, returning
+// sql.ErrNoRows when it is not in the trash. The split lines are stored on the transaction and go with it.
+func (s *MemoryStore) purgeTransaction(transactionId string) error {
+	i, found := s.findTransaction(transactionId)
+	if _, trashed := s.deletedAt[transactionId]; !found || !trashed {
+		return sql.ErrNoRows
+	}
+	s.transactions = append(s.transactions[:i], s.transactions[i+1:]...)
+	delete(s.deletedAt, transactionId)
+	delete(s.uploadIds, transactionId)
+	delete(s.payeeIds, transactionId)
+
+	attachments := []Attachment{}
+	for _, attachment := range s.attachments {
+		if attachment.TransactionId != transactionId {
+			attachments = append(attachments, attachment)
+		}
+	}
+	s.attachments = attachments
+
+	links := []memoryTransferLink{}
+	for _, link := range s.transferLinks {
+		if link.debitId != transactionId && link.creditId != transactionId {
+			links = append(links, link)
+		}
+	}
+	s.transferLinks = links
+
+	return nil
+}
+
+func (s *MemoryStore) PurgeTransaction(transactionId string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.purgeTransaction(transactionId)
+	if err != nil {
+		return err
+	}
+
+	s.recordAudit(actor, AuditEntry{Entity: auditEntityTransaction, EntityId: transactionId, Field: "*", OldValue: "purged from trash"})
+
+	removeAttachmentFiles(transactionId)
+	return nil
+}
+
+// PurgeUpload keeps the transactions from the upload that were restored on their own and unlinks them from it, in
+// the same way as the SQLite store.
+func (s *MemoryStore) PurgeUpload(uploadId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deletedAt, found := s.uploadDeleted(uploadId)
+	if !found || deletedAt == "" {
+		return sql.ErrNoRows
+	}
+
+	transactionIds := []string{}
+	for _, transaction := range s.transactions {
+		if _, trashed := s.deletedAt[transaction.UniqueId]; trashed && s.uploadIds[transaction.UniqueId] == int64(uploadId) {
+			transactionIds = append(transactionIds, transaction.UniqueId)
+		}
+	}
+	for _, transactionId := range transactionIds {
+		err := s.purgeTransaction(transactionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	for transactionId, transactionUploadId := range s.uploadIds {
+		if transactionUploadId == int64(uploadId) {
+			delete(s.uploadIds, transactionId)
+		}
+	}
+	for i, upload := range s.uploads {
+		if upload.UniqueId == strconv.Itoa(uploadId) {
+			s.uploads = append(s.uploads[:i], s.uploads[i+1:]...)
+			break
+		}
+	}
+	delete(s.uploadDeletedAt, strconv.Itoa(uploadId))
+
+	s.recordAudit(actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "*", OldValue: "purged from trash"})
+
+	removeAttachmentFiles(transactionIds...)
+	return nil
+}
+
+func (s *MemoryStore) RestoreTransaction(transactionId string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, trashed := s.deletedAt[transactionId]; !trashed {
+		return sql.ErrNoRows
+	}
+	delete(s.deletedAt, transactionId)
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "deleted_at",
+		OldValue: "trashed",
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) ReadTransferLinks() ([]TransferLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	transactionsById := make(map[string]Transaction)
+	for _, transaction := range s.liveTransactions() {
+		transactionsById[transaction.UniqueId] = transaction
+	}
+
+	links := []TransferLink{}
+	for _, link := range s.transferLinks {
+		if link.status == transferStatusRejected {
+			continue
+		}
+
+		// Links where either side is in the trash are hidden until the transaction is restored:
+		debitTransaction, debitFound := transactionsById[link.debitId]
+		creditTransaction, creditFound := transactionsById[link.creditId]
+		if !debitFound || !creditFound {
+			continue
+		}
+
+		links = append(links, TransferLink{
+			UniqueId:          link.uniqueId,
+			DebitTransaction:  debitTransaction,
+			CreditTransaction: creditTransaction,
+			Status:            link.status,
+			DateDetected:      link.dateDetected,
+		})
+	}
+
+	return links, nil
+}
+
+func (s *MemoryStore) DetectTransferCandidates(windowDays int, actor string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.detectTransferCandidates(windowDays, actor), nil
+}
+
+// detectTransferCandidates stores the new transfer pairs in the same way as DetectTransferCandidates. The caller
+// holds the write lock.
+func (s *MemoryStore) detectTransferCandidates(windowDays int, actor string) int {
+	linkedIds := make(map[string]bool)
+	rejectedPairs := make(map[[2]string]bool)
+	linkedPairs := make(map[[2]string]bool)
+	nextId := 1
+	for _, link := range s.transferLinks {
+		if link.status == transferStatusRejected {
+			rejectedPairs[[2]string{link.debitId, link.creditId}] = true
+		} else {
+			linkedIds[link.debitId] = true
+			linkedIds[link.creditId] = true
+		}
+		linkedPairs[[2]string{link.debitId, link.creditId}] = true
+		if link.uniqueId >= nextId {
+			nextId = link.uniqueId + 1
+		}
+	}
+
+	detected := 0
+	detectedTime := time.Now().Format("2006-01-02 15:04:05")
+	for _, pair := range findTransferPairs(s.liveTransactions(), linkedIds, rejectedPairs, windowDays) {
+		if linkedPairs[[2]string{pair[0].UniqueId, pair[1].UniqueId}] {
+			continue
+		}
+		s.transferLinks = append(s.transferLinks, memoryTransferLink{
+			uniqueId:     nextId,
+			debitId:      pair[0].UniqueId,
+			creditId:     pair[1].UniqueId,
+			status:       transferStatusCandidate,
+			dateDetected: detectedTime,
+		})
+		nextId++
+		detected++
+	}
+
+	if detected > 0 {
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityTransfer,
+			EntityId: "*",
+			Field:    "status",
+			NewValue: fmt.Sprintf("%d new candidates", detected),
+		})
+	}
+
+	return detected
+}
+
+func (s *MemoryStore) UpdateTransferStatus(linkId int, status string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.transferLinks {
+		link := &s.transferLinks[i]
+		if link.uniqueId != linkId {
+			continue
+		}
+		if status == transferStatusConfirmed && s.confirmedTransferConflicts(*link) {
+			return errTransferConflict
+		}
+		oldStatus := link.status
+		link.status = status
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityTransfer,
+			EntityId: strconv.Itoa(linkId),
+			Field:    "status",
+			OldValue: oldStatus,
+			NewValue: status,
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+// confirmedTransferConflicts reports whether either side of the link is already part of another confirmed transfer.
+// The caller holds the lock.
+func (s *MemoryStore) confirmedTransferConflicts(link memoryTransferLink) bool {
+	for _, other := range s.transferLinks {
+		if other.uniqueId == link.uniqueId || other.status != transferStatusConfirmed {
+			continue
+		}
+		for _, id := range []string{other.debitId, other.creditId} {
+			if id == link.debitId || id == link.creditId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) ReadPayees() ([]Payee, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payees := []Payee{}
+	for _, payee := range s.payees {
+		payee.Aliases = append([]PayeeAlias(nil), payee.Aliases...)
+		payees = append(payees, payee)
+	}
+	sort.SliceStable(payees, func(i, j int) bool {
+		return payees[i].Name < payees[j].Name
+	})
+
+	return payees, nil
+}
+
+func (s *MemoryStore) AddPayeeAlias(name string, pattern string, actor string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payeeIndex := -1
+	nextPayeeId, nextAliasId := 1, 1
+	for i, payee := range s.payees {
+		if payee.Name == name {
+			payeeIndex = i
+		}
+		if payee.UniqueId >= nextPayeeId {
+			nextPayeeId = payee.UniqueId + 1
+		}
+		for _, alias := range payee.Aliases {
+			if alias.UniqueId >= nextAliasId {
+				nextAliasId = alias.UniqueId + 1
+			}
+		}
+	}
+	if payeeIndex == -1 {
+		s.payees = append(s.payees, Payee{UniqueId: nextPayeeId, Name: name})
+		payeeIndex = len(s.payees) - 1
+	}
+
+	payee := &s.payees[payeeIndex]
+	duplicate := false
+	for _, alias := range payee.Aliases {
+		duplicate = duplicate || alias.Pattern == pattern
+	}
+	if !duplicate {
+		payee.Aliases = append(payee.Aliases, PayeeAlias{UniqueId: nextAliasId, PayeeId: payee.UniqueId, Pattern: pattern})
+	}
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: strconv.Itoa(payee.UniqueId),
+		Field:    "alias",
+		NewValue: name + ": " + pattern,
+	})
+
+	return int64(payee.UniqueId), nil
+}
+
+func (s *MemoryStore) DeletePayeeAlias(aliasId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.payees {
+		payee := &s.payees[i]
+		for j, alias := range payee.Aliases {
+			if alias.UniqueId != aliasId {
+				continue
+			}
+			payee.Aliases = append(payee.Aliases[:j], payee.Aliases[j+1:]...)
+
+			s.recordAudit(actor, AuditEntry{
+				Entity:   auditEntityPayee,
+				EntityId: strconv.Itoa(payee.UniqueId),
+				Field:    "alias",
+				OldValue: alias.Pattern,
+			})
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) DeletePayee(payeeId int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, payee := range s.payees {
+		if payee.UniqueId != payeeId {
+			continue
+		}
+		s.payees = append(s.payees[:i], s.payees[i+1:]...)
+		for transactionId, transactionPayeeId := range s.payeeIds {
+			if transactionPayeeId == payeeId {
+				delete(s.payeeIds, transactionId)
+			}
+		}
+
+		s.recordAudit(actor, AuditEntry{
+			Entity:   auditEntityPayee,
+			EntityId: strconv.Itoa(payeeId),
+			Field:    "*",
+			OldValue: payee.Name,
+		})
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) ApplyPayeeAliases(onlyUnassigned bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.applyPayeeAliases(onlyUnassigned)
+}
+
+func (s *MemoryStore) ReapplyPayeeAliases(actor string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	numAssigned, err := s.applyPayeeAliases(false)
+	if err != nil {
+		return 0, err
+	}
+
+	s.recordAudit(actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: "*",
+		Field:    "assignments",
+		NewValue: fmt.Sprintf("re-applied aliases to all transactions, %d matched", numAssigned),
+	})
+
+	return numAssigned, nil
+}
+
+// applyPayeeAliases assigns payees in the same way as the SQLite applyPayeeAliases, including to transactions in the
+// trash. The caller holds the write lock.
+func (s *MemoryStore) applyPayeeAliases(onlyUnassigned bool) (int, error) {
+	aliases := []PayeeAlias{}
+	for _, payee := range s.payees {
+		aliases = append(aliases, payee.Aliases...)
+	}
+	sort.SliceStable(aliases, func(i, j int) bool {
+		return aliases[i].UniqueId < aliases[j].UniqueId
+	})
+
+	compiledAliases := []compiledAlias{}
+	for _, alias := range aliases {
+		compiled, err := compileAlias(alias)
+		if err != nil {
+			return 0, err
+		}
+		compiledAliases = append(compiledAliases, compiled)
+	}
+
+	numAssigned := 0
+	for _, transaction := range s.transactions {
+		if _, assigned := s.payeeIds[transaction.UniqueId]; assigned && onlyUnassigned {
+			continue
+		}
+
+		payeeId, matched := matchPayee(compiledAliases, transaction.Description)
+		if matched {
+			s.payeeIds[transaction.UniqueId] = payeeId
+			numAssigned++
+		} else if !onlyUnassigned {
+			delete(s.payeeIds, transaction.UniqueId)
+		}
+	}
+
+	return numAssigned, nil
+}
+
+// SearchTransactions matches every word against the description, payee name and split notes in the same way as the
+// LIKE search of the SQLite store, so matches are ordered by date.
+func (s *MemoryStore) SearchTransactions(filter SearchFilter) ([]Transaction, error) {
+	for _, bound := range []struct{ raw, name string }{{filter.From, "from"}, {filter.To, "to"}} {
+		if bound.raw == "" {
+			continue
+		}
+		_, err := time.Parse("2006-01-02", bound.raw)
+		if err != nil {
+			return nil, fmt.Errorf("the %s date must be in the format YYYY-MM-DD", bound.name)
+		}
+	}
+	minAmount, err := parseFormAmount(filter.MinAmount, "minimum")
+	if err != nil {
+		return nil, err
+	}
+	maxAmount, err := parseFormAmount(filter.MaxAmount, "maximum")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	words := strings.Fields(strings.ToLower(filter.Query))
+	transactions := []Transaction{}
+	for _, transaction := range s.liveTransactions() {
+		date := transaction.Date.Format("2006-01-02")
+		if (filter.From != "" && date < filter.From) || (filter.To != "" && date > filter.To) {
+			continue
+		}
+
+		// Only one of debit and credit is ever set so their sum is the unsigned amount of the transaction:
+		amount := transaction.Debit + transaction.Credit
+		if (filter.MinAmount != "" && amount < minAmount) || (filter.MaxAmount != "" && amount > maxAmount) {
+			continue
+		}
+
+		searchable := []string{strings.ToLower(transaction.Description), strings.ToLower(transaction.Payee)}
+		for _, split := range transaction.Splits {
+			searchable = append(searchable, strings.ToLower(split.Note))
+		}
+		matchesAll := true
+		for _, word := range words {
+			matchesWord := false
+			for _, text := range searchable {
+				matchesWord = matchesWord || strings.Contains(text, word)
+			}
+			matchesAll = matchesAll && matchesWord
+		}
+		if matchesAll {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.After(transactions[j].Date)
+	})
+	if len(transactions) > searchResultLimit {
+		transactions = transactions[:searchResultLimit]
+	}
+
+	return transactions, nil
+}
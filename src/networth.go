@@ -0,0 +1,626 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	netWorthKindAsset     = "asset"
+	netWorthKindLiability = "liability"
+
+	// The computed balance of the transaction accounts is shown as its own asset class:
+	cashAssetClass = "Cash"
+)
+
+// Asset classes suggested when adding an account, any other class can be typed in:
+var assetClasses = []string{"Property", "Vehicle", "Retirement", "Investment", "Mortgage", "Loan", "Credit Card"}
+
+// Valuation is the value of an asset, or the amount owed on a liability, as of its date.
+type Valuation struct {
+	UniqueId  int
+	AccountId int
+	Date      time.Time
+	Value     float64
+}
+
+// NetWorthAccount is an asset or liability that is not covered by the imported transactions, e.g. a house or a
+// mortgage, valued by hand from time to time. Valuations are in date order.
+type NetWorthAccount struct {
+	UniqueId   int
+	Name       string
+	Kind       string
+	AssetClass string
+	Valuations []Valuation
+}
+
+func (a NetWorthAccount) IsLiability() bool {
+	return a.Kind == netWorthKindLiability
+}
+
+// ValueAt is the latest valuation on or before date, which is zero before the account's first valuation.
+func (a NetWorthAccount) ValueAt(date time.Time) float64 {
+	value := 0.0
+	for _, valuation := range a.Valuations {
+		if valuation.Date.After(date) {
+			break
+		}
+		value = valuation.Value
+	}
+	return value
+}
+
+// Latest is the account's most recent valuation, if it has any.
+func (a NetWorthAccount) Latest() *Valuation {
+	if len(a.Valuations) == 0 {
+		return nil
+	}
+	return &a.Valuations[len(a.Valuations)-1]
+}
+
+func describeNetWorthAccount(account NetWorthAccount) string {
+	return fmt.Sprintf("%s %s %s", account.Name, account.Kind, account.AssetClass)
+}
+
+func describeValuation(account string, valuation Valuation) string {
+	return fmt.Sprintf("%s %s %.2f", account, valuation.Date.Format("2006-01-02"), valuation.Value)
+}
+
+// NetWorthPoint is the net worth at the end of a month. Liabilities are the amounts owed, so they are subtracted.
+// ByClass holds the value of each asset class, with the liability classes negative.
+type NetWorthPoint struct {
+	Date        time.Time          `json:"date"`
+	Label       string             `json:"label"`
+	Cash        float64            `json:"cash"`
+	Assets      float64            `json:"assets"`
+	Liabilities float64            `json:"liabilities"`
+	NetWorth    float64            `json:"net_worth"`
+	ByClass     map[string]float64 `json:"by_class"`
+}
+
+// BuildNetWorth combines the balance of the transaction accounts at the end of each month, from the monthly series,
+// with the value of every asset and liability at the end of the same month. The months run from the earliest
+// transaction or valuation to the latest, the cash balance carries forward after the last transaction.
+func BuildNetWorth(cash Series, accounts []NetWorthAccount) []NetWorthPoint {
+	var first, last time.Time
+	extend := func(date time.Time) {
+		month := monthStart(date)
+		if first.IsZero() || month.Before(first) {
+			first = month
+		}
+		if month.After(last) {
+			last = month
+		}
+	}
+	for _, point := range cash {
+		extend(point.PeriodStart)
+	}
+	for _, account := range accounts {
+		for _, valuation := range account.Valuations {
+			extend(valuation.Date)
+		}
+	}
+
+	points := []NetWorthPoint{}
+	if first.IsZero() {
+		return points
+	}
+
+	cashBalance, next := 0.0, 0
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		for next < len(cash) && !monthStart(cash[next].PeriodStart).After(month) {
+			cashBalance = cash[next].Balance
+			next++
+		}
+
+		monthEnd := month.AddDate(0, 1, -1)
+		point := NetWorthPoint{
+			Date:    monthEnd,
+			Label:   FrequencyMonth.Label(month),
+			Cash:    cashBalance,
+			Assets:  cashBalance,
+			ByClass: map[string]float64{cashAssetClass: cashBalance},
+		}
+		for _, account := range accounts {
+			value := account.ValueAt(monthEnd)
+			if account.IsLiability() {
+				point.Liabilities += value
+				point.ByClass[account.AssetClass] -= value
+			} else {
+				point.Assets += value
+				point.ByClass[account.AssetClass] += value
+			}
+		}
+		point.NetWorth = point.Assets - point.Liabilities
+
+		points = append(points, point)
+	}
+
+	return points
+}
+
+func ReadNetWorthAccounts(db *sql.DB) (accounts []NetWorthAccount, err error) {
+	rows, err := db.Query("SELECT unique_id, name, kind, asset_class FROM net_worth_accounts ORDER BY kind, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account NetWorthAccount
+		err := rows.Scan(&account.UniqueId, &account.Name, &account.Kind, &account.AssetClass)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	valuationRows, err := db.Query("SELECT unique_id, account_id, date, value FROM valuations ORDER BY date, unique_id")
+	if err != nil {
+		return nil, err
+	}
+	defer valuationRows.Close()
+
+	for valuationRows.Next() {
+		var valuation Valuation
+		var date string
+		err := valuationRows.Scan(&valuation.UniqueId, &valuation.AccountId, &date, &valuation.Value)
+		if err != nil {
+			return nil, err
+		}
+		valuation.Date, err = time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, err
+		}
+		for i := range accounts {
+			if accounts[i].UniqueId == valuation.AccountId {
+				accounts[i].Valuations = append(accounts[i].Valuations, valuation)
+			}
+		}
+	}
+
+	return accounts, valuationRows.Err()
+}
+
+func AddNetWorthAccount(db *sql.DB, account NetWorthAccount, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("INSERT INTO net_worth_accounts(name, kind, asset_class) values(?, ?, ?)",
+		account.Name, account.Kind, account.AssetClass)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	accountId, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityNetWorth,
+		EntityId: strconv.FormatInt(accountId, 10),
+		Field:    "*",
+		NewValue: describeNetWorthAccount(account),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteNetWorthAccount removes an account together with its valuations, returning sql.ErrNoRows when it does not
+// exist.
+func DeleteNetWorthAccount(db *sql.DB, accountId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var account NetWorthAccount
+	err = tx.QueryRow("SELECT name, kind, asset_class FROM net_worth_accounts WHERE unique_id = ?", accountId).Scan(
+		&account.Name, &account.Kind, &account.AssetClass)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM valuations WHERE account_id = ?", accountId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM net_worth_accounts WHERE unique_id = ?", accountId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityNetWorth,
+		EntityId: strconv.Itoa(accountId),
+		Field:    "*",
+		OldValue: describeNetWorthAccount(account),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveValuation records the value of an account on a date, replacing any valuation of the account on the same date.
+// It returns sql.ErrNoRows when the account does not exist.
+func SaveValuation(db *sql.DB, valuation Valuation, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM net_worth_accounts WHERE unique_id = ?", valuation.AccountId).Scan(&name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	oldValue := ""
+	var replacedValue float64
+	err = tx.QueryRow("SELECT value FROM valuations WHERE account_id = ? AND date = ?",
+		valuation.AccountId, valuation.Date.Format("2006-01-02")).Scan(&replacedValue)
+	if err == nil {
+		oldValue = fmt.Sprintf("%.2f", replacedValue)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO valuations(account_id, date, value) values(?, ?, ?)
+		ON CONFLICT(account_id, date) DO UPDATE SET value = excluded.value`,
+		valuation.AccountId, valuation.Date.Format("2006-01-02"), valuation.Value)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityNetWorth,
+		EntityId: strconv.Itoa(valuation.AccountId),
+		Field:    "valuation " + valuation.Date.Format("2006-01-02"),
+		OldValue: oldValue,
+		NewValue: describeValuation(name, valuation),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteValuation removes a valuation, returning sql.ErrNoRows when it does not exist.
+func DeleteValuation(db *sql.DB, valuationId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var name, date string
+	var valuation Valuation
+	err = tx.QueryRow(`SELECT valuations.account_id, net_worth_accounts.name, valuations.date, valuations.value
+		FROM valuations JOIN net_worth_accounts ON net_worth_accounts.unique_id = valuations.account_id
+		WHERE valuations.unique_id = ?`, valuationId).Scan(&valuation.AccountId, &name, &date, &valuation.Value)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	valuation.Date, _ = time.Parse("2006-01-02", date)
+
+	_, err = tx.Exec("DELETE FROM valuations WHERE unique_id = ?", valuationId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityNetWorth,
+		EntityId: strconv.Itoa(valuation.AccountId),
+		Field:    "valuation " + date,
+		OldValue: describeValuation(name, valuation),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func parseNetWorthAccountForm(r *http.Request) (account NetWorthAccount, err error) {
+	account.Name = strings.TrimSpace(r.FormValue("name"))
+	if account.Name == "" {
+		return account, fmt.Errorf("an asset or liability needs a name")
+	}
+
+	account.Kind = r.FormValue("kind")
+	if account.Kind != netWorthKindAsset && account.Kind != netWorthKindLiability {
+		return account, fmt.Errorf("unknown kind %q, expected asset or liability", account.Kind)
+	}
+
+	account.AssetClass = strings.TrimSpace(r.FormValue("asset_class"))
+	if account.AssetClass == "" || strings.EqualFold(account.AssetClass, cashAssetClass) {
+		return account, fmt.Errorf("pick a class other than %s, which is the balance of the imported accounts", cashAssetClass)
+	}
+
+	return account, nil
+}
+
+func parseValuationForm(r *http.Request) (valuation Valuation, err error) {
+	valuation.AccountId, err = strconv.Atoi(r.FormValue("account_id"))
+	if err != nil {
+		return valuation, fmt.Errorf("pick the asset or liability the valuation is for")
+	}
+
+	valuation.Date, err = time.Parse("2006-01-02", strings.TrimSpace(r.FormValue("date")))
+	if err != nil {
+		return valuation, fmt.Errorf("the date must be in the format YYYY-MM-DD")
+	}
+
+	// Parsed at full precision as a house or a mortgage is worth more than a float32 holds to the cent:
+	rawValue := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(r.FormValue("value")), "$"))
+	valuation.Value, err = strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return valuation, fmt.Errorf("%q is not a valid value", rawValue)
+	}
+	if valuation.Value < 0 {
+		return valuation, fmt.Errorf("the value cannot be negative, a liability is valued at the amount owed")
+	}
+
+	return valuation, nil
+}
+
+// netWorthChart is the shape the dashboard's net worth chart plots, one dataset per asset class stacked under the
+// net worth line:
+type netWorthChart struct {
+	Labels   []string              `json:"labels"`
+	NetWorth []float64             `json:"net_worth"`
+	Classes  []netWorthClassSeries `json:"classes"`
+}
+
+type netWorthClassSeries struct {
+	Class  string    `json:"class"`
+	Values []float64 `json:"values"`
+}
+
+func buildNetWorthChart(points []NetWorthPoint) netWorthChart {
+	chart := netWorthChart{Labels: []string{}, NetWorth: []float64{}, Classes: []netWorthClassSeries{}}
+
+	classes := []string{}
+	seen := make(map[string]bool)
+	for _, point := range points {
+		chart.Labels = append(chart.Labels, point.Label)
+		chart.NetWorth = append(chart.NetWorth, point.NetWorth)
+		for class := range point.ByClass {
+			if !seen[class] {
+				seen[class] = true
+				classes = append(classes, class)
+			}
+		}
+	}
+
+	// Cash first, then the other classes by name:
+	sort.Slice(classes, func(i, j int) bool {
+		if (classes[i] == cashAssetClass) != (classes[j] == cashAssetClass) {
+			return classes[i] == cashAssetClass
+		}
+		return classes[i] < classes[j]
+	})
+	for _, class := range classes {
+		series := netWorthClassSeries{Class: class}
+		for _, point := range points {
+			series.Values = append(series.Values, point.ByClass[class])
+		}
+		chart.Classes = append(chart.Classes, series)
+	}
+
+	return chart
+}
+
+// buildNetWorth reads the transactions, balances and net worth accounts behind the net worth timeseries.
+func (h *storeHandlers) buildNetWorth() ([]NetWorthAccount, []NetWorthPoint, error) {
+	accounts, err := h.netWorth.ReadNetWorthAccounts()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		return nil, nil, err
+	}
+	budget, err := h.loadBudget(TransactionFilter{}, transactions, FrequencyMonth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return accounts, BuildNetWorth(budget.Series(), accounts), nil
+}
+
+type netWorthPageContent struct {
+	Accounts     []NetWorthAccount
+	AssetClasses []string
+	Latest       *NetWorthPoint
+	Error        string
+}
+
+func (h *storeHandlers) renderNetWorth(w http.ResponseWriter, templateName string, content netWorthPageContent) {
+	accounts, points, err := h.buildNetWorth()
+	if err != nil {
+		log.Println("Unable to build the net worth:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content.Accounts = accounts
+	content.AssetClasses = assetClasses
+	if len(points) > 0 {
+		content.Latest = &points[len(points)-1]
+	}
+
+	tmpl, err := template.ParseFiles("../templates/net_worth.html")
+	if err != nil {
+		log.Fatal("Unable to load the net_worth.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, content)
+	if err != nil {
+		log.Println("Unable to render the net worth template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// netWorthHandler lists, adds and removes the assets and liabilities and their valuations.
+func (h *storeHandlers) netWorthHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.renderNetWorth(w, "net_worth.html", netWorthPageContent{})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := netWorthPageContent{}
+	switch r.FormValue("action") {
+	case "add":
+		account, err := parseNetWorthAccountForm(r)
+		if err != nil {
+			content.Error = err.Error()
+			break
+		}
+
+		existing, err := h.netWorth.ReadNetWorthAccounts()
+		if err != nil {
+			log.Println("Unable to query the net worth accounts:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, other := range existing {
+			if strings.EqualFold(other.Name, account.Name) {
+				content.Error = fmt.Sprintf("there is already an account named %s", other.Name)
+			}
+		}
+		if content.Error != "" {
+			break
+		}
+
+		err = h.netWorth.AddNetWorthAccount(account, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to add the net worth account:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "value":
+		valuation, err := parseValuationForm(r)
+		if err != nil {
+			content.Error = err.Error()
+			break
+		}
+
+		err = h.netWorth.SaveValuation(valuation, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to save the valuation:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "delete", "delete_valuation":
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		if r.FormValue("action") == "delete" {
+			err = h.netWorth.DeleteNetWorthAccount(id, actorFromRequest(r))
+		} else {
+			err = h.netWorth.DeleteValuation(id, actorFromRequest(r))
+		}
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to delete from the net worth:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	h.renderNetWorth(w, "netWorthContent", content)
+}
+
+// netWorthChartHandler renders the dashboard's net worth chart.
+func (h *storeHandlers) netWorthChartHandler(w http.ResponseWriter, r *http.Request) {
+	_, points, err := h.buildNetWorth()
+	if err != nil {
+		log.Println("Unable to build the net worth:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	chartJSON, err := json.Marshal(buildNetWorthChart(points))
+	if err != nil {
+		log.Println("Unable to encode the net worth chart:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content := struct {
+		ChartJSON template.JS
+		Latest    *NetWorthPoint
+	}{ChartJSON: template.JS(chartJSON)}
+	if len(points) > 0 {
+		content.Latest = &points[len(points)-1]
+	}
+
+	tmpl, err := template.ParseFiles("../templates/index.html")
+	if err != nil {
+		log.Fatal("Unable to load the index.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "netWorthChart", content)
+	if err != nil {
+		log.Println("Unable to render the net worth chart: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildNetWorth(t *testing.T) {
+	// February has no transactions, so its cash balance is January's:
+	cash := Series{
+		{PeriodStart: testDate("2023-01-01"), Balance: 1000},
+		{PeriodStart: testDate("2023-03-01"), Balance: 1500},
+	}
+	house := NetWorthAccount{Name: "House", Kind: netWorthKindAsset, AssetClass: "Property", Valuations: []Valuation{
+		{Date: testDate("2022-12-15"), Value: 300000},
+		{Date: testDate("2023-05-10"), Value: 310000},
+	}}
+	mortgage := NetWorthAccount{Name: "Mortgage", Kind: netWorthKindLiability, AssetClass: "Mortgage", Valuations: []Valuation{
+		{Date: testDate("2023-01-31"), Value: 200000},
+		{Date: testDate("2023-03-31"), Value: 198000},
+	}}
+
+	tests := []struct {
+		name     string
+		cash     Series
+		accounts []NetWorthAccount
+		want     []NetWorthPoint
+	}{
+		{
+			name:     "cash, assets and liabilities",
+			cash:     cash,
+			accounts: []NetWorthAccount{house, mortgage},
+			// The months run from the first valuation to the last, with the cash carried forward after March:
+			want: []NetWorthPoint{
+				{Label: "2022-12", Cash: 0, Assets: 300000, Liabilities: 0, NetWorth: 300000,
+					ByClass: map[string]float64{"Cash": 0, "Property": 300000, "Mortgage": 0}},
+				{Label: "2023-01", Cash: 1000, Assets: 301000, Liabilities: 200000, NetWorth: 101000,
+					ByClass: map[string]float64{"Cash": 1000, "Property": 300000, "Mortgage": -200000}},
+				{Label: "2023-02", Cash: 1000, Assets: 301000, Liabilities: 200000, NetWorth: 101000,
+					ByClass: map[string]float64{"Cash": 1000, "Property": 300000, "Mortgage": -200000}},
+				{Label: "2023-03", Cash: 1500, Assets: 301500, Liabilities: 198000, NetWorth: 103500,
+					ByClass: map[string]float64{"Cash": 1500, "Property": 300000, "Mortgage": -198000}},
+				{Label: "2023-04", Cash: 1500, Assets: 301500, Liabilities: 198000, NetWorth: 103500,
+					ByClass: map[string]float64{"Cash": 1500, "Property": 300000, "Mortgage": -198000}},
+				{Label: "2023-05", Cash: 1500, Assets: 311500, Liabilities: 198000, NetWorth: 113500,
+					ByClass: map[string]float64{"Cash": 1500, "Property": 310000, "Mortgage": -198000}},
+			},
+		},
+		{
+			name: "cash only",
+			cash: cash,
+			want: []NetWorthPoint{
+				{Label: "2023-01", Cash: 1000, Assets: 1000, NetWorth: 1000, ByClass: map[string]float64{"Cash": 1000}},
+				{Label: "2023-02", Cash: 1000, Assets: 1000, NetWorth: 1000, ByClass: map[string]float64{"Cash": 1000}},
+				{Label: "2023-03", Cash: 1500, Assets: 1500, NetWorth: 1500, ByClass: map[string]float64{"Cash": 1500}},
+			},
+		},
+		{
+			name:     "an account without valuations",
+			accounts: []NetWorthAccount{{Name: "Car", Kind: netWorthKindAsset, AssetClass: "Vehicle"}},
+			want:     []NetWorthPoint{},
+		},
+	}
+
+	for _, test := range tests {
+		points := BuildNetWorth(test.cash, test.accounts)
+		if len(points) != len(test.want) {
+			t.Errorf("%s: built %d months, want %d", test.name, len(points), len(test.want))
+			continue
+		}
+		for i, point := range points {
+			// Every point is dated to the last day of its month:
+			if want := monthStart(point.Date).AddDate(0, 1, -1); !point.Date.Equal(want) {
+				t.Errorf("%s: %s is dated %s, want %s", test.name, point.Label, point.Date.Format("2006-01-02"), want.Format("2006-01-02"))
+			}
+			point.Date = test.want[i].Date
+			if !reflect.DeepEqual(point, test.want[i]) {
+				t.Errorf("%s: %+v, want %+v", test.name, point, test.want[i])
+			}
+		}
+	}
+}
+
+func TestNetWorthAccountValueAt(t *testing.T) {
+	account := NetWorthAccount{Valuations: []Valuation{
+		{Date: testDate("2023-01-15"), Value: 100},
+		{Date: testDate("2023-03-01"), Value: 120},
+	}}
+
+	tests := []struct {
+		date string
+		want float64
+	}{
+		{"2023-01-14", 0},
+		{"2023-01-15", 100},
+		{"2023-02-28", 100},
+		{"2023-03-01", 120},
+		{"2024-01-01", 120},
+	}
+
+	for _, test := range tests {
+		if value := account.ValueAt(testDate(test.date)); value != test.want {
+			t.Errorf("ValueAt(%s) = %v, want %v", test.date, value, test.want)
+		}
+	}
+}
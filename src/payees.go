@@ -0,0 +1,530 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Payee is the canonical merchant that one or more raw transaction descriptions map to.
+type Payee struct {
+	UniqueId int
+	Name     string
+	Aliases  []PayeeAlias
+}
+
+// PayeeAlias is a case-insensitive pattern matched anywhere in a raw description. A "*" in the pattern matches any
+// run of characters, so "SQ *BLUE BOTTLE*" and "BLUE BOTTLE" are both valid aliases.
+type PayeeAlias struct {
+	UniqueId int
+	PayeeId  int
+	Pattern  string
+}
+
+type compiledAlias struct {
+	PayeeAlias
+	expression *regexp.Regexp
+}
+
+// Collapses whitespace and upper-cases a raw description so aliases do not need to account for bank formatting:
+func normalizeDescription(description string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(description)), " ")
+}
+
+func compileAlias(alias PayeeAlias) (compiledAlias, error) {
+	parts := strings.Split(normalizeDescription(alias.Pattern), "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+
+	expression, err := regexp.Compile(strings.Join(parts, ".*"))
+	if err != nil {
+		return compiledAlias{}, err
+	}
+
+	return compiledAlias{PayeeAlias: alias, expression: expression}, nil
+}
+
+// matchPayee returns the payee id of the alias matching the description. When several aliases match the longest
+// pattern wins as it is the most specific.
+func matchPayee(aliases []compiledAlias, description string) (payeeId int, matched bool) {
+	normalized := normalizeDescription(description)
+
+	bestLength := -1
+	for _, alias := range aliases {
+		if len(alias.Pattern) > bestLength && alias.expression.MatchString(normalized) {
+			payeeId = alias.PayeeId
+			bestLength = len(alias.Pattern)
+			matched = true
+		}
+	}
+
+	return payeeId, matched
+}
+
+func ReadPayees(db *sql.DB) (payees []Payee, err error) {
+	rows, err := db.Query("SELECT unique_id, name FROM payees ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	payeesById := make(map[int]int)
+	for rows.Next() {
+		var payee Payee
+		err := rows.Scan(&payee.UniqueId, &payee.Name)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		payeesById[payee.UniqueId] = len(payees)
+		payees = append(payees, payee)
+	}
+	rows.Close()
+
+	aliases, err := ReadPayeeAliases(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range aliases {
+		index := payeesById[alias.PayeeId]
+		payees[index].Aliases = append(payees[index].Aliases, alias)
+	}
+
+	return payees, nil
+}
+
+func ReadPayeeAliases(db *sql.DB) (aliases []PayeeAlias, err error) {
+	rows, err := db.Query("SELECT unique_id, payee_id, pattern FROM payee_aliases ORDER BY unique_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias PayeeAlias
+		err := rows.Scan(&alias.UniqueId, &alias.PayeeId, &alias.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, rows.Err()
+}
+
+// AddPayeeAlias creates the payee if it does not already exist, adds the alias to it and returns the payee id.
+func AddPayeeAlias(db *sql.DB, name string, pattern string, actor string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO payees(name) values(?)", name)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var payeeId int64
+	err = tx.QueryRow("SELECT unique_id FROM payees WHERE name = ?", name).Scan(&payeeId)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO payee_aliases(payee_id, pattern) values(?, ?)", payeeId, pattern)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: strconv.FormatInt(payeeId, 10),
+		Field:    "alias",
+		NewValue: name + ": " + pattern,
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return payeeId, tx.Commit()
+}
+
+// DeletePayeeAlias removes an alias, returning sql.ErrNoRows when it does not exist.
+func DeletePayeeAlias(db *sql.DB, aliasId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var payeeId, pattern string
+	err = tx.QueryRow("SELECT payee_id, pattern FROM payee_aliases WHERE unique_id = ?", aliasId).Scan(&payeeId, &pattern)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM payee_aliases WHERE unique_id = ?", aliasId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: payeeId,
+		Field:    "alias",
+		OldValue: pattern,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeletePayee removes a payee and its aliases and clears it from every transaction it was assigned to. It returns
+// sql.ErrNoRows when the payee does not exist.
+func DeletePayee(db *sql.DB, payeeId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM payees WHERE unique_id = ?", payeeId).Scan(&name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, query := range []string{
+		"UPDATE transactions SET payee_id = NULL WHERE payee_id = ?",
+		"DELETE FROM payee_aliases WHERE payee_id = ?",
+		"DELETE FROM payees WHERE unique_id = ?",
+	} {
+		_, err = tx.Exec(query, payeeId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: strconv.Itoa(payeeId),
+		Field:    "*",
+		OldValue: name,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ApplyPayeeAliases matches transaction descriptions against every alias and stores the resulting payee. On import
+// only transactions without a payee are touched. Re-applying to all transactions also clears payees whose alias has
+// since been removed. Returns the number of transactions that were assigned a payee.
+func ApplyPayeeAliases(db *sql.DB, onlyUnassigned bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	numAssigned, err := applyPayeeAliases(tx, onlyUnassigned)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return numAssigned, tx.Commit()
+}
+
+// ReapplyPayeeAliases re-applies every alias to all transactions and records the re-assignment in the audit log.
+func ReapplyPayeeAliases(db *sql.DB, actor string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	numAssigned, err := applyPayeeAliases(tx, false)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: "*",
+		Field:    "assignments",
+		NewValue: fmt.Sprintf("re-applied aliases to all transactions, %d matched", numAssigned),
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return numAssigned, tx.Commit()
+}
+
+func applyPayeeAliases(tx *sql.Tx, onlyUnassigned bool) (int, error) {
+	rows, err := tx.Query("SELECT unique_id, payee_id, pattern FROM payee_aliases ORDER BY unique_id")
+	if err != nil {
+		return 0, err
+	}
+	compiledAliases := []compiledAlias{}
+	for rows.Next() {
+		var alias PayeeAlias
+		err := rows.Scan(&alias.UniqueId, &alias.PayeeId, &alias.Pattern)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		compiled, err := compileAlias(alias)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		compiledAliases = append(compiledAliases, compiled)
+	}
+	rows.Close()
+
+	query := "SELECT unique_id, description FROM transactions"
+	if onlyUnassigned {
+		query += " WHERE payee_id IS NULL"
+	}
+	rows, err = tx.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	assignments := make(map[string]sql.NullInt64)
+	for rows.Next() {
+		var transactionId string
+		var description sql.NullString
+		err := rows.Scan(&transactionId, &description)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		payeeId, matched := matchPayee(compiledAliases, description.String)
+		assignments[transactionId] = sql.NullInt64{Int64: int64(payeeId), Valid: matched}
+	}
+	rows.Close()
+
+	stmt, err := tx.Prepare("UPDATE transactions SET payee_id = ? WHERE unique_id = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	numAssigned := 0
+	for transactionId, payeeId := range assignments {
+		if !payeeId.Valid && onlyUnassigned {
+			continue
+		}
+		_, err = stmt.Exec(payeeId, transactionId)
+		if err != nil {
+			return 0, err
+		}
+		if payeeId.Valid {
+			numAssigned++
+		}
+	}
+
+	return numAssigned, nil
+}
+
+type payeeTotal struct {
+	Payee           string
+	NumTransactions int
+	Spent, Received float64
+	LastTransaction string
+}
+
+// Builds the per-payee spending totals. Transactions without a payee are grouped under their raw description so the
+// most common unmatched merchants are easy to spot and alias.
+func buildPayeeTotals(transactions []Transaction) (matched []payeeTotal, unmatched []payeeTotal) {
+	matchedTotals := make(map[string]*payeeTotal)
+	unmatchedTotals := make(map[string]*payeeTotal)
+
+	for _, transaction := range transactions {
+		if transaction.IsTransfer {
+			continue
+		}
+
+		totals, key := matchedTotals, transaction.Payee
+		if transaction.Payee == "" {
+			totals, key = unmatchedTotals, normalizeDescription(transaction.Description)
+		}
+
+		total, ok := totals[key]
+		if !ok {
+			total = &payeeTotal{Payee: key}
+			totals[key] = total
+		}
+		total.NumTransactions++
+		total.Spent += float64(transaction.Debit)
+		total.Received += float64(transaction.Credit)
+		if date := transaction.Date.Format("2006-01-02"); date > total.LastTransaction {
+			total.LastTransaction = date
+		}
+	}
+
+	for _, total := range matchedTotals {
+		matched = append(matched, *total)
+	}
+	for _, total := range unmatchedTotals {
+		unmatched = append(unmatched, *total)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Spent > matched[j].Spent
+	})
+	sort.Slice(unmatched, func(i, j int) bool {
+		return unmatched[i].NumTransactions > unmatched[j].NumTransactions
+	})
+
+	return matched, unmatched
+}
+
+type payeesPageContent struct {
+	Payees     []Payee
+	Totals     []payeeTotal
+	Unmatched  []payeeTotal
+	NumApplied int
+	Error      string
+}
+
+func (h *storeHandlers) renderPayees(w http.ResponseWriter, templateName string, content payeesPageContent) {
+	payees, err := h.payees.ReadPayees()
+	if err != nil {
+		log.Println("Unable to query the payees:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		log.Println("Unable to extract all transactions from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content.Payees = payees
+	content.Totals, content.Unmatched = buildPayeeTotals(transactions)
+
+	tmpl, err := template.ParseFiles("../templates/payees.html")
+	if err != nil {
+		log.Fatal("Unable to load the payees.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, content)
+	if err != nil {
+		log.Println("Unable to render the payees template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *storeHandlers) payeesHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.renderPayees(w, "payees.html", payeesPageContent{})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := payeesPageContent{}
+	switch r.FormValue("action") {
+	case "addAlias":
+		name := strings.TrimSpace(r.FormValue("name"))
+		pattern := strings.TrimSpace(r.FormValue("pattern"))
+		if name == "" || pattern == "" {
+			content.Error = "A payee name and an alias pattern are both required."
+			break
+		}
+
+		_, err := h.payees.AddPayeeAlias(name, pattern, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to insert the payee alias:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// A new alias is applied straight away to anything it now matches that has no payee yet:
+		content.NumApplied, err = h.payees.ApplyPayeeAliases(true)
+		if err != nil {
+			log.Println("Unable to apply the payee aliases:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "deleteAlias":
+		aliasId, err := strconv.Atoi(r.FormValue("alias_id"))
+		if err != nil {
+			http.Error(w, "Invalid alias_id", http.StatusBadRequest)
+			return
+		}
+
+		err = h.payees.DeletePayeeAlias(aliasId, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to delete the payee alias:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "deletePayee":
+		payeeId, err := strconv.Atoi(r.FormValue("payee_id"))
+		if err != nil {
+			http.Error(w, "Invalid payee_id", http.StatusBadRequest)
+			return
+		}
+
+		err = h.payees.DeletePayee(payeeId, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to delete the payee:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "reapply":
+		var err error
+		content.NumApplied, err = h.payees.ReapplyPayeeAliases(actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to apply the payee aliases:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Unknown payee action", http.StatusBadRequest)
+		return
+	}
+
+	h.renderPayees(w, "payeeContent", content)
+}
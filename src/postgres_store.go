@@ -0,0 +1,2420 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Postgres equivalent of the SQLite schema built by RebuildDatabase. Migrations are applied in order on startup and
+// each one is recorded in schema_migrations, so new ones must only ever be appended to the end of the list.
+var postgresMigrations = []string{
+	// 1: transactions and upload tracking
+	`CREATE TABLE uploaded_files (
+		unique_id BIGSERIAL PRIMARY KEY,
+		filename TEXT,
+		date_uploaded TIMESTAMP NOT NULL,
+		num_rows INTEGER,
+		file_size DOUBLE PRECISION,
+		deleted_at TIMESTAMP
+	);
+	CREATE TABLE payees (
+		unique_id BIGSERIAL PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE transactions (
+		unique_id TEXT PRIMARY KEY,
+		date DATE NOT NULL,
+		description TEXT,
+		debit NUMERIC(14, 2) NOT NULL DEFAULT 0,
+		credit NUMERIC(14, 2) NOT NULL DEFAULT 0,
+		category TEXT NOT NULL DEFAULT 'Uncategorized',
+		account TEXT NOT NULL DEFAULT 'Default',
+		payee_id BIGINT REFERENCES payees(unique_id),
+		upload_id BIGINT REFERENCES uploaded_files(unique_id),
+		deleted_at TIMESTAMP
+	);`,
+
+	// 2: attachments, split lines and payee aliases
+	`CREATE TABLE attachments (
+		unique_id BIGSERIAL PRIMARY KEY,
+		transaction_id TEXT NOT NULL REFERENCES transactions(unique_id),
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		file_size BIGINT,
+		date_uploaded TIMESTAMP NOT NULL
+	);
+	CREATE INDEX idx_attachments_transaction_id ON attachments(transaction_id);
+	CREATE TABLE transaction_splits (
+		unique_id BIGSERIAL PRIMARY KEY,
+		transaction_id TEXT NOT NULL REFERENCES transactions(unique_id),
+		category TEXT NOT NULL,
+		note TEXT,
+		amount NUMERIC(14, 2) NOT NULL
+	);
+	CREATE INDEX idx_transaction_splits_transaction_id ON transaction_splits(transaction_id);
+	CREATE TABLE payee_aliases (
+		unique_id BIGSERIAL PRIMARY KEY,
+		payee_id BIGINT NOT NULL REFERENCES payees(unique_id),
+		pattern TEXT NOT NULL,
+		UNIQUE(payee_id, pattern)
+	);`,
+
+	// 3: append-only audit log
+	`CREATE TABLE audit_log (
+		unique_id BIGSERIAL PRIMARY KEY,
+		entity TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		field TEXT NOT NULL,
+		old_value TEXT,
+		new_value TEXT,
+		actor TEXT NOT NULL,
+		timestamp TIMESTAMP NOT NULL
+	);
+	CREATE INDEX idx_audit_log_entity ON audit_log(entity, entity_id);
+	CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+	CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+		FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();`,
+
+	// 4: transfers between accounts
+	`CREATE TABLE transfer_links (
+		unique_id BIGSERIAL PRIMARY KEY,
+		debit_transaction_id TEXT NOT NULL REFERENCES transactions(unique_id),
+		credit_transaction_id TEXT NOT NULL REFERENCES transactions(unique_id),
+		status TEXT NOT NULL DEFAULT 'candidate',
+		date_detected TIMESTAMP NOT NULL,
+		UNIQUE(debit_transaction_id, credit_transaction_id)
+	);`,
+
+	// 5: date range reads
+	`CREATE INDEX idx_transactions_date ON transactions(date);`,
+
+	// 6: opening and statement balances
+	`CREATE TABLE account_balances (
+		unique_id BIGSERIAL PRIMARY KEY,
+		account TEXT NOT NULL,
+		date DATE NOT NULL,
+		balance NUMERIC(14, 2) NOT NULL,
+		kind TEXT NOT NULL,
+		UNIQUE(account, kind, date)
+	);`,
+
+	// 7: monthly category budgets
+	`CREATE TABLE category_budgets (
+		unique_id BIGSERIAL PRIMARY KEY,
+		category TEXT NOT NULL,
+		month TEXT NOT NULL,
+		amount NUMERIC(14, 2) NOT NULL,
+		carry_forward BOOLEAN NOT NULL DEFAULT FALSE,
+		UNIQUE(category, month)
+	);`,
+
+	// 8: scheduled transactions for the forecast
+	`CREATE TABLE scheduled_transactions (
+		unique_id BIGSERIAL PRIMARY KEY,
+		date DATE NOT NULL,
+		description TEXT NOT NULL,
+		debit NUMERIC(14, 2) NOT NULL DEFAULT 0,
+		credit NUMERIC(14, 2) NOT NULL DEFAULT 0,
+		account TEXT NOT NULL DEFAULT 'Default'
+	);`,
+
+	// 9: anomalies flagged after each import
+	`CREATE TABLE anomalies (
+		unique_id BIGSERIAL PRIMARY KEY,
+		kind TEXT NOT NULL,
+		key TEXT NOT NULL,
+		transaction_id TEXT,
+		summary TEXT NOT NULL,
+		detected_at TIMESTAMP NOT NULL,
+		status TEXT NOT NULL DEFAULT 'open',
+		UNIQUE(kind, key)
+	);`,
+
+	// 10: assets and liabilities valued by hand for the net worth
+	`CREATE TABLE net_worth_accounts (
+		unique_id BIGSERIAL PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		kind TEXT NOT NULL,
+		asset_class TEXT NOT NULL
+	);
+	CREATE TABLE valuations (
+		unique_id BIGSERIAL PRIMARY KEY,
+		account_id BIGINT NOT NULL REFERENCES net_worth_accounts(unique_id) ON DELETE CASCADE,
+		date DATE NOT NULL,
+		value NUMERIC(14, 2) NOT NULL,
+		UNIQUE(account_id, date)
+	);`,
+
+	// 11: savings goals
+	`CREATE TABLE savings_goals (
+		unique_id BIGSERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		target_amount NUMERIC(14, 2) NOT NULL,
+		target_date DATE NOT NULL,
+		account TEXT NOT NULL DEFAULT '',
+		category TEXT NOT NULL DEFAULT ''
+	);`,
+}
+
+// migratePostgres applies every migration that has not been recorded in schema_migrations yet.
+func migratePostgres(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var currentVersion int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&currentVersion)
+	if err != nil {
+		return err
+	}
+
+	for i := currentVersion; i < len(postgresMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(postgresMigrations[i])
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO schema_migrations(version, applied_at) values($1, $2)", i+1, time.Now())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied Postgres migration %d.\n", i+1)
+	}
+
+	return nil
+}
+
+// Columns selected in the same order and as the same text values that scanTransaction reads from SQLite:
+const postgresTransactionColumns = `t.unique_id, to_char(t.date, 'YYYY-MM-DD'), COALESCE(t.description, ''),
+	t.debit::text, t.credit::text, t.category, t.account, COALESCE(p.name, '')`
+
+// PostgresStore keeps a single connection pool open for the lifetime of the server, unlike the SQLite store there
+// is no database file that can be removed from underneath it.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore connects to the database at dsn and brings its schema up to date.
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to Postgres: %w", err)
+	}
+
+	err = migratePostgres(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// readTransactionExtras attaches the split lines and the confirmed transfer flag to each transaction.
+func (s *PostgresStore) readTransactionExtras(transactions []Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(transactions))
+	for i, transaction := range transactions {
+		ids[i] = transaction.UniqueId
+	}
+	idList := pq.Array(ids)
+
+	rows, err := s.db.Query(`SELECT unique_id, transaction_id, category, COALESCE(note, ''), amount::float8
+		FROM transaction_splits WHERE transaction_id = ANY($1::text[]) ORDER BY unique_id`, idList)
+	if err != nil {
+		return err
+	}
+	splits := make(map[string][]TransactionSplit)
+	for rows.Next() {
+		var split TransactionSplit
+		err := rows.Scan(&split.UniqueId, &split.TransactionId, &split.Category, &split.Note, &split.Amount)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		splits[split.TransactionId] = append(splits[split.TransactionId], split)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	rows, err = s.db.Query(`SELECT debit_transaction_id, credit_transaction_id FROM transfer_links
+		WHERE status = $1 AND (debit_transaction_id = ANY($2::text[]) OR credit_transaction_id = ANY($2::text[]))`,
+		transferStatusConfirmed, idList)
+	if err != nil {
+		return err
+	}
+	transferIds := make(map[string]bool)
+	for rows.Next() {
+		var debitId, creditId string
+		err := rows.Scan(&debitId, &creditId)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		transferIds[debitId] = true
+		transferIds[creditId] = true
+	}
+	rows.Close()
+
+	for i := range transactions {
+		transactions[i].Splits = splits[transactions[i].UniqueId]
+		transactions[i].IsTransfer = transferIds[transactions[i].UniqueId]
+	}
+
+	return rows.Err()
+}
+
+func (s *PostgresStore) ReadAllTransactions() ([]Transaction, error) {
+	return s.ReadTransactionsInRange(TransactionFilter{})
+}
+
+// postgresFilterClause returns the conditions on the transactions table, aliased as t, for the filter along with
+// their numbered arguments.
+func postgresFilterClause(filter TransactionFilter) (where string, args []any) {
+	where = "t.deleted_at IS NULL"
+	addCondition := func(condition string, value any) {
+		args = append(args, value)
+		where += " AND " + strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args)))
+	}
+
+	if filter.From != "" {
+		addCondition("t.date >= ?", filter.From)
+	}
+	if filter.To != "" {
+		addCondition("t.date <= ?", filter.To)
+	}
+	if filter.Account != "" {
+		addCondition("t.account = ?", filter.Account)
+	}
+	if filter.Category != "" {
+		addCondition("(t.category = ? OR t.unique_id IN (SELECT transaction_id FROM transaction_splits WHERE category = ?))", filter.Category)
+	}
+
+	return where, args
+}
+
+// scanPostgresTransactions reads every row of a query selecting postgresTransactionColumns:
+func scanPostgresTransactions(rows *sql.Rows) ([]Transaction, error) {
+	defer rows.Close()
+
+	transactions := []Transaction{}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (s *PostgresStore) ReadTransactionsInRange(filter TransactionFilter) ([]Transaction, error) {
+	where, args := postgresFilterClause(filter)
+
+	rows, err := s.db.Query(`SELECT `+postgresTransactionColumns+`
+		FROM transactions t LEFT JOIN payees p ON p.unique_id = t.payee_id
+		WHERE `+where+` ORDER BY t.date, t.unique_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := scanPostgresTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return transactions, s.readTransactionExtras(transactions)
+}
+
+// Expressions the Postgres table is ordered by for each sort column:
+var postgresSortExpressions = map[string]string{
+	"date":    "t.date",
+	"payee":   "COALESCE(p.name, t.description, '')",
+	"account": "t.account",
+	"debit":   "t.debit",
+	"credit":  "t.credit",
+}
+
+func (s *PostgresStore) ReadTransactionPage(query TransactionPageQuery) (TransactionPage, error) {
+	where, args := postgresFilterClause(query.Filter)
+
+	if query.Search != "" {
+		args = append(args, "%"+query.Search+"%")
+		where += fmt.Sprintf(" AND t.description ILIKE $%d", len(args))
+	}
+
+	sortExpression := postgresSortExpressions[query.Sort]
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if !query.IsFirstPage() {
+		cursor, err := query.cursorArg()
+		if err != nil {
+			return TransactionPage{}, err
+		}
+		args = append(args, cursor, query.AfterId)
+		where += fmt.Sprintf(" AND (%[1]s, t.unique_id) %[2]s ($%[3]d, $%[4]d)", sortExpression, comparison, len(args)-1, len(args))
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`SELECT %s
+		FROM transactions t LEFT JOIN payees p ON p.unique_id = t.payee_id
+		WHERE %s ORDER BY %s %s, t.unique_id %s LIMIT %d`,
+		postgresTransactionColumns, where, sortExpression, direction, direction, query.PageSize+1), args...)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	transactions, err := scanPostgresTransactions(rows)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	return newTransactionPage(transactions, query), nil
+}
+
+func (s *PostgresStore) ReadTransaction(transactionId string) (Transaction, error) {
+	row := s.db.QueryRow(`SELECT `+postgresTransactionColumns+`
+		FROM transactions t LEFT JOIN payees p ON p.unique_id = t.payee_id
+		WHERE t.unique_id = $1 AND t.deleted_at IS NULL`, transactionId)
+
+	transaction, err := scanTransaction(row)
+	if err != nil {
+		return transaction, err
+	}
+
+	transactions := []Transaction{transaction}
+	err = s.readTransactionExtras(transactions)
+	return transactions[0], err
+}
+
+func (s *PostgresStore) ReadTransactionHistory() ([]TransactionHistory, error) {
+	rows, err := s.db.Query(`SELECT unique_id::text, COALESCE(filename, ''), to_char(date_uploaded, 'YYYY-MM-DD HH24:MI:SS'),
+		COALESCE(num_rows, 0), COALESCE(file_size, 0)
+		FROM uploaded_files WHERE deleted_at IS NULL ORDER BY unique_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []TransactionHistory{}
+	for rows.Next() {
+		var upload TransactionHistory
+		err := rows.Scan(&upload.UniqueId, &upload.FileName, &upload.DateUploaded, &upload.NumRows, &upload.FileSize)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, upload)
+	}
+
+	return history, rows.Err()
+}
+
+// InsertUpload stores the upload in a single transaction, then assigns payees to the new transactions and looks for
+// transfers in the same way as the SQLite store.
+func (s *PostgresStore) InsertUpload(upload UploadedFile, transactions []Transaction, actor string) (uploadId int64, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(`INSERT INTO uploaded_files(filename, date_uploaded, num_rows, file_size)
+		values($1, $2, $3, $4) RETURNING unique_id`,
+		upload.FileName, time.Now(), upload.NumRows, upload.FileSize).Scan(&uploadId)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO transactions(unique_id, date, description, debit, credit, account, upload_id)
+		values($1, $2, $3, $4, $5, $6, $7)`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	auditStmt, err := tx.Prepare(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer auditStmt.Close()
+
+	timestamp := time.Now()
+	for _, transaction := range transactions {
+		_, err = stmt.Exec(
+			transaction.UniqueId,
+			transaction.Date.Format("2006-01-02"),
+			transaction.Description,
+			fmt.Sprintf("%.2f", transaction.Debit),
+			fmt.Sprintf("%.2f", transaction.Credit),
+			transaction.Account,
+			uploadId,
+		)
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("inserting transaction %s %s: %w", transaction.Date.Format("2006-01-02"), transaction.Description, err)
+		}
+
+		_, err = auditStmt.Exec(auditEntityTransaction, transaction.UniqueId, "*", "",
+			describeTransaction(transaction)+" (uploaded from "+upload.FileName+")", actor, timestamp)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	_, err = auditStmt.Exec(auditEntityUpload, strconv.FormatInt(uploadId, 10), "*", "",
+		fmt.Sprintf("%s, %d rows into account %s", upload.FileName, upload.NumRows, upload.Account), actor, timestamp)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = s.ApplyPayeeAliases(true)
+	if err != nil {
+		return uploadId, fmt.Errorf("applying the payee aliases: %w", err)
+	}
+
+	_, err = s.DetectTransferCandidates(transferMatchWindowDays, actor)
+	if err != nil {
+		return uploadId, fmt.Errorf("detecting transfer candidates: %w", err)
+	}
+
+	return uploadId, nil
+}
+
+func (s *PostgresStore) ReadAccountBalances() ([]AccountBalance, error) {
+	rows, err := s.db.Query(`SELECT unique_id, account, date, balance::float8, kind
+		FROM account_balances ORDER BY account, date`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []AccountBalance{}
+	for rows.Next() {
+		var balance AccountBalance
+		err := rows.Scan(&balance.UniqueId, &balance.Account, &balance.Date, &balance.Balance, &balance.Kind)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+
+	return balances, rows.Err()
+}
+
+// SaveAccountBalance replaces balances in the same way as the SQLite store.
+func (s *PostgresStore) SaveAccountBalance(balance AccountBalance, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	replacedQuery := `DELETE FROM account_balances WHERE account = $1 AND kind = $2 AND date = $3
+		RETURNING to_char(date, 'YYYY-MM-DD'), balance::float8`
+	replacedArgs := []any{balance.Account, balance.Kind, balance.Date.Format("2006-01-02")}
+	if balance.Kind == balanceKindOpening {
+		replacedQuery = `DELETE FROM account_balances WHERE account = $1 AND kind = $2
+			RETURNING to_char(date, 'YYYY-MM-DD'), balance::float8`
+		replacedArgs = replacedArgs[:2]
+	}
+
+	oldValue := ""
+	var replacedDate string
+	var replacedBalance float64
+	err = tx.QueryRow(replacedQuery, replacedArgs...).Scan(&replacedDate, &replacedBalance)
+	if err == nil {
+		oldValue = fmt.Sprintf("%s %.2f", replacedDate, replacedBalance)
+	} else if err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO account_balances(account, date, balance, kind) values($1, $2, $3, $4)",
+		balance.Account, balance.Date.Format("2006-01-02"), fmt.Sprintf("%.2f", balance.Balance), balance.Kind)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityBalance, balance.Account, balance.Kind, oldValue, describeBalance(balance), actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteAccountBalance(balanceId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var account, kind, date string
+	var balance float64
+	err = tx.QueryRow(`DELETE FROM account_balances WHERE unique_id = $1
+		RETURNING account, kind, to_char(date, 'YYYY-MM-DD'), balance::float8`, balanceId).Scan(&account, &kind, &date, &balance)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityBalance, account, kind, fmt.Sprintf("%s %.2f", date, balance), "", actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadCategoryBudgets() ([]CategoryBudget, error) {
+	rows, err := s.db.Query(`SELECT unique_id, category, month, amount::float8, carry_forward
+		FROM category_budgets ORDER BY category, month`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []CategoryBudget{}
+	for rows.Next() {
+		var budget CategoryBudget
+		var month string
+		err := rows.Scan(&budget.UniqueId, &budget.Category, &month, &budget.Amount, &budget.CarryForward)
+		if err != nil {
+			return nil, err
+		}
+		budget.Month, err = time.Parse("2006-01", month)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, rows.Err()
+}
+
+func (s *PostgresStore) SaveCategoryBudget(budget CategoryBudget, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	oldValue := ""
+	replaced := CategoryBudget{Month: budget.Month}
+	err = tx.QueryRow("SELECT amount::float8, carry_forward FROM category_budgets WHERE category = $1 AND month = $2",
+		budget.Category, budget.Month.Format("2006-01")).Scan(&replaced.Amount, &replaced.CarryForward)
+	if err == nil {
+		oldValue = describeBudget(replaced)
+	} else if err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO category_budgets(category, month, amount, carry_forward) values($1, $2, $3, $4)
+		ON CONFLICT(category, month) DO UPDATE SET amount = excluded.amount, carry_forward = excluded.carry_forward`,
+		budget.Category, budget.Month.Format("2006-01"), fmt.Sprintf("%.2f", budget.Amount), budget.CarryForward)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityBudget, budget.Category, "amount", oldValue, describeBudget(budget), actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteCategoryBudget(budgetId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var budget CategoryBudget
+	var month string
+	err = tx.QueryRow(`DELETE FROM category_budgets WHERE unique_id = $1
+		RETURNING category, month, amount::float8, carry_forward`, budgetId).Scan(
+		&budget.Category, &month, &budget.Amount, &budget.CarryForward)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	budget.Month, _ = time.Parse("2006-01", month)
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityBudget, budget.Category, "amount", describeBudget(budget), "", actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadScheduledTransactions() ([]ScheduledTransaction, error) {
+	rows, err := s.db.Query(`SELECT unique_id, date, description, debit::float8, credit::float8, account
+		FROM scheduled_transactions ORDER BY date, unique_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scheduled := []ScheduledTransaction{}
+	for rows.Next() {
+		var entry ScheduledTransaction
+		err := rows.Scan(&entry.UniqueId, &entry.Date, &entry.Description, &entry.Debit, &entry.Credit, &entry.Account)
+		if err != nil {
+			return nil, err
+		}
+		scheduled = append(scheduled, entry)
+	}
+
+	return scheduled, rows.Err()
+}
+
+func (s *PostgresStore) InsertScheduledTransaction(scheduled ScheduledTransaction, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var scheduledId int64
+	err = tx.QueryRow(`INSERT INTO scheduled_transactions(date, description, debit, credit, account)
+		values($1, $2, $3, $4, $5) RETURNING unique_id`,
+		scheduled.Date.Format("2006-01-02"), scheduled.Description, fmt.Sprintf("%.2f", scheduled.Debit),
+		fmt.Sprintf("%.2f", scheduled.Credit), scheduled.Account).Scan(&scheduledId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityScheduled, strconv.FormatInt(scheduledId, 10), "*", "", describeScheduledTransaction(scheduled), actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteScheduledTransaction(scheduledId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var scheduled ScheduledTransaction
+	err = tx.QueryRow(`DELETE FROM scheduled_transactions WHERE unique_id = $1
+		RETURNING date, description, debit::float8, credit::float8, account`, scheduledId).Scan(
+		&scheduled.Date, &scheduled.Description, &scheduled.Debit, &scheduled.Credit, &scheduled.Account)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityScheduled, strconv.Itoa(scheduledId), "*", describeScheduledTransaction(scheduled), "", actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadAnomalies() ([]Anomaly, error) {
+	rows, err := s.db.Query(`SELECT unique_id, kind, key, COALESCE(transaction_id, ''), summary,
+		to_char(detected_at, 'YYYY-MM-DD HH24:MI:SS'), status
+		FROM anomalies ORDER BY detected_at DESC, unique_id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anomalies := []Anomaly{}
+	for rows.Next() {
+		var anomaly Anomaly
+		err := rows.Scan(&anomaly.UniqueId, &anomaly.Kind, &anomaly.Key, &anomaly.TransactionId, &anomaly.Summary,
+			&anomaly.DetectedAt, &anomaly.Status)
+		if err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	return anomalies, rows.Err()
+}
+
+func (s *PostgresStore) RecordAnomalies(anomalies []Anomaly) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	numRecorded := 0
+	detectedAt := time.Now()
+	for _, anomaly := range anomalies {
+		result, err := tx.Exec(`INSERT INTO anomalies(kind, key, transaction_id, summary, detected_at, status)
+			values($1, $2, NULLIF($3, ''), $4, $5, $6) ON CONFLICT (kind, key) DO NOTHING`,
+			anomaly.Kind, anomaly.Key, anomaly.TransactionId, anomaly.Summary, detectedAt, anomalyStatusOpen)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		numRecorded += int(inserted)
+	}
+
+	return numRecorded, tx.Commit()
+}
+
+func (s *PostgresStore) UpdateAnomalyStatus(anomalyId int, status string, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var oldStatus, summary string
+	err = tx.QueryRow("SELECT status, summary FROM anomalies WHERE unique_id = $1 FOR UPDATE", anomalyId).Scan(&oldStatus, &summary)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE anomalies SET status = $1 WHERE unique_id = $2", status, anomalyId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityAnomaly, strconv.Itoa(anomalyId), "status", oldStatus, status+": "+summary, actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadNetWorthAccounts() ([]NetWorthAccount, error) {
+	rows, err := s.db.Query("SELECT unique_id, name, kind, asset_class FROM net_worth_accounts ORDER BY kind, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []NetWorthAccount{}
+	for rows.Next() {
+		var account NetWorthAccount
+		err := rows.Scan(&account.UniqueId, &account.Name, &account.Kind, &account.AssetClass)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	valuationRows, err := s.db.Query("SELECT unique_id, account_id, date, value::float8 FROM valuations ORDER BY date, unique_id")
+	if err != nil {
+		return nil, err
+	}
+	defer valuationRows.Close()
+
+	for valuationRows.Next() {
+		var valuation Valuation
+		err := valuationRows.Scan(&valuation.UniqueId, &valuation.AccountId, &valuation.Date, &valuation.Value)
+		if err != nil {
+			return nil, err
+		}
+		for i := range accounts {
+			if accounts[i].UniqueId == valuation.AccountId {
+				accounts[i].Valuations = append(accounts[i].Valuations, valuation)
+			}
+		}
+	}
+
+	return accounts, valuationRows.Err()
+}
+
+func (s *PostgresStore) AddNetWorthAccount(account NetWorthAccount, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var accountId int64
+	err = tx.QueryRow("INSERT INTO net_worth_accounts(name, kind, asset_class) values($1, $2, $3) RETURNING unique_id",
+		account.Name, account.Kind, account.AssetClass).Scan(&accountId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityNetWorth, strconv.FormatInt(accountId, 10), "*", "", describeNetWorthAccount(account), actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteNetWorthAccount(accountId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// The valuations are deleted with the account by the foreign key:
+	var account NetWorthAccount
+	err = tx.QueryRow("DELETE FROM net_worth_accounts WHERE unique_id = $1 RETURNING name, kind, asset_class", accountId).Scan(
+		&account.Name, &account.Kind, &account.AssetClass)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityNetWorth, strconv.Itoa(accountId), "*", describeNetWorthAccount(account), "", actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) SaveValuation(valuation Valuation, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM net_worth_accounts WHERE unique_id = $1", valuation.AccountId).Scan(&name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	oldValue := ""
+	var replacedValue float64
+	err = tx.QueryRow("SELECT value::float8 FROM valuations WHERE account_id = $1 AND date = $2",
+		valuation.AccountId, valuation.Date.Format("2006-01-02")).Scan(&replacedValue)
+	if err == nil {
+		oldValue = fmt.Sprintf("%.2f", replacedValue)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO valuations(account_id, date, value) values($1, $2, $3)
+		ON CONFLICT (account_id, date) DO UPDATE SET value = excluded.value`,
+		valuation.AccountId, valuation.Date.Format("2006-01-02"), fmt.Sprintf("%.2f", valuation.Value))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityNetWorth, strconv.Itoa(valuation.AccountId), "valuation "+valuation.Date.Format("2006-01-02"),
+		oldValue, describeValuation(name, valuation), actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteValuation(valuationId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var valuation Valuation
+	err = tx.QueryRow("DELETE FROM valuations WHERE unique_id = $1 RETURNING account_id, date, value::float8", valuationId).Scan(
+		&valuation.AccountId, &valuation.Date, &valuation.Value)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM net_worth_accounts WHERE unique_id = $1", valuation.AccountId).Scan(&name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityNetWorth, strconv.Itoa(valuation.AccountId), "valuation "+valuation.Date.Format("2006-01-02"),
+		describeValuation(name, valuation), "", actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadSavingsGoals() ([]SavingsGoal, error) {
+	rows, err := s.db.Query(`SELECT unique_id, name, target_amount::float8, target_date, account, category
+		FROM savings_goals ORDER BY target_date, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []SavingsGoal{}
+	for rows.Next() {
+		var goal SavingsGoal
+		err := rows.Scan(&goal.UniqueId, &goal.Name, &goal.TargetAmount, &goal.TargetDate, &goal.Account, &goal.Category)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+
+	return goals, rows.Err()
+}
+
+func (s *PostgresStore) AddSavingsGoal(goal SavingsGoal, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var goalId int64
+	err = tx.QueryRow(`INSERT INTO savings_goals(name, target_amount, target_date, account, category)
+		values($1, $2, $3, $4, $5) RETURNING unique_id`,
+		goal.Name, fmt.Sprintf("%.2f", goal.TargetAmount), goal.TargetDate.Format("2006-01-02"), goal.Account, goal.Category).Scan(&goalId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityGoal, strconv.FormatInt(goalId, 10), "*", "", describeSavingsGoal(goal), actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeleteSavingsGoal(goalId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var goal SavingsGoal
+	err = tx.QueryRow(`DELETE FROM savings_goals WHERE unique_id = $1
+		RETURNING name, target_amount::float8, target_date, account, category`, goalId).Scan(
+		&goal.Name, &goal.TargetAmount, &goal.TargetDate, &goal.Account, &goal.Category)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		auditEntityGoal, strconv.Itoa(goalId), "*", describeSavingsGoal(goal), "", actor, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordPostgresAudit appends entries to the audit log with the same shared actor and timestamp as RecordAudit.
+func recordPostgresAudit(tx execer, actor string, entries ...AuditEntry) error {
+	timestamp := time.Now()
+
+	for _, entry := range entries {
+		_, err := tx.Exec(`INSERT INTO audit_log(entity, entity_id, field, old_value, new_value, actor, timestamp)
+			values($1, $2, $3, $4, $5, $6, $7)`,
+			entry.Entity, entry.EntityId, entry.Field, entry.OldValue, entry.NewValue, actor, timestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) InsertTransaction(transaction Transaction, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO transactions(unique_id, date, description, debit, credit, category, account)
+		values($1, $2, $3, $4, $5, $6, $7)`,
+		transaction.UniqueId,
+		transaction.Date.Format("2006-01-02"),
+		transaction.Description,
+		fmt.Sprintf("%.2f", transaction.Debit),
+		fmt.Sprintf("%.2f", transaction.Credit),
+		transaction.Category,
+		transaction.Account,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transaction.UniqueId,
+		Field:    "*",
+		NewValue: describeTransaction(transaction),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) UpdateTransaction(existingTransaction Transaction, transaction Transaction, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE transactions SET date = $1, description = $2, debit = $3, credit = $4
+		WHERE unique_id = $5 AND deleted_at IS NULL`,
+		transaction.Date.Format("2006-01-02"),
+		transaction.Description,
+		fmt.Sprintf("%.2f", transaction.Debit),
+		fmt.Sprintf("%.2f", transaction.Credit),
+		transaction.UniqueId,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, diffTransactions(existingTransaction, transaction)...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) SoftDeleteTransaction(transaction Transaction, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE transactions SET deleted_at = $1 WHERE unique_id = $2 AND deleted_at IS NULL",
+		time.Now(), transaction.UniqueId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transaction.UniqueId,
+		Field:    "deleted_at",
+		OldValue: describeTransaction(transaction),
+		NewValue: "trashed",
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReplaceTransactionSplits(transactionId string, splits []TransactionSplit, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT unique_id, transaction_id, category, note, amount::float8
+		FROM transaction_splits WHERE transaction_id = $1 ORDER BY unique_id`, transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	oldSplits, err := scanSplits(rows)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM transaction_splits WHERE transaction_id = $1", transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, split := range splits {
+		_, err = tx.Exec("INSERT INTO transaction_splits(transaction_id, category, note, amount) values($1, $2, $3, $4)",
+			transactionId, split.Category, split.Note, fmt.Sprintf("%.2f", split.Amount))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "splits",
+		OldValue: describeSplits(oldSplits),
+		NewValue: describeSplits(splits),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) UpdateTransactionCategory(transactionId string, category string, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var oldCategory string
+	err = tx.QueryRow("SELECT category FROM transactions WHERE unique_id = $1 AND deleted_at IS NULL FOR UPDATE",
+		transactionId).Scan(&oldCategory)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET category = $1 WHERE unique_id = $2", category, transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "category",
+		OldValue: oldCategory,
+		NewValue: category,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadCategories() ([]string, error) {
+	rows, err := s.db.Query(`SELECT category FROM transactions WHERE deleted_at IS NULL
+		UNION SELECT category FROM transaction_splits
+		WHERE transaction_id IN (SELECT unique_id FROM transactions WHERE deleted_at IS NULL)
+		ORDER BY category`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []string{}
+	for rows.Next() {
+		var category string
+		err := rows.Scan(&category)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// Columns selected in the order scanAttachments reads them:
+const postgresAttachmentColumns = `unique_id, transaction_id, filename, content_type, file_path, COALESCE(file_size, 0),
+	to_char(date_uploaded, 'YYYY-MM-DD HH24:MI:SS')`
+
+func (s *PostgresStore) ReadTransactionAttachments(transactionId string) ([]Attachment, error) {
+	rows, err := s.db.Query(`SELECT `+postgresAttachmentColumns+`
+		FROM attachments WHERE transaction_id = $1 ORDER BY unique_id`, transactionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+func (s *PostgresStore) ReadAttachment(attachmentId int) (attachment Attachment, err error) {
+	err = s.db.QueryRow(`SELECT `+postgresAttachmentColumns+` FROM attachments WHERE unique_id = $1`, attachmentId).Scan(
+		&attachment.UniqueId,
+		&attachment.TransactionId,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.FilePath,
+		&attachment.FileSize,
+		&attachment.DateUploaded,
+	)
+
+	return attachment, err
+}
+
+func (s *PostgresStore) InsertAttachment(attachment Attachment, actor string) (attachmentId int64, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(`INSERT INTO attachments(transaction_id, filename, content_type, file_path, file_size, date_uploaded)
+		values($1, $2, $3, $4, $5, $6) RETURNING unique_id`,
+		attachment.TransactionId,
+		attachment.FileName,
+		attachment.ContentType,
+		attachment.FilePath,
+		attachment.FileSize,
+		attachment.DateUploaded,
+	).Scan(&attachmentId)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: attachment.TransactionId,
+		Field:    "attachment",
+		NewValue: attachment.FileName,
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return attachmentId, tx.Commit()
+}
+
+func (s *PostgresStore) DeleteAttachment(attachment Attachment, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM attachments WHERE unique_id = $1", attachment.UniqueId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: attachment.TransactionId,
+		Field:    "attachment",
+		OldValue: attachment.FileName,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return removeAttachmentFile(attachment)
+}
+
+func (s *PostgresStore) ReadAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	where := "1 = 1"
+	args := []any{}
+	addCondition := func(condition string, value any) {
+		args = append(args, value)
+		where += " AND " + strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args)))
+	}
+
+	if filter.Entity != "" {
+		addCondition("entity = ?", filter.Entity)
+	}
+	if filter.EntityId != "" {
+		addCondition("entity_id = ?", filter.EntityId)
+	}
+	if filter.Actor != "" {
+		addCondition("actor = ?", filter.Actor)
+	}
+	if filter.Field != "" {
+		addCondition("field = ?", filter.Field)
+	}
+	if filter.From != "" {
+		addCondition("audit_log.timestamp >= ?::date", filter.From)
+	}
+	if filter.To != "" {
+		addCondition("audit_log.timestamp < ?::date + 1", filter.To)
+	}
+
+	query := `SELECT unique_id, entity, entity_id, field, COALESCE(old_value, ''), COALESCE(new_value, ''), actor,
+		to_char(audit_log.timestamp, 'YYYY-MM-DD HH24:MI:SS')
+		FROM audit_log WHERE ` + where + ` ORDER BY unique_id DESC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		err := rows.Scan(&entry.UniqueId, &entry.Entity, &entry.EntityId, &entry.Field, &entry.OldValue, &entry.NewValue,
+			&entry.Actor, &entry.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *PostgresStore) ReadAuditActors() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT actor FROM audit_log ORDER BY actor")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actors := []string{}
+	for rows.Next() {
+		var actor string
+		err := rows.Scan(&actor)
+		if err != nil {
+			return nil, err
+		}
+		actors = append(actors, actor)
+	}
+
+	return actors, rows.Err()
+}
+
+func (s *PostgresStore) ReadTrashedTransactions() ([]TrashedTransaction, error) {
+	rows, err := s.db.Query(`SELECT ` + postgresTransactionColumns + `, to_char(t.deleted_at, 'YYYY-MM-DD HH24:MI:SS')
+		FROM transactions t LEFT JOIN payees p ON p.unique_id = t.payee_id
+		WHERE t.deleted_at IS NOT NULL ORDER BY t.deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []TrashedTransaction{}
+	for rows.Next() {
+		var trashed TrashedTransaction
+		trashed.Transaction, err = scanTransaction(trashedRowScanner{rows: rows, deletedAt: &trashed.DeletedAt})
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, trashed)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (s *PostgresStore) ReadTrashedUploads() ([]TrashedUpload, error) {
+	rows, err := s.db.Query(`SELECT u.unique_id::text, COALESCE(u.filename, ''), to_char(u.date_uploaded, 'YYYY-MM-DD HH24:MI:SS'),
+		COALESCE(u.num_rows, 0), COALESCE(u.file_size, 0), to_char(u.deleted_at, 'YYYY-MM-DD HH24:MI:SS'),
+		(SELECT COUNT(*) FROM transactions t WHERE t.upload_id = u.unique_id AND t.deleted_at = u.deleted_at)
+		FROM uploaded_files u WHERE u.deleted_at IS NOT NULL ORDER BY u.deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []TrashedUpload{}
+	for rows.Next() {
+		var upload TrashedUpload
+		err := rows.Scan(&upload.UniqueId, &upload.FileName, &upload.DateUploaded, &upload.NumRows, &upload.FileSize,
+			&upload.DeletedAt, &upload.NumTransactions)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+// SoftDeleteUpload trashes the upload and its transactions under the same deleted_at in the same way as the SQLite
+// store.
+func (s *PostgresStore) SoftDeleteUpload(uploadId int, actor string) error {
+	deletedAt := time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE uploaded_files SET deleted_at = $1 WHERE unique_id = $2 AND deleted_at IS NULL", deletedAt, uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET deleted_at = $1 WHERE upload_id = $2 AND deleted_at IS NULL", deletedAt, uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "deleted_at", NewValue: "trashed"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) RestoreUpload(uploadId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE transactions SET deleted_at = NULL
+		WHERE upload_id = $1 AND deleted_at = (SELECT deleted_at FROM uploaded_files WHERE unique_id = $1)`, uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE uploaded_files SET deleted_at = NULL WHERE unique_id = $1 AND deleted_at IS NOT NULL", uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "deleted_at", OldValue: "trashed"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// purgePostgresTransaction removes a trashed transaction in the same way as purgeTransaction. The rows referencing
+// the transaction are deleted before it as Postgres enforces the foreign keys.
+func purgePostgresTransaction(tx *sql.Tx, transactionId string) error {
+	err := tx.QueryRow("SELECT unique_id FROM transactions WHERE unique_id = $1 AND deleted_at IS NOT NULL FOR UPDATE",
+		transactionId).Scan(&transactionId)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM attachments WHERE transaction_id = $1",
+		"DELETE FROM transaction_splits WHERE transaction_id = $1",
+		"DELETE FROM transfer_links WHERE debit_transaction_id = $1 OR credit_transaction_id = $1",
+		"DELETE FROM transactions WHERE unique_id = $1",
+	} {
+		_, err = tx.Exec(query, transactionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) PurgeTransaction(transactionId string, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = purgePostgresTransaction(tx, transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{Entity: auditEntityTransaction, EntityId: transactionId, Field: "*", OldValue: "purged from trash"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	removeAttachmentFiles(transactionId)
+	return nil
+}
+
+// PurgeUpload keeps the transactions from the upload that were restored on their own and unlinks them from it, in
+// the same way as the SQLite store.
+func (s *PostgresStore) PurgeUpload(uploadId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT unique_id FROM transactions WHERE upload_id = $1 AND deleted_at IS NOT NULL", uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	transactionIds := []string{}
+	for rows.Next() {
+		var transactionId string
+		err := rows.Scan(&transactionId)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		transactionIds = append(transactionIds, transactionId)
+	}
+	rows.Close()
+
+	for _, transactionId := range transactionIds {
+		err = purgePostgresTransaction(tx, transactionId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET upload_id = NULL WHERE upload_id = $1", uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM uploaded_files WHERE unique_id = $1 AND deleted_at IS NOT NULL", uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "*", OldValue: "purged from trash"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	removeAttachmentFiles(transactionIds...)
+	return nil
+}
+
+func (s *PostgresStore) RestoreTransaction(transactionId string, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE transactions SET deleted_at = NULL WHERE unique_id = $1 AND deleted_at IS NOT NULL", transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "deleted_at",
+		OldValue: "trashed",
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadTransferLinks() ([]TransferLink, error) {
+	rows, err := s.db.Query(`SELECT unique_id, debit_transaction_id, credit_transaction_id, status,
+		to_char(date_detected, 'YYYY-MM-DD HH24:MI:SS')
+		FROM transfer_links WHERE status != $1 ORDER BY unique_id`, transferStatusRejected)
+	if err != nil {
+		return nil, err
+	}
+	type rawLink struct {
+		TransferLink
+		debitId, creditId string
+	}
+	rawLinks := []rawLink{}
+	for rows.Next() {
+		var link rawLink
+		err := rows.Scan(&link.UniqueId, &link.debitId, &link.creditId, &link.Status, &link.DateDetected)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rawLinks = append(rawLinks, link)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	transactions, err := s.ReadAllTransactions()
+	if err != nil {
+		return nil, err
+	}
+	transactionsById := make(map[string]Transaction)
+	for _, transaction := range transactions {
+		transactionsById[transaction.UniqueId] = transaction
+	}
+
+	links := []TransferLink{}
+	for _, link := range rawLinks {
+		// Links where either side is in the trash are hidden until the transaction is restored:
+		debitTransaction, debitFound := transactionsById[link.debitId]
+		creditTransaction, creditFound := transactionsById[link.creditId]
+		if !debitFound || !creditFound {
+			continue
+		}
+
+		link.DebitTransaction = debitTransaction
+		link.CreditTransaction = creditTransaction
+		links = append(links, link.TransferLink)
+	}
+
+	return links, nil
+}
+
+func (s *PostgresStore) DetectTransferCandidates(windowDays int, actor string) (int, error) {
+	transactions, err := s.ReadAllTransactions()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.Query("SELECT debit_transaction_id, credit_transaction_id, status FROM transfer_links")
+	if err != nil {
+		return 0, err
+	}
+	linkedIds := make(map[string]bool)
+	rejectedPairs := make(map[[2]string]bool)
+	for rows.Next() {
+		var debitId, creditId, status string
+		err := rows.Scan(&debitId, &creditId, &status)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if status == transferStatusRejected {
+			rejectedPairs[[2]string{debitId, creditId}] = true
+		} else {
+			linkedIds[debitId] = true
+			linkedIds[creditId] = true
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, rows.Err()
+	}
+
+	pairs := findTransferPairs(transactions, linkedIds, rejectedPairs, windowDays)
+	if len(pairs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	detected := 0
+	detectedTime := time.Now()
+	for _, pair := range pairs {
+		result, err := tx.Exec(`INSERT INTO transfer_links(debit_transaction_id, credit_transaction_id, status, date_detected)
+			values($1, $2, $3, $4) ON CONFLICT (debit_transaction_id, credit_transaction_id) DO NOTHING`,
+			pair[0].UniqueId, pair[1].UniqueId, transferStatusCandidate, detectedTime)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		detected += int(inserted)
+	}
+
+	if detected > 0 {
+		err = recordPostgresAudit(tx, actor, AuditEntry{
+			Entity:   auditEntityTransfer,
+			EntityId: "*",
+			Field:    "status",
+			NewValue: fmt.Sprintf("%d new candidates", detected),
+		})
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return detected, tx.Commit()
+}
+
+func (s *PostgresStore) UpdateTransferStatus(linkId int, status string, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var debitId, creditId, oldStatus string
+	err = tx.QueryRow("SELECT debit_transaction_id, credit_transaction_id, status FROM transfer_links WHERE unique_id = $1 FOR UPDATE",
+		linkId).Scan(&debitId, &creditId, &oldStatus)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if status == transferStatusConfirmed {
+		var conflicts int
+		err = tx.QueryRow(`SELECT COUNT(*) FROM transfer_links WHERE status = $1 AND unique_id != $2
+			AND (debit_transaction_id IN ($3, $4) OR credit_transaction_id IN ($3, $4))`,
+			transferStatusConfirmed, linkId, debitId, creditId).Scan(&conflicts)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if conflicts > 0 {
+			tx.Rollback()
+			return errTransferConflict
+		}
+	}
+
+	_, err = tx.Exec("UPDATE transfer_links SET status = $1 WHERE unique_id = $2", status, linkId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransfer,
+		EntityId: strconv.Itoa(linkId),
+		Field:    "status",
+		OldValue: oldStatus,
+		NewValue: status,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ReadPayees() ([]Payee, error) {
+	rows, err := s.db.Query("SELECT unique_id, name FROM payees ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	payees := []Payee{}
+	payeesById := make(map[int]int)
+	for rows.Next() {
+		var payee Payee
+		err := rows.Scan(&payee.UniqueId, &payee.Name)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		payeesById[payee.UniqueId] = len(payees)
+		payees = append(payees, payee)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	rows, err = s.db.Query("SELECT unique_id, payee_id, pattern FROM payee_aliases ORDER BY unique_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias PayeeAlias
+		err := rows.Scan(&alias.UniqueId, &alias.PayeeId, &alias.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		index := payeesById[alias.PayeeId]
+		payees[index].Aliases = append(payees[index].Aliases, alias)
+	}
+
+	return payees, rows.Err()
+}
+
+func (s *PostgresStore) AddPayeeAlias(name string, pattern string, actor string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO payees(name) values($1) ON CONFLICT (name) DO NOTHING", name)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var payeeId int64
+	err = tx.QueryRow("SELECT unique_id FROM payees WHERE name = $1", name).Scan(&payeeId)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO payee_aliases(payee_id, pattern) values($1, $2) ON CONFLICT (payee_id, pattern) DO NOTHING",
+		payeeId, pattern)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: strconv.FormatInt(payeeId, 10),
+		Field:    "alias",
+		NewValue: name + ": " + pattern,
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return payeeId, tx.Commit()
+}
+
+func (s *PostgresStore) DeletePayeeAlias(aliasId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var payeeId, pattern string
+	err = tx.QueryRow("DELETE FROM payee_aliases WHERE unique_id = $1 RETURNING payee_id::text, pattern", aliasId).Scan(&payeeId, &pattern)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: payeeId,
+		Field:    "alias",
+		OldValue: pattern,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DeletePayee(payeeId int, actor string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM payees WHERE unique_id = $1 FOR UPDATE", payeeId).Scan(&name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, query := range []string{
+		"UPDATE transactions SET payee_id = NULL WHERE payee_id = $1",
+		"DELETE FROM payee_aliases WHERE payee_id = $1",
+		"DELETE FROM payees WHERE unique_id = $1",
+	} {
+		_, err = tx.Exec(query, payeeId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: strconv.Itoa(payeeId),
+		Field:    "*",
+		OldValue: name,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ApplyPayeeAliases(onlyUnassigned bool) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	numAssigned, err := applyPostgresPayeeAliases(tx, onlyUnassigned)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return numAssigned, tx.Commit()
+}
+
+func (s *PostgresStore) ReapplyPayeeAliases(actor string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	numAssigned, err := applyPostgresPayeeAliases(tx, false)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = recordPostgresAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityPayee,
+		EntityId: "*",
+		Field:    "assignments",
+		NewValue: fmt.Sprintf("re-applied aliases to all transactions, %d matched", numAssigned),
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return numAssigned, tx.Commit()
+}
+
+// applyPostgresPayeeAliases assigns payees in the same way as applyPayeeAliases.
+func applyPostgresPayeeAliases(tx *sql.Tx, onlyUnassigned bool) (int, error) {
+	rows, err := tx.Query("SELECT unique_id, payee_id, pattern FROM payee_aliases ORDER BY unique_id")
+	if err != nil {
+		return 0, err
+	}
+	compiledAliases := []compiledAlias{}
+	for rows.Next() {
+		var alias PayeeAlias
+		err := rows.Scan(&alias.UniqueId, &alias.PayeeId, &alias.Pattern)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		compiled, err := compileAlias(alias)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		compiledAliases = append(compiledAliases, compiled)
+	}
+	rows.Close()
+
+	query := "SELECT unique_id, COALESCE(description, '') FROM transactions"
+	if onlyUnassigned {
+		query += " WHERE payee_id IS NULL"
+	}
+	rows, err = tx.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	assignments := make(map[string]sql.NullInt64)
+	for rows.Next() {
+		var transactionId, description string
+		err := rows.Scan(&transactionId, &description)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		payeeId, matched := matchPayee(compiledAliases, description)
+		assignments[transactionId] = sql.NullInt64{Int64: int64(payeeId), Valid: matched}
+	}
+	rows.Close()
+
+	numAssigned := 0
+	for transactionId, payeeId := range assignments {
+		if !payeeId.Valid && onlyUnassigned {
+			continue
+		}
+		_, err = tx.Exec("UPDATE transactions SET payee_id = $1 WHERE unique_id = $2", payeeId, transactionId)
+		if err != nil {
+			return 0, err
+		}
+		if payeeId.Valid {
+			numAssigned++
+		}
+	}
+
+	return numAssigned, nil
+}
+
+// SearchTransactions matches every word with ILIKE against the same columns as the LIKE search of the SQLite store,
+// so matches are ordered by date.
+func (s *PostgresStore) SearchTransactions(filter SearchFilter) ([]Transaction, error) {
+	where := "t.deleted_at IS NULL"
+	args := []any{}
+
+	for _, word := range strings.Fields(filter.Query) {
+		args = append(args, likePattern(word))
+		where += fmt.Sprintf(` AND (t.description ILIKE $%[1]d OR p.name ILIKE $%[1]d
+			OR EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = t.unique_id AND s.note ILIKE $%[1]d))`, len(args))
+	}
+
+	for _, bound := range []struct {
+		raw, name, condition string
+	}{
+		{filter.From, "from", "t.date >= $%d"},
+		{filter.To, "to", "t.date <= $%d"},
+	} {
+		if bound.raw == "" {
+			continue
+		}
+		_, err := time.Parse("2006-01-02", bound.raw)
+		if err != nil {
+			return nil, fmt.Errorf("the %s date must be in the format YYYY-MM-DD", bound.name)
+		}
+		args = append(args, bound.raw)
+		where += " AND " + fmt.Sprintf(bound.condition, len(args))
+	}
+
+	// Only one of debit and credit is ever set so their sum is the unsigned amount of the transaction:
+	for _, bound := range []struct {
+		raw, name, condition string
+	}{
+		{filter.MinAmount, "minimum", "t.debit + t.credit >= $%d"},
+		{filter.MaxAmount, "maximum", "t.debit + t.credit <= $%d"},
+	} {
+		if bound.raw == "" {
+			continue
+		}
+		amount, err := parseFormAmount(bound.raw, bound.name)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, fmt.Sprintf("%.2f", amount))
+		where += " AND " + fmt.Sprintf(bound.condition, len(args))
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`SELECT %s
+		FROM transactions t LEFT JOIN payees p ON p.unique_id = t.payee_id
+		WHERE %s ORDER BY t.date DESC, t.unique_id LIMIT %d`, postgresTransactionColumns, where, searchResultLimit), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := scanPostgresTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return transactions, s.readTransactionExtras(transactions)
+}
+
+// Tables copied from SQLite in an order that satisfies the foreign keys, with the columns copied for each. Every
+// table's unique_id is copied as is so the links between tables are preserved.
+var copiedTables = []struct {
+	name    string
+	columns []string
+	serial  bool
+}{
+	{"uploaded_files", []string{"unique_id", "filename", "date_uploaded", "num_rows", "file_size", "deleted_at"}, true},
+	{"payees", []string{"unique_id", "name"}, true},
+	{"transactions", []string{"unique_id", "date", "description", "debit", "credit", "category", "account", "payee_id", "upload_id", "deleted_at"}, false},
+	{"payee_aliases", []string{"unique_id", "payee_id", "pattern"}, true},
+	{"attachments", []string{"unique_id", "transaction_id", "filename", "content_type", "file_path", "file_size", "date_uploaded"}, true},
+	{"transaction_splits", []string{"unique_id", "transaction_id", "category", "note", "amount"}, true},
+	{"transfer_links", []string{"unique_id", "debit_transaction_id", "credit_transaction_id", "status", "date_detected"}, true},
+	{"account_balances", []string{"unique_id", "account", "date", "balance", "kind"}, true},
+	{"category_budgets", []string{"unique_id", "category", "month", "amount", "carry_forward"}, true},
+	{"scheduled_transactions", []string{"unique_id", "date", "description", "debit", "credit", "account"}, true},
+	{"anomalies", []string{"unique_id", "kind", "key", "transaction_id", "summary", "detected_at", "status"}, true},
+	{"net_worth_accounts", []string{"unique_id", "name", "kind", "asset_class"}, true},
+	{"valuations", []string{"unique_id", "account_id", "date", "value"}, true},
+	{"savings_goals", []string{"unique_id", "name", "target_amount", "target_date", "account", "category"}, true},
+	{"audit_log", []string{"unique_id", "entity", "entity_id", "field", "old_value", "new_value", "actor", "timestamp"}, true},
+}
+
+// Blank amounts are stored as empty strings in SQLite but are NOT NULL numbers in Postgres:
+var copiedAmountColumns = map[string]bool{"debit": true, "credit": true}
+
+// CopySQLiteToPostgres copies every row of the SQLite database at sqlitePath into the Postgres database at dsn. The
+// Postgres database is migrated first and must not contain any transactions yet. Everything is copied in a single
+// Postgres transaction so a failed copy leaves the target untouched.
+func CopySQLiteToPostgres(sqlitePath string, dsn string) error {
+	// Opening a missing file would create an empty database to copy from:
+	_, err := os.Stat(sqlitePath)
+	if err != nil {
+		return err
+	}
+
+	source, err := sql.Open("sqlite3", sqlitePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// A database last opened by an older binary is brought up to the schema the copy reads:
+	err = migrateSQLite(source)
+	if err != nil {
+		return fmt.Errorf("migrating the SQLite database: %w", err)
+	}
+
+	target, err := NewPostgresStore(dsn)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	var existing int
+	err = target.db.QueryRow("SELECT COUNT(*) FROM transactions").Scan(&existing)
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		return fmt.Errorf("the Postgres database already has %d transactions, copy into an empty database", existing)
+	}
+
+	tx, err := target.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range copiedTables {
+		copied, err := copyTable(source, tx, table.name, table.columns)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("copying %s: %w", table.name, err)
+		}
+
+		// Moving the sequence past the copied ids so new rows do not collide with them:
+		if table.serial {
+			_, err = tx.Exec(fmt.Sprintf(`SELECT setval(pg_get_serial_sequence('%[1]s', 'unique_id'),
+				COALESCE((SELECT MAX(unique_id) FROM %[1]s), 0) + 1, false)`, table.name))
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("resetting the %s sequence: %w", table.name, err)
+			}
+		}
+
+		fmt.Printf("Copied %d rows from %s.\n", copied, table.name)
+	}
+
+	return tx.Commit()
+}
+
+func copyTable(source *sql.DB, target *sql.Tx, table string, columns []string) (int, error) {
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+	}
+
+	stmt, err := target.Prepare(fmt.Sprintf("INSERT INTO %s(%s) values(%s)",
+		table, strings.Join(columns, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	rows, err := source.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	copied := 0
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		destinations := make([]any, len(columns))
+		for i := range values {
+			destinations[i] = &values[i]
+		}
+
+		err := rows.Scan(destinations...)
+		if err != nil {
+			return copied, err
+		}
+
+		args := make([]any, len(columns))
+		for i, value := range values {
+			switch {
+			case copiedAmountColumns[columns[i]] && (!value.Valid || value.String == ""):
+				args[i] = "0"
+			case !value.Valid:
+				args[i] = nil
+			default:
+				args[i] = value.String
+			}
+		}
+
+		_, err = stmt.Exec(args...)
+		if err != nil {
+			return copied, err
+		}
+		copied++
+	}
+
+	return copied, rows.Err()
+}
+
+// runSQLiteCopy is the entry point for the -copy-sqlite flag.
+func runSQLiteCopy(sqlitePath string, dsn string) {
+	if dsn == "" {
+		log.Fatal("Set FINANCE_DATABASE_URL to the Postgres database to copy into.")
+	}
+
+	err := CopySQLiteToPostgres(sqlitePath, dsn)
+	if err != nil {
+		log.Fatal("Unable to copy the SQLite database into Postgres: ", err)
+	}
+
+	fmt.Println("Sucessfully copied the SQLite database into Postgres.")
+}
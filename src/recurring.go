@@ -0,0 +1,297 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cadence is how often a recurring charge is expected, with the range of days between two charges that still counts
+// as that cadence and how many days late a charge may be before it is reported as stopped.
+type Cadence struct {
+	Name             string
+	MinDays, MaxDays int
+	GraceDays        int
+	PerYear          float64
+	MinOccurrences   int
+}
+
+var cadences = []Cadence{
+	{Name: "Weekly", MinDays: 6, MaxDays: 8, GraceDays: 3, PerYear: 52, MinOccurrences: 3},
+	{Name: "Monthly", MinDays: 27, MaxDays: 33, GraceDays: 7, PerYear: 12, MinOccurrences: 3},
+	{Name: "Annual", MinDays: 355, MaxDays: 375, GraceDays: 30, PerYear: 1, MinOccurrences: 2},
+}
+
+// next is when the charge following one on date is expected.
+func (c Cadence) next(date time.Time) time.Time {
+	return c.after(date, 1)
+}
+
+// after is when the nth charge following one on date is expected. Monthly and annual charges stay on the same day of
+// the month, or move to its last day when the month is shorter, so a charge on the 31st is not pushed into the month
+// after.
+func (c Cadence) after(date time.Time, n int) time.Time {
+	switch c.Name {
+	case "Weekly":
+		return date.AddDate(0, 0, 7*n)
+	case "Monthly":
+		return addMonthsClamped(date, n)
+	default:
+		return addMonthsClamped(date, 12*n)
+	}
+}
+
+// addMonthsClamped adds months to date, keeping to the last day of the resulting month rather than overflowing into
+// the next one the way time.AddDate does.
+func addMonthsClamped(date time.Time, months int) time.Time {
+	month := time.Date(date.Year(), date.Month()+time.Month(months), 1, 0, 0, 0, 0, date.Location())
+	day := date.Day()
+	if lastDay := month.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return time.Date(month.Year(), month.Month(), day, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+}
+
+// Amounts within this fraction of the median amount are considered the same charge:
+const recurringAmountTolerance = 0.2
+
+// RecurringCharge is a payee that is charged at a regular interval for a stable amount, or that pays a stable amount
+// at a regular interval when Income is set.
+type RecurringCharge struct {
+	Payee        string
+	Account      string
+	Income       bool
+	Cadence      Cadence
+	Occurrences  int
+	FirstDate    time.Time
+	LastDate     time.Time
+	NextExpected time.Time
+
+	AverageAmount  float64
+	LastAmount     float64
+	PreviousAmount float64
+
+	// PriceChanged is set when the latest charge differs from the one before it, Stopped when the next charge is
+	// overdue by more than the cadence's grace period:
+	PriceChanged bool
+	Stopped      bool
+}
+
+func (c RecurringCharge) AnnualizedCost() float64 {
+	return c.LastAmount * c.Cadence.PerYear
+}
+
+func (c RecurringCharge) PriceChange() float64 {
+	return c.LastAmount - c.PreviousAmount
+}
+
+// Store and reference numbers in raw descriptions change from charge to charge so they are dropped from the key:
+var recurringNumbers = regexp.MustCompile(`[#*]?\d+`)
+
+// recurringKey groups the charges of a payee, using the canonical payee when there is one.
+func recurringKey(transaction Transaction) string {
+	if transaction.Payee != "" {
+		return transaction.Payee
+	}
+	return strings.Join(strings.Fields(recurringNumbers.ReplaceAllString(normalizeDescription(transaction.Description), "")), " ")
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0.0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// detectCadence returns the cadence the median interval between the charges falls into. A longer gap, e.g. a month
+// that was skipped or is missing from the imports, does not break the cadence, but a charge that comes sooner than the
+// cadence allows does.
+func detectCadence(charges []Transaction) (Cadence, bool) {
+	intervals := []float64{}
+	for i := 1; i < len(charges); i++ {
+		intervals = append(intervals, math.Round(charges[i].Date.Sub(charges[i-1].Date).Hours()/24))
+	}
+	medianInterval := median(intervals)
+
+	for _, cadence := range cadences {
+		if len(charges) < cadence.MinOccurrences {
+			continue
+		}
+		if medianInterval < float64(cadence.MinDays) || medianInterval > float64(cadence.MaxDays) {
+			continue
+		}
+
+		regular := true
+		for _, days := range intervals {
+			if days < float64(cadence.MinDays) {
+				regular = false
+				break
+			}
+		}
+		if regular {
+			return cadence, true
+		}
+	}
+	return Cadence{}, false
+}
+
+// DetectRecurringCharges looks for payees that are charged at a weekly, monthly or annual interval for a stable
+// amount. asOf is the date the history is complete up to, a charge that was expected before it by more than the
+// grace period has stopped.
+func DetectRecurringCharges(transactions []Transaction, asOf time.Time) []RecurringCharge {
+	return detectRecurring(transactions, asOf, false)
+}
+
+// DetectRecurringIncome applies the same rules as DetectRecurringCharges to credits, e.g. to find a salary.
+func DetectRecurringIncome(transactions []Transaction, asOf time.Time) []RecurringCharge {
+	return detectRecurring(transactions, asOf, true)
+}
+
+func detectRecurring(transactions []Transaction, asOf time.Time, income bool) []RecurringCharge {
+	amountOf := func(transaction Transaction) float64 {
+		if income {
+			return float64(transaction.Credit)
+		}
+		return float64(transaction.Debit)
+	}
+
+	chargesByPayee := make(map[string][]Transaction)
+	for _, transaction := range transactions {
+		if transaction.IsTransfer || transaction.IsDebit() == income || amountOf(transaction) <= 0 {
+			continue
+		}
+		key := recurringKey(transaction)
+		chargesByPayee[key] = append(chargesByPayee[key], transaction)
+	}
+
+	charges := []RecurringCharge{}
+	for payee, payeeCharges := range chargesByPayee {
+		sort.SliceStable(payeeCharges, func(i, j int) bool {
+			return payeeCharges[i].Date.Before(payeeCharges[j].Date)
+		})
+
+		cadence, ok := detectCadence(payeeCharges)
+		if !ok {
+			continue
+		}
+
+		amounts := []float64{}
+		total := 0.0
+		for _, charge := range payeeCharges {
+			amounts = append(amounts, amountOf(charge))
+			total += amountOf(charge)
+		}
+
+		// Only the charges before the latest one have to be stable, the latest is reported as a price change
+		// however far it moved:
+		history := amounts[:len(amounts)-1]
+		medianAmount := median(history)
+
+		stable := true
+		for _, amount := range history {
+			if math.Abs(amount-medianAmount) > medianAmount*recurringAmountTolerance {
+				stable = false
+				break
+			}
+		}
+		if !stable {
+			continue
+		}
+
+		last := payeeCharges[len(payeeCharges)-1]
+		previous := payeeCharges[len(payeeCharges)-2]
+		charge := RecurringCharge{
+			Payee:          payee,
+			Account:        last.Account,
+			Income:         income,
+			Cadence:        cadence,
+			Occurrences:    len(payeeCharges),
+			FirstDate:      payeeCharges[0].Date,
+			LastDate:       last.Date,
+			NextExpected:   cadence.next(last.Date),
+			AverageAmount:  total / float64(len(payeeCharges)),
+			LastAmount:     amountOf(last),
+			PreviousAmount: amountOf(previous),
+		}
+		charge.PriceChanged = toCents(charge.LastAmount) != toCents(charge.PreviousAmount)
+		charge.Stopped = asOf.After(charge.NextExpected.AddDate(0, 0, cadence.GraceDays))
+
+		charges = append(charges, charge)
+	}
+
+	// Charges that need attention first, then the most expensive:
+	sort.Slice(charges, func(i, j int) bool {
+		iFlagged := charges[i].Stopped || charges[i].PriceChanged
+		jFlagged := charges[j].Stopped || charges[j].PriceChanged
+		if iFlagged != jFlagged {
+			return iFlagged
+		}
+		if charges[i].AnnualizedCost() != charges[j].AnnualizedCost() {
+			return charges[i].AnnualizedCost() > charges[j].AnnualizedCost()
+		}
+		return charges[i].Payee < charges[j].Payee
+	})
+
+	return charges
+}
+
+type recurringPageContent struct {
+	Charges              []RecurringCharge
+	AsOf                 time.Time
+	TotalAnnualizedCost  float64
+	NumStopped, NumPrice int
+}
+
+// recurringHandler lists the recurring charges found in the transaction history. The history is taken to be
+// complete up to the latest transaction, so an import that lags behind does not report every charge as stopped.
+func (h *storeHandlers) recurringHandler(w http.ResponseWriter, r *http.Request) {
+
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		log.Println("Unable to extract all transactions from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content := recurringPageContent{}
+	for _, transaction := range transactions {
+		if transaction.Date.After(content.AsOf) {
+			content.AsOf = transaction.Date
+		}
+	}
+
+	content.Charges = DetectRecurringCharges(transactions, content.AsOf)
+	for _, charge := range content.Charges {
+		if charge.Stopped {
+			content.NumStopped++
+			continue
+		}
+		content.TotalAnnualizedCost += charge.AnnualizedCost()
+		if charge.PriceChanged {
+			content.NumPrice++
+		}
+	}
+
+	tmpl, err := template.ParseFiles("../templates/recurring.html")
+	if err != nil {
+		log.Fatal("Unable to load the recurring.html template: ", err)
+	}
+
+	err = tmpl.Execute(w, content)
+	if err != nil {
+		log.Println("Unable to render the recurring.html template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testCharges returns a debit from the same payee for every date, at the matching amount.
+func testCharges(description string, dates []string, amounts ...float32) []Transaction {
+	charges := []Transaction{}
+	for i, date := range dates {
+		charges = append(charges, testTransaction(fmt.Sprintf("%s-%d", description, i), date, description, amounts[i], "Checking"))
+	}
+	return charges
+}
+
+func TestDetectRecurringCharges(t *testing.T) {
+	tests := []struct {
+		name         string
+		transactions []Transaction
+		asOf         string
+
+		// An empty cadence means nothing is detected:
+		cadence      string
+		nextExpected string
+		priceChanged bool
+		stopped      bool
+	}{
+		{
+			name:         "monthly",
+			transactions: testCharges("SPOTIFY", []string{"2023-01-05", "2023-02-05", "2023-03-05"}, 9.99, 9.99, 9.99),
+			asOf:         "2023-03-20",
+			cadence:      "Monthly",
+			nextExpected: "2023-04-05",
+		},
+		{
+			name:         "price rise beyond the tolerance",
+			transactions: testCharges("NETFLIX", []string{"2023-01-10", "2023-02-10", "2023-03-10", "2023-04-10"}, 15.99, 15.99, 15.99, 22.99),
+			asOf:         "2023-04-10",
+			cadence:      "Monthly",
+			nextExpected: "2023-05-10",
+			priceChanged: true,
+		},
+		{
+			name:         "small price change",
+			transactions: testCharges("GYM", []string{"2023-01-01", "2023-02-01", "2023-03-01"}, 40, 40, 42),
+			asOf:         "2023-03-01",
+			cadence:      "Monthly",
+			nextExpected: "2023-04-01",
+			priceChanged: true,
+		},
+		{
+			name:         "unstable history",
+			transactions: testCharges("AMAZON", []string{"2023-01-01", "2023-02-01", "2023-03-01", "2023-04-01"}, 20, 75, 20, 20),
+			asOf:         "2023-04-01",
+		},
+		{
+			name:         "skipped month",
+			transactions: testCharges("HULU", []string{"2023-01-15", "2023-02-15", "2023-04-15", "2023-05-15", "2023-06-15"}, 7.99, 7.99, 7.99, 7.99, 7.99),
+			asOf:         "2023-06-20",
+			cadence:      "Monthly",
+			nextExpected: "2023-07-15",
+		},
+		{
+			name:         "end of the month",
+			transactions: testCharges("RENT", []string{"2023-01-31", "2023-02-28", "2023-03-31"}, 1200, 1200, 1200),
+			asOf:         "2023-04-01",
+			cadence:      "Monthly",
+			nextExpected: "2023-04-30",
+		},
+		{
+			name:         "stopped",
+			transactions: testCharges("DISNEY", []string{"2023-01-01", "2023-02-01", "2023-03-01"}, 10.99, 10.99, 10.99),
+			asOf:         "2023-05-01",
+			cadence:      "Monthly",
+			nextExpected: "2023-04-01",
+			stopped:      true,
+		},
+		{
+			name:         "weekly",
+			transactions: testCharges("CLEANER", []string{"2023-03-03", "2023-03-10", "2023-03-17", "2023-03-24"}, 60, 60, 60, 60),
+			asOf:         "2023-03-25",
+			cadence:      "Weekly",
+			nextExpected: "2023-03-31",
+		},
+		{
+			name:         "annual on a leap day",
+			transactions: testCharges("DOMAIN", []string{"2023-02-28", "2024-02-29"}, 15, 15),
+			asOf:         "2024-03-01",
+			cadence:      "Annual",
+			nextExpected: "2025-02-28",
+		},
+		{
+			name:         "too few charges",
+			transactions: testCharges("NEWSPAPER", []string{"2023-01-01", "2023-02-01"}, 5, 5),
+			asOf:         "2023-02-01",
+		},
+		{
+			name:         "irregular",
+			transactions: testCharges("HARDWARE STORE", []string{"2023-01-01", "2023-01-09", "2023-03-20", "2023-06-02"}, 30, 30, 30, 30),
+			asOf:         "2023-06-02",
+		},
+		{
+			name:         "charged twice in a month",
+			transactions: testCharges("PARKING", []string{"2023-01-01", "2023-02-01", "2023-02-03", "2023-03-01"}, 8, 8, 8, 8),
+			asOf:         "2023-03-01",
+		},
+	}
+
+	for _, test := range tests {
+		charges := DetectRecurringCharges(test.transactions, testDate(test.asOf))
+		if test.cadence == "" {
+			if len(charges) != 0 {
+				t.Errorf("%s: detected %+v, want nothing", test.name, charges)
+			}
+			continue
+		}
+		if len(charges) != 1 {
+			t.Errorf("%s: detected %d recurring charges, want 1", test.name, len(charges))
+			continue
+		}
+
+		charge := charges[0]
+		if charge.Cadence.Name != test.cadence {
+			t.Errorf("%s: cadence %s, want %s", test.name, charge.Cadence.Name, test.cadence)
+		}
+		if !charge.NextExpected.Equal(testDate(test.nextExpected)) {
+			t.Errorf("%s: next expected %s, want %s", test.name, charge.NextExpected.Format("2006-01-02"), test.nextExpected)
+		}
+		if charge.PriceChanged != test.priceChanged || charge.Stopped != test.stopped {
+			t.Errorf("%s: price changed %t and stopped %t, want %t and %t", test.name, charge.PriceChanged, charge.Stopped, test.priceChanged, test.stopped)
+		}
+	}
+}
+
+func TestDetectRecurringIncome(t *testing.T) {
+	salary := []Transaction{}
+	for i, date := range []string{"2023-01-25", "2023-02-24", "2023-03-24"} {
+		transaction := testTransaction(fmt.Sprintf("salary-%d", i), date, "ACME PAYROLL", 0, "Checking")
+		transaction.Credit = 3000
+		salary = append(salary, transaction)
+	}
+
+	if charges := DetectRecurringCharges(salary, testDate("2023-03-24")); len(charges) != 0 {
+		t.Errorf("credits were detected as recurring charges: %+v", charges)
+	}
+	income := DetectRecurringIncome(salary, testDate("2023-03-24"))
+	if len(income) != 1 || !income[0].Income || income[0].LastAmount != 3000 {
+		t.Errorf("DetectRecurringIncome returned %+v, want the salary", income)
+	}
+}
+
+func TestCadenceAfter(t *testing.T) {
+	monthly, annual := cadences[1], cadences[2]
+	tests := []struct {
+		cadence Cadence
+		date    string
+		n       int
+		want    string
+	}{
+		{monthly, "2023-03-31", 1, "2023-04-30"},
+		{monthly, "2023-01-31", 1, "2023-02-28"},
+		// Every charge is taken from the original date, so the 31st is not lost after a short month:
+		{monthly, "2023-01-31", 2, "2023-03-31"},
+		{monthly, "2023-12-15", 1, "2024-01-15"},
+		{annual, "2024-02-29", 1, "2025-02-28"},
+		{annual, "2024-02-29", 4, "2028-02-29"},
+	}
+
+	for _, test := range tests {
+		got := test.cadence.after(testDate(test.date), test.n)
+		if !got.Equal(testDate(test.want)) {
+			t.Errorf("%s after(%s, %d) = %s, want %s", test.cadence.Name, test.date, test.n, got.Format("2006-01-02"), test.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Frequency is the size of the periods a BudgetStatement resamples its timeseries into. Every period is identified
+// by the date it starts on.
+type Frequency string
+
+const (
+	FrequencyDay     Frequency = "day"
+	FrequencyWeek    Frequency = "week"
+	FrequencyMonth   Frequency = "month"
+	FrequencyQuarter Frequency = "quarter"
+	FrequencyYear    Frequency = "year"
+)
+
+// Frequencies in the order they are offered on the dashboard:
+var frequencies = []Frequency{FrequencyDay, FrequencyWeek, FrequencyMonth, FrequencyQuarter, FrequencyYear}
+
+// ParseFrequency reads a frequency from a query parameter, an empty value is daily.
+func ParseFrequency(raw string) (Frequency, error) {
+	if raw == "" {
+		return FrequencyDay, nil
+	}
+	for _, frequency := range frequencies {
+		if Frequency(raw) == frequency {
+			return frequency, nil
+		}
+	}
+	return "", fmt.Errorf("unknown frequency %q, expected one of day, week, month, quarter or year", raw)
+}
+
+// PeriodStart returns the first day of the period containing date. Weeks are ISO weeks and start on a Monday.
+func (f Frequency) PeriodStart(date time.Time) time.Time {
+	year, month, day := date.Date()
+
+	switch f {
+	case FrequencyWeek:
+		daysSinceMonday := (int(date.Weekday()) + 6) % 7
+		return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, date.Location())
+	case FrequencyMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, date.Location())
+	case FrequencyQuarter:
+		firstMonthOfQuarter := month - (month-1)%3
+		return time.Date(year, firstMonthOfQuarter, 1, 0, 0, 0, 0, date.Location())
+	case FrequencyYear:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, date.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, date.Location())
+	}
+}
+
+// Label is how the period starting at periodStart is shown on the chart.
+func (f Frequency) Label(periodStart time.Time) string {
+	switch f {
+	case FrequencyWeek:
+		year, week := periodStart.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case FrequencyMonth:
+		return periodStart.Format("2006-01")
+	case FrequencyQuarter:
+		return fmt.Sprintf("%d Q%d", periodStart.Year(), (int(periodStart.Month())-1)/3+1)
+	case FrequencyYear:
+		return periodStart.Format("2006")
+	default:
+		return periodStart.Format("2006-01-02")
+	}
+}
+
+// NextPeriod returns the start of the period following the one starting at periodStart.
+func (f Frequency) NextPeriod(periodStart time.Time) time.Time {
+	switch f {
+	case FrequencyWeek:
+		return periodStart.AddDate(0, 0, 7)
+	case FrequencyMonth:
+		return periodStart.AddDate(0, 1, 0)
+	case FrequencyQuarter:
+		return periodStart.AddDate(0, 3, 0)
+	case FrequencyYear:
+		return periodStart.AddDate(1, 0, 0)
+	default:
+		return periodStart.AddDate(0, 0, 1)
+	}
+}
+
+// SeriesPoint is a single period of a resampled timeseries. Balance is the running total of income less expenses up
+// to the end of the period.
+type SeriesPoint struct {
+	PeriodStart time.Time `json:"period_start"`
+	Label       string    `json:"label"`
+	Income      float64   `json:"income"`
+	Expenses    float64   `json:"expenses"`
+	Net         float64   `json:"net"`
+	Balance     float64   `json:"balance"`
+}
+
+// Series is a resampled timeseries ordered by the start of each period.
+type Series []SeriesPoint
+
+// SeriesSummary holds the statistics of a series that are shown next to the chart.
+type SeriesSummary struct {
+	Periods         int     `json:"periods"`
+	TotalIncome     float64 `json:"total_income"`
+	TotalExpenses   float64 `json:"total_expenses"`
+	NetIncome       float64 `json:"net_income"`
+	AverageIncome   float64 `json:"average_income"`
+	AverageExpenses float64 `json:"average_expenses"`
+	ClosingBalance  float64 `json:"closing_balance"`
+}
+
+func (s Series) Summary() (summary SeriesSummary) {
+	summary.Periods = len(s)
+	for _, point := range s {
+		summary.TotalIncome += point.Income
+		summary.TotalExpenses += point.Expenses
+	}
+	summary.NetIncome = summary.TotalIncome - summary.TotalExpenses
+
+	if len(s) > 0 {
+		summary.AverageIncome = summary.TotalIncome / float64(len(s))
+		summary.AverageExpenses = summary.TotalExpenses / float64(len(s))
+		summary.ClosingBalance = s[len(s)-1].Balance
+	}
+
+	return summary
+}
+
+// roundedToCents rounds every amount in a list, so the float error of the float32 sums is never sent to a client.
+func roundedToCents(amounts []float64) []float64 {
+	if amounts == nil {
+		return nil
+	}
+	rounded := make([]float64, len(amounts))
+	for i, amount := range amounts {
+		rounded[i] = float64(toCents(amount)) / 100
+	}
+	return rounded
+}
+
+func (s Series) roundedToCents() Series {
+	rounded := make(Series, len(s))
+	for i, point := range s {
+		point.Income = float64(toCents(point.Income)) / 100
+		point.Expenses = float64(toCents(point.Expenses)) / 100
+		point.Net = float64(toCents(point.Net)) / 100
+		point.Balance = float64(toCents(point.Balance)) / 100
+		rounded[i] = point
+	}
+	return rounded
+}
+
+func (s SeriesSummary) roundedToCents() SeriesSummary {
+	for _, amount := range []*float64{&s.TotalIncome, &s.TotalExpenses, &s.NetIncome, &s.AverageIncome, &s.AverageExpenses, &s.ClosingBalance} {
+		*amount = float64(toCents(*amount)) / 100
+	}
+	return s
+}
+
+// chartSeries is the shape the dashboard chart plots, with one array per dataset sharing the labels:
+type chartSeries struct {
+	Labels   []string  `json:"labels"`
+	Income   []float64 `json:"income"`
+	Expenses []float64 `json:"expenses"`
+	Balance  []float64 `json:"balance"`
+
+	// Only set when a forecast is drawn, with null for the periods before the forecast starts:
+	Forecast []*float64 `json:"forecast,omitempty"`
+	Lower    []*float64 `json:"lower,omitempty"`
+	Upper    []*float64 `json:"upper,omitempty"`
+
+	// Only set for the trends picked on the dashboard:
+	Rolling             []RollingAverage `json:"rolling,omitempty"`
+	MonthToDate         []float64        `json:"month_to_date,omitempty"`
+	PreviousMonthToDate []float64        `json:"previous_month_to_date,omitempty"`
+	BalanceTrend        []float64        `json:"balance_trend,omitempty"`
+}
+
+// chart rounds the series to cents like the JSON endpoint, so the page source carries the same amounts.
+func (s Series) chart() chartSeries {
+	chart := chartSeries{Labels: []string{}, Income: []float64{}, Expenses: []float64{}, Balance: []float64{}}
+	for _, point := range s.roundedToCents() {
+		chart.Labels = append(chart.Labels, point.Label)
+		chart.Income = append(chart.Income, point.Income)
+		chart.Expenses = append(chart.Expenses, point.Expenses)
+		chart.Balance = append(chart.Balance, point.Balance)
+	}
+	return chart
+}
+
+// seriesHandler returns the same ordered series the dashboard plots as JSON, for the same from, to, frequency and
+// forecast parameters as the dashboard, together with every trend computed from it.
+func (h *storeHandlers) seriesHandler(w http.ResponseWriter, r *http.Request) {
+
+	dateRange, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	frequency, err := ParseFrequency(r.URL.Query().Get("frequency"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	forecastOptions, err := parseForecastOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transactions, err := h.transactions.ReadTransactionsInRange(dateRange)
+	if err != nil {
+		log.Println("Unable to extract the transactions for the series:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	budget, err := h.loadBudget(dateRange, transactions, frequency)
+	if err != nil {
+		log.Println("Unable to resample the transaction timeseries:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	series := budget.Series()
+
+	// The forecast continues from the latest transaction so there is nothing to forecast from a window ending earlier:
+	// Everything is rounded to cents so the response is ready to plot:
+	var forecast *Forecast
+	if forecastOptions.Months > 0 && dateRange.To == "" && len(series) > 0 {
+		projected, err := h.buildForecast(series, frequency, forecastOptions)
+		if err != nil {
+			log.Println("Unable to build the forecast:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		projected = projected.roundedToCents()
+		forecast = &projected
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(struct {
+		Frequency Frequency     `json:"frequency"`
+		From      string        `json:"from,omitempty"`
+		To        string        `json:"to,omitempty"`
+		Points    Series        `json:"points"`
+		Summary   SeriesSummary `json:"summary"`
+		Trends    Trends        `json:"trends"`
+		Forecast  *Forecast     `json:"forecast,omitempty"`
+	}{
+		Frequency: frequency,
+		From:      dateRange.From,
+		To:        dateRange.To,
+		Points:    series.roundedToCents(),
+		Summary:   series.Summary().roundedToCents(),
+		Trends:    budget.Trends().roundedToCents(),
+		Forecast:  forecast,
+	})
+	if err != nil {
+		log.Println("Unable to encode the series:", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testDate parses a YYYY-MM-DD date for the table tests.
+func testDate(raw string) time.Time {
+	parsed, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestFrequencyPeriodStart(t *testing.T) {
+	tests := []struct {
+		frequency Frequency
+		date      string
+		want      string
+		label     string
+	}{
+		{FrequencyDay, "2023-03-15", "2023-03-15", "2023-03-15"},
+		{FrequencyWeek, "2023-03-13", "2023-03-13", "2023-W11"},
+		{FrequencyWeek, "2023-03-19", "2023-03-13", "2023-W11"},
+		// ISO weeks run across the new year, the first days of 2021 belong to week 53 of 2020:
+		{FrequencyWeek, "2021-01-03", "2020-12-28", "2020-W53"},
+		{FrequencyWeek, "2019-12-31", "2019-12-30", "2020-W01"},
+		{FrequencyMonth, "2023-02-28", "2023-02-01", "2023-02"},
+		{FrequencyQuarter, "2023-01-01", "2023-01-01", "2023 Q1"},
+		{FrequencyQuarter, "2023-06-30", "2023-04-01", "2023 Q2"},
+		{FrequencyQuarter, "2023-12-31", "2023-10-01", "2023 Q4"},
+		{FrequencyYear, "2023-07-04", "2023-01-01", "2023"},
+	}
+
+	for _, test := range tests {
+		start := test.frequency.PeriodStart(testDate(test.date))
+		if !start.Equal(testDate(test.want)) {
+			t.Errorf("%s PeriodStart(%s) = %s, want %s", test.frequency, test.date, start.Format("2006-01-02"), test.want)
+		}
+		if label := test.frequency.Label(start); label != test.label {
+			t.Errorf("%s Label(%s) = %q, want %q", test.frequency, test.want, label, test.label)
+		}
+		if next := test.frequency.NextPeriod(start); !test.frequency.PeriodStart(next.AddDate(0, 0, -1)).Equal(start) {
+			t.Errorf("%s NextPeriod(%s) = %s is not the day after the period", test.frequency, test.want, next.Format("2006-01-02"))
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduledTransaction is a transaction that is known to be coming up, e.g. a tax payment or a bonus, entered by hand
+// so the forecast can include it. Scheduled transactions dated on or before the latest imported transaction are
+// assumed to have happened and are no longer forecast.
+type ScheduledTransaction struct {
+	UniqueId    int
+	Date        time.Time
+	Description string
+	Debit       float64
+	Credit      float64
+	Account     string
+}
+
+func describeScheduledTransaction(scheduled ScheduledTransaction) string {
+	return fmt.Sprintf("%s %s debit %.2f credit %.2f account %s", scheduled.Date.Format("2006-01-02"),
+		scheduled.Description, scheduled.Debit, scheduled.Credit, scheduled.Account)
+}
+
+func ReadScheduledTransactions(db *sql.DB) (scheduled []ScheduledTransaction, err error) {
+	rows, err := db.Query("SELECT unique_id, date, description, debit, credit, account FROM scheduled_transactions ORDER BY date, unique_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry ScheduledTransaction
+		var date string
+		err := rows.Scan(&entry.UniqueId, &date, &entry.Description, &entry.Debit, &entry.Credit, &entry.Account)
+		if err != nil {
+			return nil, err
+		}
+		entry.Date, err = time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, err
+		}
+		scheduled = append(scheduled, entry)
+	}
+
+	return scheduled, rows.Err()
+}
+
+func InsertScheduledTransaction(db *sql.DB, scheduled ScheduledTransaction, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("INSERT INTO scheduled_transactions(date, description, debit, credit, account) values(?, ?, ?, ?, ?)",
+		scheduled.Date.Format("2006-01-02"), scheduled.Description, scheduled.Debit, scheduled.Credit, scheduled.Account)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	scheduledId, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityScheduled,
+		EntityId: strconv.FormatInt(scheduledId, 10),
+		Field:    "*",
+		NewValue: describeScheduledTransaction(scheduled),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteScheduledTransaction removes a scheduled transaction, returning sql.ErrNoRows when it does not exist.
+func DeleteScheduledTransaction(db *sql.DB, scheduledId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var scheduled ScheduledTransaction
+	var date string
+	err = tx.QueryRow("SELECT date, description, debit, credit, account FROM scheduled_transactions WHERE unique_id = ?", scheduledId).Scan(
+		&date, &scheduled.Description, &scheduled.Debit, &scheduled.Credit, &scheduled.Account)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	scheduled.Date, _ = time.Parse("2006-01-02", date)
+
+	_, err = tx.Exec("DELETE FROM scheduled_transactions WHERE unique_id = ?", scheduledId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityScheduled,
+		EntityId: strconv.Itoa(scheduledId),
+		Field:    "*",
+		OldValue: describeScheduledTransaction(scheduled),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func parseScheduledTransactionForm(r *http.Request) (scheduled ScheduledTransaction, err error) {
+	scheduled.Date, err = time.Parse("2006-01-02", strings.TrimSpace(r.FormValue("date")))
+	if err != nil {
+		return scheduled, fmt.Errorf("the date must be in the format YYYY-MM-DD")
+	}
+
+	scheduled.Description = strings.TrimSpace(r.FormValue("description"))
+	if scheduled.Description == "" {
+		return scheduled, fmt.Errorf("a scheduled transaction needs a description")
+	}
+
+	debit, err := parseFormAmount(r.FormValue("debit"), "debit")
+	if err != nil {
+		return scheduled, err
+	}
+	credit, err := parseFormAmount(r.FormValue("credit"), "credit")
+	if err != nil {
+		return scheduled, err
+	}
+	if (debit > 0) == (credit > 0) {
+		return scheduled, fmt.Errorf("enter either a debit or a credit amount")
+	}
+	scheduled.Debit, scheduled.Credit = float64(debit), float64(credit)
+
+	scheduled.Account = strings.TrimSpace(r.FormValue("account"))
+	if scheduled.Account == "" {
+		scheduled.Account = defaultAccount
+	}
+
+	return scheduled, nil
+}
+
+type scheduledPageContent struct {
+	Scheduled []ScheduledTransaction
+	Error     string
+}
+
+func (h *storeHandlers) renderScheduled(w http.ResponseWriter, templateName string, content scheduledPageContent) {
+	scheduled, err := h.scheduled.ReadScheduledTransactions()
+	if err != nil {
+		log.Println("Unable to query the scheduled transactions:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content.Scheduled = scheduled
+
+	tmpl, err := template.ParseFiles("../templates/scheduled.html")
+	if err != nil {
+		log.Fatal("Unable to load the scheduled.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, content)
+	if err != nil {
+		log.Println("Unable to render the scheduled template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// scheduledHandler lists, adds and removes the scheduled transactions that are included in the forecast.
+func (h *storeHandlers) scheduledHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.renderScheduled(w, "scheduled.html", scheduledPageContent{})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	content := scheduledPageContent{}
+	switch r.FormValue("action") {
+	case "add":
+		scheduled, err := parseScheduledTransactionForm(r)
+		if err != nil {
+			content.Error = err.Error()
+			break
+		}
+
+		err = h.scheduled.InsertScheduledTransaction(scheduled, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to insert the scheduled transaction:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "delete":
+		scheduledId, err := strconv.Atoi(r.FormValue("scheduled_id"))
+		if err != nil {
+			http.Error(w, "Invalid scheduled_id", http.StatusBadRequest)
+			return
+		}
+
+		err = h.scheduled.DeleteScheduledTransaction(scheduledId, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to delete the scheduled transaction:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	h.renderScheduled(w, "scheduledContent", content)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Maximum number of matches rendered under the search box:
+const searchResultLimit = 100
+
+// searchIndexInsert builds the statement used by the search triggers to (re)index the transactions matching where.
+// Split notes are joined into a single notes column and the payee is indexed by its canonical name.
+func searchIndexInsert(where string) string {
+	return `INSERT INTO transactions_fts(rowid, transaction_id, description, notes, payee)
+		SELECT rowid, unique_id, description,
+			COALESCE((SELECT group_concat(note, ' ') FROM transaction_splits WHERE transaction_splits.transaction_id = transactions.unique_id), ''),
+			COALESCE((SELECT name FROM payees WHERE payees.unique_id = transactions.payee_id), '')
+		FROM transactions WHERE ` + where + `;`
+}
+
+// Triggers keeping transactions_fts in sync with the transactions, their split notes and payee names:
+var searchIndexTriggers = []struct {
+	name, definition string
+}{
+	{"transactions_fts_insert", `AFTER INSERT ON transactions
+	BEGIN
+		` + searchIndexInsert("rowid = NEW.rowid") + `
+	END`},
+	{"transactions_fts_update", `AFTER UPDATE OF description, payee_id ON transactions
+	BEGIN
+		DELETE FROM transactions_fts WHERE rowid = OLD.rowid;
+		` + searchIndexInsert("rowid = NEW.rowid") + `
+	END`},
+	{"transactions_fts_delete", `AFTER DELETE ON transactions
+	BEGIN
+		DELETE FROM transactions_fts WHERE rowid = OLD.rowid;
+	END`},
+	{"transactions_fts_split_insert", `AFTER INSERT ON transaction_splits
+	BEGIN
+		DELETE FROM transactions_fts WHERE transaction_id = NEW.transaction_id;
+		` + searchIndexInsert("unique_id = NEW.transaction_id") + `
+	END`},
+	{"transactions_fts_split_delete", `AFTER DELETE ON transaction_splits
+	BEGIN
+		DELETE FROM transactions_fts WHERE transaction_id = OLD.transaction_id;
+		` + searchIndexInsert("unique_id = OLD.transaction_id") + `
+	END`},
+	{"transactions_fts_payee_rename", `AFTER UPDATE OF name ON payees
+	BEGIN
+		DELETE FROM transactions_fts WHERE rowid IN (SELECT rowid FROM transactions WHERE payee_id = NEW.unique_id);
+		` + searchIndexInsert("payee_id = NEW.unique_id") + `
+	END`},
+}
+
+// ensureSearchIndex sets up the search index, which shares its rowid with the transactions table and is kept in sync
+// by triggers. FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag. Without it the triggers are
+// dropped, as they could not run and would fail every write to the transactions, and search falls back to a LIKE
+// scan. The index is rebuilt from scratch whenever its triggers are missing, so it catches up on anything written
+// while they were dropped.
+func ensureSearchIndex(db *sql.DB) error {
+	if !fts5Compiled(db) {
+		log.Println("SQLite was built without FTS5, transaction search will scan the transactions instead. Build with -tags sqlite_fts5 to index them.")
+		for _, trigger := range searchIndexTriggers {
+			_, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger.name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var numTriggers int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'transactions_fts_%'").Scan(&numTriggers)
+	if err != nil {
+		return err
+	}
+	if numTriggers == len(searchIndexTriggers) {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS transactions_fts USING fts5(
+		transaction_id UNINDEXED,
+		description,
+		notes,
+		payee
+	)`,
+		"DELETE FROM transactions_fts",
+		searchIndexInsert("1"),
+	}
+	for _, trigger := range searchIndexTriggers {
+		statements = append(statements, "CREATE TRIGGER IF NOT EXISTS "+trigger.name+" "+trigger.definition)
+	}
+	for _, statement := range statements {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("creating the search index: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+type SearchFilter struct {
+	Query     string
+	From      string
+	To        string
+	MinAmount string
+	MaxAmount string
+}
+
+// IsEmpty reports whether the filter would match every transaction, in which case no results are shown.
+func (f SearchFilter) IsEmpty() bool {
+	return f.Query == "" && f.From == "" && f.To == "" && f.MinAmount == "" && f.MaxAmount == ""
+}
+
+// ftsMatchExpression turns free text typed into the search box into an FTS5 query. Every word is quoted so
+// punctuation in descriptions such as "SQ *BLUE" cannot be read as query syntax, and is matched as a prefix so
+// results appear while the user is still typing.
+func ftsMatchExpression(query string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// fts5Compiled reports whether the SQLite library was built with FTS5, which go-sqlite3 only does with the
+// sqlite_fts5 build tag.
+func fts5Compiled(db *sql.DB) bool {
+	var compiled bool
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&compiled)
+	return err == nil && compiled
+}
+
+// searchIndexAvailable reports whether the transactions_fts index can be queried. It is missing when the database was
+// built by a binary without FTS5, and cannot be read by one even when it exists.
+func searchIndexAvailable(db *sql.DB) (bool, error) {
+	if !fts5Compiled(db) {
+		return false, nil
+	}
+
+	var numTables int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'transactions_fts'").Scan(&numTables)
+	return numTables > 0, err
+}
+
+// likePattern matches a word anywhere in a column with LIKE, escaping the LIKE wildcards typed into the search box.
+func likePattern(word string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(word)
+	return "%" + escaped + "%"
+}
+
+// SearchTransactions returns the transactions outside of the trash that match every part of the filter. Text matches
+// are ordered by relevance, otherwise the most recent transactions are returned first. Without the FTS5 search index
+// every word is matched with LIKE against the same columns instead, and matches are ordered by date.
+func SearchTransactions(db *sql.DB, filter SearchFilter) (transactions []Transaction, err error) {
+	query := "SELECT " + transactionColumns + " FROM transactions"
+	args := []any{}
+
+	useIndex, err := searchIndexAvailable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	matchExpression := ftsMatchExpression(filter.Query)
+	if !useIndex {
+		matchExpression = ""
+	}
+	if matchExpression != "" {
+		query += ` JOIN (SELECT rowid AS match_rowid, rank FROM transactions_fts WHERE transactions_fts MATCH ?) AS matches
+			ON matches.match_rowid = transactions.rowid`
+		args = append(args, matchExpression)
+	}
+
+	query += " WHERE deleted_at IS NULL"
+
+	if !useIndex {
+		for _, word := range strings.Fields(filter.Query) {
+			args = append(args, likePattern(word))
+			query += strings.ReplaceAll(` AND (description LIKE ?N ESCAPE '\'
+				OR EXISTS (SELECT 1 FROM payees WHERE payees.unique_id = transactions.payee_id AND payees.name LIKE ?N ESCAPE '\')
+				OR EXISTS (SELECT 1 FROM transaction_splits WHERE transaction_splits.transaction_id = transactions.unique_id AND note LIKE ?N ESCAPE '\'))`,
+				"?N", fmt.Sprintf("?%d", len(args)))
+		}
+	}
+
+	for _, bound := range []struct {
+		raw, name, condition string
+	}{
+		{filter.From, "from", "date >= ?"},
+		{filter.To, "to", "date <= ?"},
+	} {
+		if bound.raw == "" {
+			continue
+		}
+		_, err := time.Parse("2006-01-02", bound.raw)
+		if err != nil {
+			return nil, fmt.Errorf("the %s date must be in the format YYYY-MM-DD", bound.name)
+		}
+		query += " AND " + bound.condition
+		args = append(args, bound.raw)
+	}
+
+	// Only one of debit and credit is ever set so their sum is the unsigned amount of the transaction:
+	for _, bound := range []struct {
+		raw, name, condition string
+	}{
+		{filter.MinAmount, "minimum", "COALESCE(NULLIF(debit, ''), 0) + COALESCE(NULLIF(credit, ''), 0) >= ?"},
+		{filter.MaxAmount, "maximum", "COALESCE(NULLIF(debit, ''), 0) + COALESCE(NULLIF(credit, ''), 0) <= ?"},
+	} {
+		if bound.raw == "" {
+			continue
+		}
+		amount, err := parseFormAmount(bound.raw, bound.name)
+		if err != nil {
+			return nil, err
+		}
+		query += " AND " + bound.condition
+		args = append(args, amount)
+	}
+
+	if matchExpression != "" {
+		query += " ORDER BY matches.rank"
+	} else {
+		query += " ORDER BY date DESC"
+	}
+	query += fmt.Sprintf(" LIMIT %d", searchResultLimit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+type searchResultsContent struct {
+	Filter       SearchFilter
+	Transactions []Transaction
+	Error        string
+	Limit        int
+}
+
+func (h *storeHandlers) searchHandler(w http.ResponseWriter, r *http.Request) {
+
+	params := r.URL.Query()
+	filter := SearchFilter{
+		Query:     strings.TrimSpace(params.Get("q")),
+		From:      strings.TrimSpace(params.Get("from")),
+		To:        strings.TrimSpace(params.Get("to")),
+		MinAmount: strings.TrimSpace(params.Get("min_amount")),
+		MaxAmount: strings.TrimSpace(params.Get("max_amount")),
+	}
+
+	var err error
+	content := searchResultsContent{Filter: filter, Limit: searchResultLimit}
+	if !filter.IsEmpty() {
+		content.Transactions, err = h.search.SearchTransactions(filter)
+		if err != nil {
+			// Bad filter values are shown in place of the results rather than failing the live search:
+			content.Error = err.Error()
+		}
+	}
+
+	tmpl, err := template.ParseFiles("../templates/index.html")
+	if err != nil {
+		log.Fatal("Unable to load the index.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "searchResults", content)
+	if err != nil {
+		log.Println("Unable to render the search results: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
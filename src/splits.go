@@ -0,0 +1,476 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultCategory = "Uncategorized"
+
+// TransactionSplit is a single child line of a transaction. Its Amount is always positive and takes the direction
+// (debit or credit) of the parent transaction.
+type TransactionSplit struct {
+	UniqueId      int
+	TransactionId string
+	Category      string
+	Note          string
+	Amount        float64
+}
+
+// CategoryLine is the portion of a transaction that is attributed to a single category.
+type CategoryLine struct {
+	Category string
+	Income   float64
+	Expenses float64
+}
+
+// toCents is used for every amount comparison so float rounding never makes a valid split fail validation.
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// IsDebit reports whether the transaction is an outflow. Split lines inherit this direction.
+func (t Transaction) IsDebit() bool {
+	return t.Debit > 0
+}
+
+// Amount is the unsigned value of the transaction that its split lines must sum to.
+func (t Transaction) Amount() float64 {
+	if t.IsDebit() {
+		return float64(t.Debit)
+	}
+	return float64(t.Credit)
+}
+
+// CategoryLines breaks a transaction down by category, using its split lines when it has any and the parent
+// category otherwise.
+func (t Transaction) CategoryLines() []CategoryLine {
+	if len(t.Splits) == 0 {
+		return []CategoryLine{{
+			Category: t.Category,
+			Income:   float64(t.Credit),
+			Expenses: float64(t.Debit),
+		}}
+	}
+
+	lines := []CategoryLine{}
+	for _, split := range t.Splits {
+		line := CategoryLine{Category: split.Category}
+		if t.IsDebit() {
+			line.Expenses = split.Amount
+		} else {
+			line.Income = split.Amount
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// ValidateSplits checks that every split line has a category and a positive amount, and that the lines sum to the
+// parent transaction amount.
+func ValidateSplits(transaction Transaction, splits []TransactionSplit) error {
+	var totalCents int64
+	for _, split := range splits {
+		if strings.TrimSpace(split.Category) == "" {
+			return fmt.Errorf("every split line needs a category")
+		}
+		if toCents(split.Amount) <= 0 {
+			return fmt.Errorf("split line amounts must be greater than zero")
+		}
+		totalCents += toCents(split.Amount)
+	}
+
+	if totalCents != toCents(transaction.Amount()) {
+		return fmt.Errorf("split lines sum to %.2f but the transaction amount is %.2f", float64(totalCents)/100, transaction.Amount())
+	}
+
+	return nil
+}
+
+func scanSplits(rows *sql.Rows) (splits []TransactionSplit, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var split TransactionSplit
+		var note sql.NullString
+		err := rows.Scan(&split.UniqueId, &split.TransactionId, &split.Category, &note, &split.Amount)
+		if err != nil {
+			return nil, err
+		}
+		split.Note = note.String
+		splits = append(splits, split)
+	}
+
+	return splits, rows.Err()
+}
+
+func ReadTransactionSplits(db *sql.DB, transactionId string) (splits []TransactionSplit, err error) {
+	rows, err := db.Query(`SELECT unique_id, transaction_id, category, note, amount
+		FROM transaction_splits WHERE transaction_id = ? ORDER BY unique_id`, transactionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSplits(rows)
+}
+
+// ReplaceTransactionSplits swaps out all of the split lines of a transaction in a single db transaction and records
+// the old and new lines in the audit log. Passing no splits removes the split and returns the transaction to its
+// parent category.
+func ReplaceTransactionSplits(db *sql.DB, transactionId string, splits []TransactionSplit, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT unique_id, transaction_id, category, note, amount
+		FROM transaction_splits WHERE transaction_id = ? ORDER BY unique_id`, transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	oldSplits, err := scanSplits(rows)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM transaction_splits WHERE transaction_id = ?", transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO transaction_splits(
+		transaction_id,
+		category,
+		note,
+		amount
+		) values(?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, split := range splits {
+		_, err = stmt.Exec(transactionId, split.Category, split.Note, split.Amount)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "splits",
+		OldValue: describeSplits(oldSplits),
+		NewValue: describeSplits(splits),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateTransactionCategory recategorises a transaction, returning sql.ErrNoRows when it does not exist.
+func UpdateTransactionCategory(db *sql.DB, transactionId string, category string, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var oldCategory string
+	err = tx.QueryRow("SELECT category FROM transactions WHERE unique_id = ? AND deleted_at IS NULL", transactionId).Scan(&oldCategory)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET category = ? WHERE unique_id = ?", category, transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "category",
+		OldValue: oldCategory,
+		NewValue: category,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReadCategories lists every category used by a transaction or a split line so the forms can offer them.
+func ReadCategories(db *sql.DB) (categories []string, err error) {
+	rows, err := db.Query(`SELECT category FROM transactions WHERE deleted_at IS NULL
+		UNION SELECT category FROM transaction_splits
+		WHERE transaction_id IN (SELECT unique_id FROM transactions WHERE deleted_at IS NULL)
+		ORDER BY category`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var category string
+		err := rows.Scan(&category)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+type splitEditorContent struct {
+	Transaction Transaction
+	Categories  []string
+	Error       string
+}
+
+func renderSplitEditor(w http.ResponseWriter, content splitEditorContent) {
+	tmpl, err := template.ParseFiles("../templates/snippits/transactionInformationComponents.html")
+	if err != nil {
+		log.Fatal("Error in loading the template snippit: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "splitEditor", content)
+	if err != nil {
+		log.Println("Unable to render the split editor snippit: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Parses the repeated category, note and amount form fields into split lines. Rows left completely blank are skipped
+// so the spare line in the editor never has to be removed before saving.
+func parseSplitForm(r *http.Request) (splits []TransactionSplit, err error) {
+	categories := r.Form["category"]
+	notes := r.Form["note"]
+	amounts := r.Form["amount"]
+
+	if len(categories) != len(amounts) || len(notes) != len(amounts) {
+		return nil, fmt.Errorf("malformed split form")
+	}
+
+	for i := range amounts {
+		category := strings.TrimSpace(categories[i])
+		note := strings.TrimSpace(notes[i])
+		rawAmount := strings.TrimSpace(amounts[i])
+
+		if category == "" && note == "" && rawAmount == "" {
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(rawAmount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid amount", rawAmount)
+		}
+
+		splits = append(splits, TransactionSplit{
+			Category: category,
+			Note:     note,
+			Amount:   amount,
+		})
+	}
+
+	return splits, nil
+}
+
+func (h *storeHandlers) transactionSplitsHandler(w http.ResponseWriter, r *http.Request) {
+
+	r.ParseForm()
+	transactionId := r.FormValue("transaction_id")
+
+	transaction, err := h.transactions.ReadTransaction(transactionId)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("Error in querying a single transaction from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	categories, err := h.splits.ReadCategories()
+	if err != nil {
+		log.Println("Unable to query the list of categories:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		renderSplitEditor(w, splitEditorContent{Transaction: transaction, Categories: categories})
+
+	case http.MethodPost:
+		splits, err := parseSplitForm(r)
+		if err == nil && len(splits) > 0 {
+			err = ValidateSplits(transaction, splits)
+		}
+		if err != nil {
+			// Re-rendering with the submitted lines so nothing the user typed is lost:
+			transaction.Splits = splits
+			renderSplitEditor(w, splitEditorContent{Transaction: transaction, Categories: categories, Error: err.Error()})
+			return
+		}
+
+		err = h.splits.ReplaceTransactionSplits(transactionId, splits, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to save the split lines for a transaction:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		transaction.Splits = splits
+		renderSplitEditor(w, splitEditorContent{Transaction: transaction, Categories: categories})
+
+	case http.MethodDelete:
+		err = h.splits.ReplaceTransactionSplits(transactionId, nil, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to remove the split lines for a transaction:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		transaction.Splits = nil
+		renderSplitEditor(w, splitEditorContent{Transaction: transaction, Categories: categories})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func blankSplitLineHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("../templates/snippits/transactionInformationComponents.html")
+	if err != nil {
+		log.Fatal("Error in loading the template snippit: ", err)
+	}
+
+	// An empty string renders the line with no values filled in:
+	err = tmpl.ExecuteTemplate(w, "splitLine", "")
+	if err != nil {
+		log.Println("Unable to render a blank split line: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *storeHandlers) transactionCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	category := strings.TrimSpace(r.FormValue("category"))
+	if category == "" {
+		category = defaultCategory
+	}
+
+	transaction, err := h.transactions.ReadTransaction(r.FormValue("transaction_id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("Error in querying a single transaction from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.splits.UpdateTransactionCategory(transaction.UniqueId, category, actorFromRequest(r))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("Unable to update the category of a transaction:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte(template.HTMLEscapeString(category)))
+}
+
+type categoryReportRow struct {
+	Category          string
+	Income, Expenses  float64
+	Net               float64
+	ShareOfExpenses   float64
+	NumberOfLineItems int
+}
+
+func (h *storeHandlers) categoryReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	transactions, err := h.transactions.ReadAllTransactions()
+	if err != nil {
+		log.Println("Unable to extract all transactions from the database:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := []categoryReportRow{}
+	if len(transactions) > 0 {
+		budgetStatement, err := LoadBudgetFromCSV(transactions)
+		if err != nil {
+			log.Println("Unable to resample the transaction timeseries:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var totalExpenses float64
+		for _, row := range budgetStatement.categoryTotals {
+			totalExpenses += row.expenses
+		}
+
+		for category, row := range budgetStatement.categoryTotals {
+			reportRow := categoryReportRow{
+				Category:          category,
+				Income:            row.income,
+				Expenses:          row.expenses,
+				Net:               row.income - row.expenses,
+				NumberOfLineItems: budgetStatement.categoryLineCounts[category],
+			}
+			if totalExpenses > 0 {
+				reportRow.ShareOfExpenses = row.expenses / totalExpenses * 100
+			}
+			report = append(report, reportRow)
+		}
+
+		sort.Slice(report, func(i, j int) bool {
+			return report[i].Expenses > report[j].Expenses
+		})
+	}
+
+	tmpl, err := template.ParseFiles("../templates/categories.html")
+	if err != nil {
+		log.Fatal("Unable to load the categories.html template: ", err)
+	}
+
+	err = tmpl.Execute(w, report)
+	if err != nil {
+		log.Println("Unable to render the categories.html template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,868 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// TransactionStore reads the transactions behind the dashboard and the transaction detail view. A transaction that
+// does not exist, or is in the trash, is reported with sql.ErrNoRows by every implementation.
+type TransactionStore interface {
+	ReadAllTransactions() ([]Transaction, error)
+	ReadTransactionsInRange(filter TransactionFilter) ([]Transaction, error)
+	ReadTransactionPage(query TransactionPageQuery) (TransactionPage, error)
+	ReadTransaction(transactionId string) (Transaction, error)
+}
+
+// UploadedFile describes a csv upload as it is recorded in the upload history.
+type UploadedFile struct {
+	FileName string
+	FileSize int64
+	NumRows  int
+	Account  string
+}
+
+// UploadStore records csv uploads and the transactions parsed from them.
+type UploadStore interface {
+	ReadTransactionHistory() ([]TransactionHistory, error)
+
+	// InsertUpload stores every transaction together with the tracking record for the file they came from and
+	// returns the id of the tracking record. Either everything is stored or nothing is.
+	InsertUpload(upload UploadedFile, transactions []Transaction, actor string) (uploadId int64, err error)
+}
+
+// BalanceStore records the opening and statement balances of each account. DeleteAccountBalance reports a balance
+// that does not exist with sql.ErrNoRows.
+type BalanceStore interface {
+	ReadAccountBalances() ([]AccountBalance, error)
+	SaveAccountBalance(balance AccountBalance, actor string) error
+	DeleteAccountBalance(balanceId int, actor string) error
+}
+
+// BudgetStore records the monthly budget of each category. DeleteCategoryBudget reports a budget that does not
+// exist with sql.ErrNoRows.
+type BudgetStore interface {
+	ReadCategoryBudgets() ([]CategoryBudget, error)
+	SaveCategoryBudget(budget CategoryBudget, actor string) error
+	DeleteCategoryBudget(budgetId int, actor string) error
+}
+
+// ScheduleStore records the upcoming transactions included in the forecast. DeleteScheduledTransaction reports a
+// scheduled transaction that does not exist with sql.ErrNoRows.
+type ScheduleStore interface {
+	ReadScheduledTransactions() ([]ScheduledTransaction, error)
+	InsertScheduledTransaction(scheduled ScheduledTransaction, actor string) error
+	DeleteScheduledTransaction(scheduledId int, actor string) error
+}
+
+// AnomalyStore records the anomalies flagged in the transaction history. RecordAnomalies skips anomalies that were
+// recorded before, whatever their status, and returns how many were new. UpdateAnomalyStatus reports an anomaly that
+// does not exist with sql.ErrNoRows.
+type AnomalyStore interface {
+	ReadAnomalies() ([]Anomaly, error)
+	RecordAnomalies(anomalies []Anomaly) (int, error)
+	UpdateAnomalyStatus(anomalyId int, status string, actor string) error
+}
+
+// NetWorthStore records the assets and liabilities valued by hand and their valuations. Deleting an account deletes
+// its valuations. SaveValuation, DeleteNetWorthAccount and DeleteValuation report an account or valuation that does
+// not exist with sql.ErrNoRows.
+type NetWorthStore interface {
+	ReadNetWorthAccounts() ([]NetWorthAccount, error)
+	AddNetWorthAccount(account NetWorthAccount, actor string) error
+	DeleteNetWorthAccount(accountId int, actor string) error
+	SaveValuation(valuation Valuation, actor string) error
+	DeleteValuation(valuationId int, actor string) error
+}
+
+// GoalStore records the savings goals. DeleteSavingsGoal reports a goal that does not exist with sql.ErrNoRows.
+type GoalStore interface {
+	ReadSavingsGoals() ([]SavingsGoal, error)
+	AddSavingsGoal(goal SavingsGoal, actor string) error
+	DeleteSavingsGoal(goalId int, actor string) error
+}
+
+// TransactionEditStore adds, edits and trashes single transactions. UpdateTransaction and SoftDeleteTransaction
+// report a transaction that does not exist, or is already in the trash, with sql.ErrNoRows.
+type TransactionEditStore interface {
+	InsertTransaction(transaction Transaction, actor string) error
+	UpdateTransaction(existingTransaction Transaction, transaction Transaction, actor string) error
+	SoftDeleteTransaction(transaction Transaction, actor string) error
+}
+
+// SplitStore records the category and the split lines of each transaction. Passing no splits to
+// ReplaceTransactionSplits removes the split. UpdateTransactionCategory reports a transaction that does not exist with
+// sql.ErrNoRows.
+type SplitStore interface {
+	ReplaceTransactionSplits(transactionId string, splits []TransactionSplit, actor string) error
+	UpdateTransactionCategory(transactionId string, category string, actor string) error
+	ReadCategories() ([]string, error)
+}
+
+// AttachmentStore records the receipts and documents attached to transactions. Only the records are kept by the
+// store, the files themselves are always written to attachmentDir. ReadAttachment reports an attachment that does
+// not exist with sql.ErrNoRows.
+type AttachmentStore interface {
+	ReadTransactionAttachments(transactionId string) ([]Attachment, error)
+	ReadAttachment(attachmentId int) (Attachment, error)
+	InsertAttachment(attachment Attachment, actor string) (int64, error)
+	DeleteAttachment(attachment Attachment, actor string) error
+}
+
+// AuditStore reads back the audit log that every change made through the other stores is recorded in.
+type AuditStore interface {
+	ReadAuditLog(filter AuditFilter) ([]AuditEntry, error)
+	ReadAuditActors() ([]string, error)
+}
+
+// TrashStore moves uploads and transactions in and out of the trash. Every change reports an upload or transaction
+// that does not exist, or is not in the state the change expects, with sql.ErrNoRows.
+type TrashStore interface {
+	ReadTrashedTransactions() ([]TrashedTransaction, error)
+	ReadTrashedUploads() ([]TrashedUpload, error)
+	SoftDeleteUpload(uploadId int, actor string) error
+	RestoreUpload(uploadId int, actor string) error
+	PurgeUpload(uploadId int, actor string) error
+	RestoreTransaction(transactionId string, actor string) error
+	PurgeTransaction(transactionId string, actor string) error
+}
+
+// TransferStore links the two sides of transfers between accounts. UpdateTransferStatus reports a link that does not
+// exist with sql.ErrNoRows, and refuses with errTransferConflict to confirm a link sharing a transaction with another
+// confirmed transfer.
+type TransferStore interface {
+	ReadTransferLinks() ([]TransferLink, error)
+	DetectTransferCandidates(windowDays int, actor string) (int, error)
+	UpdateTransferStatus(linkId int, status string, actor string) error
+}
+
+// PayeeStore records the payees and the aliases their raw descriptions are matched with. DeletePayeeAlias and
+// DeletePayee report an alias or payee that does not exist with sql.ErrNoRows.
+type PayeeStore interface {
+	ReadPayees() ([]Payee, error)
+	AddPayeeAlias(name string, pattern string, actor string) (int64, error)
+	DeletePayeeAlias(aliasId int, actor string) error
+	DeletePayee(payeeId int, actor string) error
+	ApplyPayeeAliases(onlyUnassigned bool) (int, error)
+	ReapplyPayeeAliases(actor string) (int, error)
+}
+
+// SearchStore finds transactions for the search box. Invalid dates and amounts in the filter are returned as errors
+// that can be shown to the user.
+type SearchStore interface {
+	SearchTransactions(filter SearchFilter) ([]Transaction, error)
+}
+
+type Store interface {
+	TransactionStore
+	UploadStore
+	BalanceStore
+	BudgetStore
+	ScheduleStore
+	AnomalyStore
+	NetWorthStore
+	GoalStore
+	TransactionEditStore
+	SplitStore
+	AttachmentStore
+	AuditStore
+	TrashStore
+	TransferStore
+	PayeeStore
+	SearchStore
+}
+
+// openStore picks the storage backend from the environment. A Postgres DSN in FINANCE_DATABASE_URL selects the
+// Postgres backend, otherwise the SQLite database next to the binary is used unless FINANCE_STORE=memory, which
+// keeps everything in memory for the lifetime of the process.
+func openStore(dbPath string) (Store, error) {
+	if dsn := os.Getenv("FINANCE_DATABASE_URL"); dsn != "" {
+		return NewPostgresStore(dsn)
+	}
+
+	switch backend := os.Getenv("FINANCE_STORE"); backend {
+	case "", "sqlite":
+		return NewSQLiteStore(dbPath)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown FINANCE_STORE %q, expected sqlite or memory", backend)
+	}
+}
+
+// SQLiteStore opens the database file for every call in the same way as the handlers, so the store keeps working
+// after the database is rebuilt from the debug actions.
+type SQLiteStore struct {
+	dbPath string
+}
+
+// NewSQLiteStore brings the database at dbPath up to the latest schema, creating it when it does not exist yet.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	store := &SQLiteStore{dbPath: dbPath}
+
+	db, err := store.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	err = migrateSQLite(db)
+	if err != nil {
+		return nil, fmt.Errorf("migrating the SQLite database: %w", err)
+	}
+
+	return store, nil
+}
+
+func (s *SQLiteStore) open() (*sql.DB, error) {
+	return sql.Open("sqlite3", s.dbPath)
+}
+
+func (s *SQLiteStore) ReadAllTransactions() ([]Transaction, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadAllTransactions(db)
+}
+
+func (s *SQLiteStore) ReadTransactionsInRange(filter TransactionFilter) ([]Transaction, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadTransactionsInRange(db, filter)
+}
+
+func (s *SQLiteStore) ReadTransactionPage(query TransactionPageQuery) (TransactionPage, error) {
+	db, err := s.open()
+	if err != nil {
+		return TransactionPage{}, err
+	}
+	defer db.Close()
+
+	return ReadTransactionPage(db, query)
+}
+
+func (s *SQLiteStore) ReadTransaction(transactionId string) (Transaction, error) {
+	db, err := s.open()
+	if err != nil {
+		return Transaction{}, err
+	}
+	defer db.Close()
+
+	return ReadTransaction(db, transactionId)
+}
+
+func (s *SQLiteStore) ReadTransactionHistory() ([]TransactionHistory, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadTransactionHistory(db)
+}
+
+func (s *SQLiteStore) InsertUpload(upload UploadedFile, transactions []Transaction, actor string) (uploadId int64, err error) {
+	db, err := s.open()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	trackingResult, err := tx.Exec(`INSERT INTO uploaded_files(
+		filename,
+		date_uploaded,
+		num_rows,
+		file_size
+		) values(?, ?, ?, ?)`,
+		upload.FileName,
+		time.Now().Format("2006-01-02 15:04:05"),
+		upload.NumRows,
+		upload.FileSize,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// Linking each transaction back to its upload so trashing an upload can trash its transactions with it:
+	uploadId, err = trackingResult.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO transactions(
+		unique_id,
+		date,
+		description,
+		debit,
+		credit,
+		account,
+		upload_id
+		) values(?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, transaction := range transactions {
+		_, err = stmt.Exec(
+			transaction.UniqueId,
+			transaction.Date.Format("2006-01-02"),
+			transaction.Description,
+			formatStoredAmount(transaction.Debit),
+			formatStoredAmount(transaction.Credit),
+			transaction.Account,
+			uploadId,
+		)
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("inserting transaction %s %s: %w", transaction.Date.Format("2006-01-02"), transaction.Description, err)
+		}
+
+		err = RecordAudit(tx, actor, AuditEntry{
+			Entity:   auditEntityTransaction,
+			EntityId: transaction.UniqueId,
+			Field:    "*",
+			NewValue: describeTransaction(transaction) + " (uploaded from " + upload.FileName + ")",
+		})
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityUpload,
+		EntityId: strconv.FormatInt(uploadId, 10),
+		Field:    "*",
+		NewValue: fmt.Sprintf("%s, %d rows into account %s", upload.FileName, upload.NumRows, upload.Account),
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = ApplyPayeeAliases(db, true)
+	if err != nil {
+		return uploadId, fmt.Errorf("applying the payee aliases: %w", err)
+	}
+
+	_, err = DetectTransferCandidates(db, transferMatchWindowDays, actor)
+	if err != nil {
+		return uploadId, fmt.Errorf("detecting transfer candidates: %w", err)
+	}
+
+	return uploadId, nil
+}
+
+func (s *SQLiteStore) ReadAccountBalances() ([]AccountBalance, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadAccountBalances(db)
+}
+
+func (s *SQLiteStore) SaveAccountBalance(balance AccountBalance, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return SaveAccountBalance(db, balance, actor)
+}
+
+func (s *SQLiteStore) DeleteAccountBalance(balanceId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeleteAccountBalance(db, balanceId, actor)
+}
+
+func (s *SQLiteStore) ReadCategoryBudgets() ([]CategoryBudget, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadCategoryBudgets(db)
+}
+
+func (s *SQLiteStore) SaveCategoryBudget(budget CategoryBudget, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return SaveCategoryBudget(db, budget, actor)
+}
+
+func (s *SQLiteStore) DeleteCategoryBudget(budgetId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeleteCategoryBudget(db, budgetId, actor)
+}
+
+func (s *SQLiteStore) ReadScheduledTransactions() ([]ScheduledTransaction, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadScheduledTransactions(db)
+}
+
+func (s *SQLiteStore) InsertScheduledTransaction(scheduled ScheduledTransaction, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return InsertScheduledTransaction(db, scheduled, actor)
+}
+
+func (s *SQLiteStore) DeleteScheduledTransaction(scheduledId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeleteScheduledTransaction(db, scheduledId, actor)
+}
+
+func (s *SQLiteStore) ReadAnomalies() ([]Anomaly, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadAnomalies(db)
+}
+
+func (s *SQLiteStore) RecordAnomalies(anomalies []Anomaly) (int, error) {
+	db, err := s.open()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return RecordAnomalies(db, anomalies)
+}
+
+func (s *SQLiteStore) UpdateAnomalyStatus(anomalyId int, status string, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return UpdateAnomalyStatus(db, anomalyId, status, actor)
+}
+
+func (s *SQLiteStore) ReadNetWorthAccounts() ([]NetWorthAccount, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadNetWorthAccounts(db)
+}
+
+func (s *SQLiteStore) AddNetWorthAccount(account NetWorthAccount, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return AddNetWorthAccount(db, account, actor)
+}
+
+func (s *SQLiteStore) DeleteNetWorthAccount(accountId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeleteNetWorthAccount(db, accountId, actor)
+}
+
+func (s *SQLiteStore) SaveValuation(valuation Valuation, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return SaveValuation(db, valuation, actor)
+}
+
+func (s *SQLiteStore) DeleteValuation(valuationId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeleteValuation(db, valuationId, actor)
+}
+
+func (s *SQLiteStore) ReadSavingsGoals() ([]SavingsGoal, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadSavingsGoals(db)
+}
+
+func (s *SQLiteStore) AddSavingsGoal(goal SavingsGoal, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return AddSavingsGoal(db, goal, actor)
+}
+
+func (s *SQLiteStore) DeleteSavingsGoal(goalId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeleteSavingsGoal(db, goalId, actor)
+}
+
+func (s *SQLiteStore) InsertTransaction(transaction Transaction, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return InsertTransaction(db, transaction, actor)
+}
+
+func (s *SQLiteStore) UpdateTransaction(existingTransaction Transaction, transaction Transaction, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return UpdateTransaction(db, existingTransaction, transaction, actor)
+}
+
+func (s *SQLiteStore) SoftDeleteTransaction(transaction Transaction, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return SoftDeleteTransaction(db, transaction, actor)
+}
+
+func (s *SQLiteStore) ReplaceTransactionSplits(transactionId string, splits []TransactionSplit, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return ReplaceTransactionSplits(db, transactionId, splits, actor)
+}
+
+func (s *SQLiteStore) UpdateTransactionCategory(transactionId string, category string, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return UpdateTransactionCategory(db, transactionId, category, actor)
+}
+
+func (s *SQLiteStore) ReadCategories() ([]string, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadCategories(db)
+}
+
+func (s *SQLiteStore) ReadTransactionAttachments(transactionId string) ([]Attachment, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadTransactionAttachments(db, transactionId)
+}
+
+func (s *SQLiteStore) ReadAttachment(attachmentId int) (Attachment, error) {
+	db, err := s.open()
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer db.Close()
+
+	return ReadAttachment(db, attachmentId)
+}
+
+func (s *SQLiteStore) InsertAttachment(attachment Attachment, actor string) (int64, error) {
+	db, err := s.open()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return InsertAttachment(db, attachment, actor)
+}
+
+func (s *SQLiteStore) DeleteAttachment(attachment Attachment, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeleteAttachment(db, attachment, actor)
+}
+
+func (s *SQLiteStore) ReadAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadAuditLog(db, filter)
+}
+
+func (s *SQLiteStore) ReadAuditActors() ([]string, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return readAuditActors(db)
+}
+
+func (s *SQLiteStore) ReadTrashedTransactions() ([]TrashedTransaction, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadTrashedTransactions(db)
+}
+
+func (s *SQLiteStore) ReadTrashedUploads() ([]TrashedUpload, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadTrashedUploads(db)
+}
+
+func (s *SQLiteStore) SoftDeleteUpload(uploadId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return SoftDeleteUpload(db, uploadId, actor)
+}
+
+func (s *SQLiteStore) RestoreUpload(uploadId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return RestoreUpload(db, uploadId, actor)
+}
+
+func (s *SQLiteStore) PurgeUpload(uploadId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return PurgeUpload(db, uploadId, actor)
+}
+
+func (s *SQLiteStore) RestoreTransaction(transactionId string, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return RestoreTransaction(db, transactionId, actor)
+}
+
+func (s *SQLiteStore) PurgeTransaction(transactionId string, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return PurgeTransaction(db, transactionId, actor)
+}
+
+func (s *SQLiteStore) ReadTransferLinks() ([]TransferLink, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadTransferLinks(db)
+}
+
+func (s *SQLiteStore) DetectTransferCandidates(windowDays int, actor string) (int, error) {
+	db, err := s.open()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return DetectTransferCandidates(db, windowDays, actor)
+}
+
+func (s *SQLiteStore) UpdateTransferStatus(linkId int, status string, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return UpdateTransferStatus(db, linkId, status, actor)
+}
+
+func (s *SQLiteStore) ReadPayees() ([]Payee, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return ReadPayees(db)
+}
+
+func (s *SQLiteStore) AddPayeeAlias(name string, pattern string, actor string) (int64, error) {
+	db, err := s.open()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return AddPayeeAlias(db, name, pattern, actor)
+}
+
+func (s *SQLiteStore) DeletePayeeAlias(aliasId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeletePayeeAlias(db, aliasId, actor)
+}
+
+func (s *SQLiteStore) DeletePayee(payeeId int, actor string) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return DeletePayee(db, payeeId, actor)
+}
+
+func (s *SQLiteStore) ApplyPayeeAliases(onlyUnassigned bool) (int, error) {
+	db, err := s.open()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return ApplyPayeeAliases(db, onlyUnassigned)
+}
+
+func (s *SQLiteStore) ReapplyPayeeAliases(actor string) (int, error) {
+	db, err := s.open()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return ReapplyPayeeAliases(db, actor)
+}
+
+func (s *SQLiteStore) SearchTransactions(filter SearchFilter) ([]Transaction, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return SearchTransactions(db, filter)
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The contract every Store has to keep, run against each backend so the pages behave the same whichever one is
+// selected with FINANCE_STORE or FINANCE_DATABASE_URL.
+
+func TestMemoryStore(t *testing.T) {
+	runStoreContract(t, func(t *testing.T) Store {
+		return NewMemoryStore()
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreContract(t, func(t *testing.T) Store {
+		store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "finance_database.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+// The Postgres run empties every table it touches, so it only runs against the database named by
+// FINANCE_TEST_DATABASE_URL rather than the one the app uses.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("FINANCE_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("FINANCE_TEST_DATABASE_URL is not set")
+	}
+
+	runStoreContract(t, func(t *testing.T) Store {
+		store, err := NewPostgresStore(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+
+		truncatePostgresTables(t, store.db)
+		return store
+	})
+}
+
+// truncatePostgresTables empties every table the migrations created, read from the schema so a table added by a new
+// migration is emptied too. Only schema_migrations is kept, the migrations have already run.
+func truncatePostgresTables(t *testing.T, db *sql.DB) {
+	t.Helper()
+	rows, err := db.Query(`SELECT quote_ident(tablename) FROM pg_tables
+		WHERE schemaname = 'public' AND tablename != 'schema_migrations' ORDER BY tablename`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		err := rows.Scan(&table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	if rows.Err() != nil {
+		t.Fatal(rows.Err())
+	}
+	if len(tables) == 0 {
+		return
+	}
+
+	_, err = db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testActor = "tester"
+
+func runStoreContract(t *testing.T, newStore func(t *testing.T) Store) {
+	t.Run("InsertUpload", func(t *testing.T) { testInsertUpload(t, newStore(t)) })
+	t.Run("ReadTransactionPage", func(t *testing.T) { testReadTransactionPage(t, newStore(t)) })
+	t.Run("ReadTransactionsInRange", func(t *testing.T) { testReadTransactionsInRange(t, newStore(t)) })
+	t.Run("SoftDeleteTransaction", func(t *testing.T) { testSoftDeleteTransaction(t, newStore(t)) })
+	t.Run("PurgeTransaction", func(t *testing.T) { testPurgeTransaction(t, newStore(t)) })
+	t.Run("SoftDeleteUpload", func(t *testing.T) { testSoftDeleteUpload(t, newStore(t)) })
+	t.Run("ReadAuditLog", func(t *testing.T) { testReadAuditLog(t, newStore(t)) })
+	t.Run("TransferLinks", func(t *testing.T) { testTransferLinks(t, newStore(t)) })
+}
+
+func testTransaction(uniqueId string, date string, description string, debit float32, account string) Transaction {
+	parsedDate, _ := time.Parse("2006-01-02", date)
+	return Transaction{UniqueId: uniqueId, Date: parsedDate, Description: description, Debit: debit, Account: account}
+}
+
+// insertTestUpload stores the transactions as a single upload and returns the id of the upload.
+func insertTestUpload(t *testing.T, store Store, transactions ...Transaction) int {
+	t.Helper()
+	uploadId, err := store.InsertUpload(UploadedFile{FileName: "test.csv", FileSize: 100, NumRows: len(transactions)}, transactions, testActor)
+	if err != nil {
+		t.Fatalf("InsertUpload: %v", err)
+	}
+	return int(uploadId)
+}
+
+func transactionIds(transactions []Transaction) (ids []string) {
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.UniqueId)
+	}
+	return ids
+}
+
+func assertIds(t *testing.T, what string, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got %v, want %v", what, got, want)
+		}
+	}
+}
+
+func testInsertUpload(t *testing.T, store Store) {
+	insertTestUpload(t, store,
+		testTransaction("a", "2023-01-02", "PAYROLL ACME", 0, "Checking"),
+		testTransaction("b", "2023-01-03", "COFFEE", 5.5, "Checking"),
+	)
+
+	transactions, err := store.ReadAllTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("got %d transactions, want 2", len(transactions))
+	}
+
+	transaction, err := store.ReadTransaction("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transaction.Description != "COFFEE" || transaction.Debit != 5.5 || transaction.Account != "Checking" {
+		t.Fatalf("ReadTransaction returned %+v", transaction)
+	}
+
+	_, err = store.ReadTransaction("missing")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ReadTransaction of a missing transaction returned %v, want sql.ErrNoRows", err)
+	}
+
+	history, err := store.ReadTransactionHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].FileName != "test.csv" || history[0].NumRows != 2 {
+		t.Fatalf("ReadTransactionHistory returned %+v", history)
+	}
+}
+
+func testReadTransactionPage(t *testing.T, store Store) {
+	insertTestUpload(t, store,
+		testTransaction("a", "2023-01-01", "ONE", 1, "Checking"),
+		testTransaction("b", "2023-01-02", "TWO", 2, "Checking"),
+		testTransaction("c", "2023-01-03", "THREE", 3, "Checking"),
+		testTransaction("d", "2023-01-04", "FOUR", 4, "Checking"),
+		testTransaction("e", "2023-01-05", "FIVE", 5, "Checking"),
+	)
+
+	var ids []string
+	query := TransactionPageQuery{Sort: "date", Descending: true, PageSize: 2}
+	for pages := 0; ; pages++ {
+		if pages == 5 {
+			t.Fatal("ReadTransactionPage never reported the last page")
+		}
+		page, err := store.ReadTransactionPage(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Transactions) > query.PageSize {
+			t.Fatalf("got %d transactions on a page of %d", len(page.Transactions), query.PageSize)
+		}
+		ids = append(ids, transactionIds(page.Transactions)...)
+		if !page.HasMore {
+			break
+		}
+		query.AfterValue, query.AfterId = page.NextValue, page.NextId
+	}
+	assertIds(t, "paged transactions", ids, "e", "d", "c", "b", "a")
+}
+
+func testReadTransactionsInRange(t *testing.T, store Store) {
+	insertTestUpload(t, store,
+		testTransaction("a", "2023-01-01", "RENT", 1000, "Checking"),
+		testTransaction("b", "2023-02-01", "GROCERIES", 80, "Credit Card"),
+		testTransaction("c", "2023-03-01", "RENT", 1000, "Checking"),
+	)
+	err := store.UpdateTransactionCategory("a", "Housing", testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.ReplaceTransactionSplits("b", []TransactionSplit{
+		{Category: "Food", Amount: 60},
+		{Category: "Housing", Amount: 20},
+	}, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		filter TransactionFilter
+		want   []string
+	}{
+		{TransactionFilter{From: "2023-02-01"}, []string{"b", "c"}},
+		{TransactionFilter{To: "2023-02-01"}, []string{"a", "b"}},
+		{TransactionFilter{From: "2023-01-15", To: "2023-02-15"}, []string{"b"}},
+		{TransactionFilter{Account: "Checking"}, []string{"a", "c"}},
+		{TransactionFilter{Category: "Housing"}, []string{"a", "b"}},
+		{TransactionFilter{Account: "Checking", Category: "Housing"}, []string{"a"}},
+	} {
+		transactions, err := store.ReadTransactionsInRange(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := transactionIds(transactions)
+		sort.Strings(ids)
+		assertIds(t, fmt.Sprintf("transactions matching %+v", test.filter), ids, test.want...)
+	}
+}
+
+func testSoftDeleteTransaction(t *testing.T, store Store) {
+	insertTestUpload(t, store,
+		testTransaction("a", "2023-01-01", "ONE", 1, "Checking"),
+		testTransaction("b", "2023-01-02", "TWO", 2, "Checking"),
+	)
+	transaction, err := store.ReadTransaction("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.SoftDeleteTransaction(transaction, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.ReadTransaction("a")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ReadTransaction of a trashed transaction returned %v, want sql.ErrNoRows", err)
+	}
+	err = store.SoftDeleteTransaction(transaction, testActor)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("trashing a transaction twice returned %v, want sql.ErrNoRows", err)
+	}
+
+	transactions, err := store.ReadAllTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIds(t, "live transactions", transactionIds(transactions), "b")
+
+	page, err := store.ReadTransactionPage(TransactionPageQuery{Sort: "date", PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIds(t, "paged transactions", transactionIds(page.Transactions), "b")
+
+	trashed, err := store.ReadTrashedTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 1 || trashed[0].UniqueId != "a" || trashed[0].DeletedAt == "" {
+		t.Fatalf("ReadTrashedTransactions returned %+v", trashed)
+	}
+
+	err = store.RestoreTransaction("a", testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.ReadTransaction("a")
+	if err != nil {
+		t.Fatalf("ReadTransaction of a restored transaction returned %v", err)
+	}
+	err = store.RestoreTransaction("a", testActor)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("restoring a live transaction returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testPurgeTransaction(t *testing.T, store Store) {
+	insertTestUpload(t, store,
+		testTransaction("a", "2023-01-01", "ONE", 1, "Checking"),
+		testTransaction("b", "2023-01-02", "TWO", 2, "Checking"),
+	)
+
+	err := store.PurgeTransaction("a", testActor)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("purging a live transaction returned %v, want sql.ErrNoRows", err)
+	}
+
+	transaction, err := store.ReadTransaction("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.ReplaceTransactionSplits("a", []TransactionSplit{{Category: "Food", Amount: 1}}, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.InsertAttachment(Attachment{TransactionId: "a", FileName: "receipt.pdf", ContentType: "application/pdf", FilePath: "receipt.pdf", FileSize: 10}, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SoftDeleteTransaction(transaction, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.PurgeTransaction("a", testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := store.ReadTrashedTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 0 {
+		t.Fatalf("ReadTrashedTransactions returned %+v after the purge", trashed)
+	}
+	attachments, err := store.ReadTransactionAttachments("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 0 {
+		t.Fatalf("ReadTransactionAttachments returned %+v after the purge", attachments)
+	}
+	err = store.RestoreTransaction("a", testActor)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("restoring a purged transaction returned %v, want sql.ErrNoRows", err)
+	}
+
+	transactions, err := store.ReadAllTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIds(t, "live transactions", transactionIds(transactions), "b")
+}
+
+func testSoftDeleteUpload(t *testing.T, store Store) {
+	uploadId := insertTestUpload(t, store,
+		testTransaction("a", "2023-01-01", "ONE", 1, "Checking"),
+		testTransaction("b", "2023-01-02", "TWO", 2, "Checking"),
+	)
+	insertTestUpload(t, store, testTransaction("c", "2023-01-03", "THREE", 3, "Checking"))
+
+	err := store.RestoreUpload(uploadId, testActor)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("restoring a live upload returned %v, want sql.ErrNoRows", err)
+	}
+
+	err = store.SoftDeleteUpload(uploadId, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions, err := store.ReadAllTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIds(t, "live transactions", transactionIds(transactions), "c")
+	trashedUploads, err := store.ReadTrashedUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashedUploads) != 1 || trashedUploads[0].NumTransactions != 2 {
+		t.Fatalf("ReadTrashedUploads returned %+v", trashedUploads)
+	}
+
+	err = store.RestoreUpload(uploadId, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions, err = store.ReadAllTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 3 {
+		t.Fatalf("got %d transactions after restoring the upload, want 3", len(transactions))
+	}
+
+	err = store.SoftDeleteUpload(uploadId, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.PurgeUpload(uploadId, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := store.ReadTransactionHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d uploads after the purge, want 1", len(history))
+	}
+	trashed, err := store.ReadTrashedTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 0 {
+		t.Fatalf("ReadTrashedTransactions returned %+v after purging the upload", trashed)
+	}
+	err = store.PurgeUpload(uploadId, testActor)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("purging an upload twice returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testReadAuditLog(t *testing.T, store Store) {
+	insertTestUpload(t, store, testTransaction("a", "2023-01-01", "ONE", 1, "Checking"))
+
+	err := store.UpdateTransactionCategory("a", "Food", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.UpdateTransactionCategory("a", "Groceries", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.ReadAuditLog(AuditFilter{Entity: auditEntityTransaction, EntityId: "a", Field: "category"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2: %+v", len(entries), entries)
+	}
+	if entries[0].Actor != "bob" || entries[0].OldValue != "Food" || entries[0].NewValue != "Groceries" {
+		t.Fatalf("the newest audit entry is %+v", entries[0])
+	}
+
+	entries, err = store.ReadAuditLog(AuditFilter{Actor: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].NewValue != "Food" {
+		t.Fatalf("ReadAuditLog for alice returned %+v", entries)
+	}
+
+	actors, err := store.ReadAuditActors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, actor := range []string{"alice", "bob"} {
+		found := false
+		for _, recorded := range actors {
+			found = found || recorded == actor
+		}
+		if !found {
+			t.Fatalf("ReadAuditActors returned %v without %s", actors, actor)
+		}
+	}
+}
+
+// transferLinkId returns the id of the link between two transactions, failing the test when there is none.
+func transferLinkId(t *testing.T, store Store, debitId string, creditId string) int {
+	t.Helper()
+	links, err := store.ReadTransferLinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range links {
+		if link.DebitTransaction.UniqueId == debitId && link.CreditTransaction.UniqueId == creditId {
+			return link.UniqueId
+		}
+	}
+	t.Fatalf("no transfer link between %s and %s in %+v", debitId, creditId, links)
+	return 0
+}
+
+func testTransferLinks(t *testing.T, store Store) {
+	credit := func(uniqueId string, date string) Transaction {
+		transaction := testTransaction(uniqueId, date, "TRANSFER IN", 0, "Savings")
+		transaction.Credit = 100
+		return transaction
+	}
+	insertTestUpload(t, store, testTransaction("a", "2023-01-01", "TRANSFER OUT", 100, "Checking"), credit("b", "2023-01-03"))
+	abId := transferLinkId(t, store, "a", "b")
+
+	// A closer credit does not pair with a debit that is already suggested:
+	insertTestUpload(t, store, credit("c", "2023-01-01"))
+	links, err := store.ReadTransferLinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 {
+		t.Fatalf("got %d transfer links, want only the suggested pair: %+v", len(links), links)
+	}
+
+	err = store.UpdateTransferStatus(abId, transferStatusRejected, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detected, err := store.DetectTransferCandidates(transferMatchWindowDays, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detected != 1 {
+		t.Fatalf("detected %d candidates after the rejection, want 1", detected)
+	}
+	err = store.UpdateTransferStatus(transferLinkId(t, store, "a", "c"), transferStatusConfirmed, testActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.UpdateTransferStatus(abId, transferStatusConfirmed, testActor)
+	if !errors.Is(err, errTransferConflict) {
+		t.Fatalf("confirming a second transfer for the same debit returned %v, want errTransferConflict", err)
+	}
+
+	err = store.UpdateTransferStatus(999, transferStatusConfirmed, testActor)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("confirming a missing link returned %v, want sql.ErrNoRows", err)
+	}
+}
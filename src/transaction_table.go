@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultTransactionPageSize = 50
+	maxTransactionPageSize     = 200
+)
+
+// Columns the transaction table can be sorted by. Payee sorts by the canonical payee name, falling back to the raw
+// description in the same way the table displays it.
+var transactionSortColumns = map[string]bool{
+	"date":    true,
+	"payee":   true,
+	"account": true,
+	"debit":   true,
+	"credit":  true,
+}
+
+// numericSortColumns are compared as numbers rather than text when paging:
+var numericSortColumns = map[string]bool{"debit": true, "credit": true}
+
+// TransactionPageQuery asks for a single page of the transaction table. Paging is keyset based, the page starts
+// after the row identified by AfterValue (the value of the sort column) and AfterId, so pages stay stable while
+// transactions are added or removed and never need an OFFSET.
+type TransactionPageQuery struct {
+	Filter     TransactionFilter
+	Search     string
+	Sort       string
+	Descending bool
+	AfterValue string
+	AfterId    string
+	PageSize   int
+}
+
+// IsFirstPage reports whether the query starts from the top of the table rather than after a cursor.
+func (q TransactionPageQuery) IsFirstPage() bool {
+	return q.AfterId == ""
+}
+
+type TransactionPage struct {
+	Transactions []Transaction
+	HasMore      bool
+
+	// Cursor for the page following this one, only set when HasMore is:
+	NextValue string
+	NextId    string
+}
+
+// transactionSortValue is the cursor value of a transaction for the given sort column.
+func transactionSortValue(transaction Transaction, sort string) string {
+	switch sort {
+	case "payee":
+		if transaction.Payee != "" {
+			return transaction.Payee
+		}
+		return transaction.Description
+	case "account":
+		return transaction.Account
+	case "debit":
+		return strconv.FormatFloat(float64(transaction.Debit), 'f', 2, 32)
+	case "credit":
+		return strconv.FormatFloat(float64(transaction.Credit), 'f', 2, 32)
+	default:
+		return transaction.Date.Format("2006-01-02")
+	}
+}
+
+// newTransactionPage trims the extra row that every store reads past the page size to find out whether another page
+// follows, and sets the cursor for that page.
+func newTransactionPage(transactions []Transaction, query TransactionPageQuery) TransactionPage {
+	page := TransactionPage{Transactions: transactions}
+	if len(transactions) > query.PageSize {
+		page.Transactions = transactions[:query.PageSize]
+		page.HasMore = true
+
+		last := page.Transactions[len(page.Transactions)-1]
+		page.NextValue = transactionSortValue(last, query.Sort)
+		page.NextId = last.UniqueId
+	}
+	return page
+}
+
+// cursorArg converts the cursor value to the type the sort column is compared as.
+func (q TransactionPageQuery) cursorArg() (any, error) {
+	if !numericSortColumns[q.Sort] {
+		return q.AfterValue, nil
+	}
+	value, err := strconv.ParseFloat(q.AfterValue, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor value %q", q.AfterValue)
+	}
+	return value, nil
+}
+
+// Expressions the SQLite table is ordered by for each sort column:
+var sqliteSortExpressions = map[string]string{
+	"date":    "transactions.date",
+	"payee":   "COALESCE((SELECT name FROM payees WHERE payees.unique_id = transactions.payee_id), transactions.description, '')",
+	"account": "transactions.account",
+	"debit":   "COALESCE(NULLIF(transactions.debit, ''), 0)",
+	"credit":  "COALESCE(NULLIF(transactions.credit, ''), 0)",
+}
+
+// ReadTransactionPage reads a single page of transactions matching the query, ordered by the sort column and then by
+// unique_id so that rows with the same sort value still have a stable position for the cursor.
+func ReadTransactionPage(db *sql.DB, query TransactionPageQuery) (page TransactionPage, err error) {
+	where, args := query.Filter.whereClause()
+
+	if query.Search != "" {
+		where += " AND transactions.description LIKE ?"
+		args = append(args, "%"+query.Search+"%")
+	}
+
+	sortExpression := sqliteSortExpressions[query.Sort]
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if !query.IsFirstPage() {
+		cursor, err := query.cursorArg()
+		if err != nil {
+			return page, err
+		}
+		where += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND transactions.unique_id %[2]s ?))", sortExpression, comparison)
+		args = append(args, cursor, cursor, query.AfterId)
+	}
+
+	// One row past the page size is read to find out whether there is another page:
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM transactions WHERE %s ORDER BY %s %s, transactions.unique_id %s LIMIT %d",
+		transactionColumns, where, sortExpression, direction, direction, query.PageSize+1), args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	transactions := []Transaction{}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return page, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	if rows.Err() != nil {
+		return page, rows.Err()
+	}
+
+	return newTransactionPage(transactions, query), nil
+}
+
+// parseTransactionPageQuery reads the sort, filter and cursor parameters of the /transactions endpoint.
+func parseTransactionPageQuery(r *http.Request) (query TransactionPageQuery, err error) {
+	params := r.URL.Query()
+
+	query.Filter, err = parseDateRange(r)
+	if err != nil {
+		return query, err
+	}
+	query.Filter.Account = strings.TrimSpace(params.Get("account"))
+	query.Filter.Category = strings.TrimSpace(params.Get("category"))
+	query.Search = strings.TrimSpace(params.Get("q"))
+
+	query.Sort = params.Get("sort")
+	if !transactionSortColumns[query.Sort] {
+		query.Sort = "date"
+	}
+	// Newest transactions come first unless another direction is asked for:
+	query.Descending = params.Get("dir") != "asc"
+
+	query.AfterValue = params.Get("after_value")
+	query.AfterId = params.Get("after_id")
+	if !query.IsFirstPage() {
+		_, err = query.cursorArg()
+		if err != nil {
+			return query, err
+		}
+	}
+
+	query.PageSize, err = strconv.Atoi(params.Get("page_size"))
+	if err != nil || query.PageSize < 1 {
+		query.PageSize = defaultTransactionPageSize
+	}
+	if query.PageSize > maxTransactionPageSize {
+		query.PageSize = maxTransactionPageSize
+	}
+
+	return query, nil
+}
+
+// values encodes the query back into url parameters, without the cursor, so the table can be re-requested or
+// re-sorted with the same filters.
+func (q TransactionPageQuery) values() url.Values {
+	params := url.Values{}
+	for key, value := range map[string]string{
+		"from":     q.Filter.From,
+		"to":       q.Filter.To,
+		"account":  q.Filter.Account,
+		"category": q.Filter.Category,
+		"q":        q.Search,
+		"sort":     q.Sort,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+	if q.Descending {
+		params.Set("dir", "desc")
+	} else {
+		params.Set("dir", "asc")
+	}
+	if q.PageSize != defaultTransactionPageSize {
+		params.Set("page_size", strconv.Itoa(q.PageSize))
+	}
+	return params
+}
+
+type transactionTableContent struct {
+	Query TransactionPageQuery
+	Page  TransactionPage
+}
+
+// URL reloads the table from the first page with the current filters and sort.
+func (c transactionTableContent) URL() string {
+	return "/transactions?" + c.Query.values().Encode()
+}
+
+// NextPageURL requests the rows following the current page.
+func (c transactionTableContent) NextPageURL() string {
+	params := c.Query.values()
+	params.Set("after_value", c.Page.NextValue)
+	params.Set("after_id", c.Page.NextId)
+	return "/transactions?" + params.Encode()
+}
+
+// SortURL sorts the table by column, flipping the direction when it is already sorted by that column.
+func (c transactionTableContent) SortURL(column string) string {
+	params := c.Query.values()
+	params.Set("sort", column)
+	if c.Query.Sort == column && c.Query.Descending {
+		params.Set("dir", "asc")
+	} else {
+		params.Set("dir", "desc")
+	}
+	return "/transactions?" + params.Encode()
+}
+
+// SortIndicator marks the column the table is currently sorted by.
+func (c transactionTableContent) SortIndicator(column string) string {
+	if c.Query.Sort != column {
+		return ""
+	}
+	if c.Query.Descending {
+		return "▼"
+	}
+	return "▲"
+}
+
+// transactionTableHandler renders the transaction table a page at a time. The first page is rendered with its
+// sort headers and filters, later pages only render their rows so they can be appended by the infinite scroll.
+func (h *storeHandlers) transactionTableHandler(w http.ResponseWriter, r *http.Request) {
+
+	query, err := parseTransactionPageQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.transactions.ReadTransactionPage(query)
+	if err != nil {
+		log.Println("Unable to query a page of transactions:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("../templates/index.html")
+	if err != nil {
+		log.Fatal("Unable to load the index.html template: ", err)
+	}
+
+	templateName := "transactionTable"
+	if !query.IsFirstPage() {
+		templateName = "transactionRows"
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, transactionTableContent{Query: query, Page: page})
+	if err != nil {
+		log.Println("Unable to render the transaction table: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
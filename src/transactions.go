@@ -0,0 +1,311 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event sent through the HX-Trigger header whenever a transaction is created, edited or deleted so the dashboard can
+// refresh its aggregates:
+const transactionsChangedEvent = "transactionsChanged"
+
+// Manually entered transactions have no csv row to hash, so they get a random id of the same shape as the MD5 hash
+// ids. The id is never recomputed so it stays stable across edits.
+func newManualTransactionId() (string, error) {
+	idBytes := make([]byte, 16)
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(idBytes), nil
+}
+
+// Amounts are stored the same way the csv upload stores them, with a blank string in place of 0.0:
+func formatStoredAmount(amount float32) string {
+	if amount == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(amount), 'f', 2, 32)
+}
+
+func parseFormAmount(rawAmount string, name string) (float32, error) {
+	rawAmount = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rawAmount), "$"))
+	if rawAmount == "" {
+		return 0, nil
+	}
+
+	amount, err := strconv.ParseFloat(rawAmount, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid %s amount", rawAmount, name)
+	}
+	if amount < 0 {
+		return 0, fmt.Errorf("the %s amount cannot be negative", name)
+	}
+
+	return float32(amount), nil
+}
+
+// parseTransactionForm reads the fields shared by the create and edit forms.
+func parseTransactionForm(r *http.Request) (transaction Transaction, err error) {
+	transaction.Date, err = time.Parse("2006-01-02", strings.TrimSpace(r.FormValue("date")))
+	if err != nil {
+		return transaction, fmt.Errorf("the date must be in the format YYYY-MM-DD")
+	}
+
+	transaction.Description = strings.TrimSpace(r.FormValue("description"))
+	if transaction.Description == "" {
+		return transaction, fmt.Errorf("a description is required")
+	}
+
+	transaction.Debit, err = parseFormAmount(r.FormValue("debit"), "debit")
+	if err != nil {
+		return transaction, err
+	}
+	transaction.Credit, err = parseFormAmount(r.FormValue("credit"), "credit")
+	if err != nil {
+		return transaction, err
+	}
+
+	if transaction.Debit == 0 && transaction.Credit == 0 {
+		return transaction, fmt.Errorf("either a debit or a credit amount is required")
+	}
+	if transaction.Debit != 0 && transaction.Credit != 0 {
+		return transaction, fmt.Errorf("a transaction cannot have both a debit and a credit amount")
+	}
+
+	return transaction, nil
+}
+
+// InsertTransaction adds a manually entered transaction and records its creation in the audit log.
+func InsertTransaction(db *sql.DB, transaction Transaction, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO transactions(
+		unique_id,
+		date,
+		description,
+		debit,
+		credit,
+		category,
+		account
+		) values(?, ?, ?, ?, ?, ?, ?)`,
+		transaction.UniqueId,
+		transaction.Date.Format("2006-01-02"),
+		transaction.Description,
+		formatStoredAmount(transaction.Debit),
+		formatStoredAmount(transaction.Credit),
+		transaction.Category,
+		transaction.Account,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transaction.UniqueId,
+		Field:    "*",
+		NewValue: describeTransaction(transaction),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateTransaction overwrites the date, description and amounts of an existing transaction in place and records
+// every field that changed from the existing transaction in the audit log. It returns sql.ErrNoRows when the
+// transaction does not exist or is in the trash.
+func UpdateTransaction(db *sql.DB, existingTransaction Transaction, transaction Transaction, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE transactions SET
+		date = ?,
+		description = ?,
+		debit = ?,
+		credit = ?
+		WHERE unique_id = ? AND deleted_at IS NULL`,
+		transaction.Date.Format("2006-01-02"),
+		transaction.Description,
+		formatStoredAmount(transaction.Debit),
+		formatStoredAmount(transaction.Credit),
+		transaction.UniqueId,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, diffTransactions(existingTransaction, transaction)...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func renderTransactionFormError(w http.ResponseWriter, message string) {
+	tmpl, err := template.ParseFiles("../templates/snippits/uploadedCsvTable.html")
+	if err != nil {
+		log.Fatal("Error in loading the template snippit: ", err)
+	}
+
+	tmpl.ExecuteTemplate(w, "ErrorComponent", ErrorMessage{
+		Error: message,
+	})
+}
+
+func renderTransactionNotice(w http.ResponseWriter, message string) {
+	tmpl, err := template.ParseFiles("../templates/snippits/uploadedCsvTable.html")
+	if err != nil {
+		log.Fatal("Error in loading the template snippit: ", err)
+	}
+
+	tmpl.ExecuteTemplate(w, "SuccessComponent", SuccessMessage{
+		Message: message,
+	})
+}
+
+func (h *storeHandlers) transactionHandler(w http.ResponseWriter, r *http.Request) {
+
+	r.ParseForm()
+	transactionId := r.FormValue("transaction_id")
+
+	switch {
+	// Creating a new manual transaction:
+	case r.Method == http.MethodPost && transactionId == "":
+		transaction, err := parseTransactionForm(r)
+		if err != nil {
+			renderTransactionFormError(w, err.Error())
+			return
+		}
+
+		transaction.Account = strings.TrimSpace(r.FormValue("account"))
+		if transaction.Account == "" {
+			transaction.Account = defaultAccount
+		}
+		transaction.Category = strings.TrimSpace(r.FormValue("category"))
+		if transaction.Category == "" {
+			transaction.Category = defaultCategory
+		}
+
+		transaction.UniqueId, err = newManualTransactionId()
+		if err != nil {
+			log.Println("Unable to generate an id for a manual transaction:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = h.edits.InsertTransaction(transaction, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to insert the manual transaction:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = h.payees.ApplyPayeeAliases(true)
+		if err != nil {
+			log.Println("Unable to apply the payee aliases to the manual transaction:", err)
+		}
+
+		w.Header().Set("HX-Trigger", transactionsChangedEvent)
+		h.renderTransactionContainer(w, transaction.UniqueId, "")
+
+	// Editing an existing transaction inline from the detail snippet:
+	case r.Method == http.MethodPost:
+		existingTransaction, err := h.transactions.ReadTransaction(transactionId)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Error in querying a single transaction from the database:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		transaction, err := parseTransactionForm(r)
+		if err != nil {
+			h.renderTransactionContainer(w, transactionId, err.Error())
+			return
+		}
+		transaction.UniqueId = transactionId
+
+		// Split lines have to keep summing to the parent, with the same sign, so neither the amount nor whether it is a
+		// debit can change underneath them:
+		amountChanged := toCents(transaction.Amount()) != toCents(existingTransaction.Amount()) ||
+			transaction.IsDebit() != existingTransaction.IsDebit()
+		if len(existingTransaction.Splits) > 0 && amountChanged {
+			h.renderTransactionContainer(w, transactionId, "Remove the split before changing the amount or direction of this transaction.")
+			return
+		}
+
+		err = h.edits.UpdateTransaction(existingTransaction, transaction, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to update the transaction:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("HX-Trigger", transactionsChangedEvent)
+		h.renderTransactionContainer(w, transactionId, "")
+
+	case r.Method == http.MethodDelete:
+		existingTransaction, err := h.transactions.ReadTransaction(transactionId)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Error in querying a single transaction from the database:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Deleting only moves the transaction to the trash, it is purged once the retention period runs out:
+		err = h.edits.SoftDeleteTransaction(existingTransaction, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to delete the transaction:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("HX-Trigger", transactionsChangedEvent)
+		renderTransactionNotice(w, "Transaction moved to the trash.")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
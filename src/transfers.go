@@ -0,0 +1,443 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const defaultAccount = "Default"
+
+// Number of days either side of a debit that a matching credit in another account is still considered the same transfer:
+const transferMatchWindowDays = 4
+
+const (
+	transferStatusCandidate = "candidate"
+	transferStatusConfirmed = "confirmed"
+	transferStatusRejected  = "rejected"
+)
+
+// errTransferConflict is returned when confirming a transfer one of whose sides is already part of a confirmed
+// transfer.
+var errTransferConflict = errors.New("one side of this transfer is already part of a confirmed transfer")
+
+// TransferLink pairs the outgoing side of a transfer with the incoming side in a different account.
+type TransferLink struct {
+	UniqueId          int
+	DebitTransaction  Transaction
+	CreditTransaction Transaction
+	Status            string
+	DateDetected      string
+}
+
+// DaysApart is the number of days between the two sides of the transfer as displayed on the transfers page.
+func (l TransferLink) DaysApart() int {
+	return int(math.Abs(l.CreditTransaction.Date.Sub(l.DebitTransaction.Date).Hours() / 24))
+}
+
+// findTransferPairs matches every debit with the closest dated credit of the same amount in a different account.
+// Transactions that are part of a confirmed or suggested transfer are skipped so a transaction can only ever be one
+// side of a single transfer, and a rejected pair is never suggested again while either side is still free to pair with
+// another transaction.
+func findTransferPairs(transactions []Transaction, linkedIds map[string]bool, rejectedPairs map[[2]string]bool, windowDays int) (pairs [][2]Transaction) {
+	var debits, credits []Transaction
+	for _, transaction := range transactions {
+		if linkedIds[transaction.UniqueId] {
+			continue
+		}
+		if transaction.Debit > 0 && transaction.Credit == 0 {
+			debits = append(debits, transaction)
+		} else if transaction.Credit > 0 && transaction.Debit == 0 {
+			credits = append(credits, transaction)
+		}
+	}
+
+	sort.Slice(debits, func(i, j int) bool {
+		return debits[i].Date.Before(debits[j].Date)
+	})
+
+	window := time.Duration(windowDays) * 24 * time.Hour
+	usedCredits := make(map[string]bool)
+
+	for _, debit := range debits {
+		bestIndex := -1
+		var bestDistance time.Duration
+
+		for i, credit := range credits {
+			if usedCredits[credit.UniqueId] || credit.Account == debit.Account {
+				continue
+			}
+			if rejectedPairs[[2]string{debit.UniqueId, credit.UniqueId}] {
+				continue
+			}
+			if toCents(float64(credit.Credit)) != toCents(float64(debit.Debit)) {
+				continue
+			}
+
+			distance := credit.Date.Sub(debit.Date)
+			if distance < 0 {
+				distance = -distance
+			}
+			if distance > window {
+				continue
+			}
+
+			if bestIndex == -1 || distance < bestDistance {
+				bestIndex = i
+				bestDistance = distance
+			}
+		}
+
+		if bestIndex != -1 {
+			usedCredits[credits[bestIndex].UniqueId] = true
+			pairs = append(pairs, [2]Transaction{debit, credits[bestIndex]})
+		}
+	}
+
+	return pairs
+}
+
+// readRejectedTransferPairs returns the debit and credit ids of every transfer suggestion that was rejected.
+func readRejectedTransferPairs(db *sql.DB) (rejectedPairs map[[2]string]bool, err error) {
+	rows, err := db.Query("SELECT debit_transaction_id, credit_transaction_id FROM transfer_links WHERE status = ?", transferStatusRejected)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rejectedPairs = make(map[[2]string]bool)
+	for rows.Next() {
+		var debitId, creditId string
+		err := rows.Scan(&debitId, &creditId)
+		if err != nil {
+			return nil, err
+		}
+		rejectedPairs[[2]string{debitId, creditId}] = true
+	}
+
+	return rejectedPairs, rows.Err()
+}
+
+// readLinkedTransferIds returns the ids of both sides of every confirmed transfer and every open candidate.
+func readLinkedTransferIds(db *sql.DB) (linkedIds map[string]bool, err error) {
+	rows, err := db.Query("SELECT debit_transaction_id, credit_transaction_id FROM transfer_links WHERE status != ?", transferStatusRejected)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	linkedIds = make(map[string]bool)
+	for rows.Next() {
+		var debitId, creditId string
+		err := rows.Scan(&debitId, &creditId)
+		if err != nil {
+			return nil, err
+		}
+		linkedIds[debitId] = true
+		linkedIds[creditId] = true
+	}
+
+	return linkedIds, rows.Err()
+}
+
+// DetectTransferCandidates stores every newly found transfer pair as a candidate link and returns how many were new.
+// Transactions that are already suggested as one side of a transfer are left out until that candidate is rejected.
+func DetectTransferCandidates(db *sql.DB, windowDays int, actor string) (int, error) {
+	transactions, err := ReadAllTransactions(db)
+	if err != nil {
+		return 0, err
+	}
+
+	linkedIds, err := readLinkedTransferIds(db)
+	if err != nil {
+		return 0, err
+	}
+	rejectedPairs, err := readRejectedTransferPairs(db)
+	if err != nil {
+		return 0, err
+	}
+
+	pairs := findTransferPairs(transactions, linkedIds, rejectedPairs, windowDays)
+	if len(pairs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO transfer_links(
+		debit_transaction_id,
+		credit_transaction_id,
+		status,
+		date_detected
+		) values(?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	detected := 0
+	detectedTime := time.Now().Format("2006-01-02 15:04:05")
+	for _, pair := range pairs {
+		result, err := stmt.Exec(pair[0].UniqueId, pair[1].UniqueId, transferStatusCandidate, detectedTime)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		detected += int(inserted)
+	}
+
+	if detected > 0 {
+		err = RecordAudit(tx, actor, AuditEntry{
+			Entity:   auditEntityTransfer,
+			EntityId: "*",
+			Field:    "status",
+			NewValue: fmt.Sprintf("%d new candidates", detected),
+		})
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return detected, tx.Commit()
+}
+
+// ReadConfirmedTransferIds returns the ids of both sides of every confirmed transfer.
+func ReadConfirmedTransferIds(db *sql.DB) (transferIds map[string]bool, err error) {
+	rows, err := db.Query("SELECT debit_transaction_id, credit_transaction_id FROM transfer_links WHERE status = ?", transferStatusConfirmed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transferIds = make(map[string]bool)
+	for rows.Next() {
+		var debitId, creditId string
+		err := rows.Scan(&debitId, &creditId)
+		if err != nil {
+			return nil, err
+		}
+		transferIds[debitId] = true
+		transferIds[creditId] = true
+	}
+
+	return transferIds, rows.Err()
+}
+
+func ReadTransferLinks(db *sql.DB) (links []TransferLink, err error) {
+	rows, err := db.Query(`SELECT unique_id, debit_transaction_id, credit_transaction_id, status, date_detected
+		FROM transfer_links WHERE status != ? ORDER BY unique_id`, transferStatusRejected)
+	if err != nil {
+		return nil, err
+	}
+
+	type rawLink struct {
+		uniqueId                  int
+		debitId, creditId, status string
+		dateDetected              string
+	}
+	rawLinks := []rawLink{}
+	for rows.Next() {
+		var link rawLink
+		err := rows.Scan(&link.uniqueId, &link.debitId, &link.creditId, &link.status, &link.dateDetected)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rawLinks = append(rawLinks, link)
+	}
+	rows.Close()
+
+	transactions, err := ReadAllTransactions(db)
+	if err != nil {
+		return nil, err
+	}
+	transactionsById := make(map[string]Transaction)
+	for _, transaction := range transactions {
+		transactionsById[transaction.UniqueId] = transaction
+	}
+
+	for _, link := range rawLinks {
+		// Links where either side is in the trash are hidden until the transaction is restored:
+		debitTransaction, debitFound := transactionsById[link.debitId]
+		creditTransaction, creditFound := transactionsById[link.creditId]
+		if !debitFound || !creditFound {
+			continue
+		}
+
+		links = append(links, TransferLink{
+			UniqueId:          link.uniqueId,
+			DebitTransaction:  debitTransaction,
+			CreditTransaction: creditTransaction,
+			Status:            link.status,
+			DateDetected:      link.dateDetected,
+		})
+	}
+
+	return links, nil
+}
+
+// UpdateTransferStatus confirms or rejects a transfer link, returning sql.ErrNoRows when it does not exist and
+// errTransferConflict when confirming it would make a transaction one side of two confirmed transfers.
+func UpdateTransferStatus(db *sql.DB, linkId int, status string, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var debitId, creditId, oldStatus string
+	err = tx.QueryRow("SELECT debit_transaction_id, credit_transaction_id, status FROM transfer_links WHERE unique_id = ?",
+		linkId).Scan(&debitId, &creditId, &oldStatus)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if status == transferStatusConfirmed {
+		var conflicts int
+		err = tx.QueryRow(`SELECT COUNT(*) FROM transfer_links WHERE status = ?1 AND unique_id != ?2
+			AND (debit_transaction_id IN (?3, ?4) OR credit_transaction_id IN (?3, ?4))`,
+			transferStatusConfirmed, linkId, debitId, creditId).Scan(&conflicts)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if conflicts > 0 {
+			tx.Rollback()
+			return errTransferConflict
+		}
+	}
+
+	_, err = tx.Exec("UPDATE transfer_links SET status = ? WHERE unique_id = ?", status, linkId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransfer,
+		EntityId: strconv.Itoa(linkId),
+		Field:    "status",
+		OldValue: oldStatus,
+		NewValue: status,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type transfersPageContent struct {
+	Candidates []TransferLink
+	Confirmed  []TransferLink
+	Detected   int
+}
+
+func (h *storeHandlers) renderTransfers(w http.ResponseWriter, templateName string, detected int) {
+	links, err := h.transfers.ReadTransferLinks()
+	if err != nil {
+		log.Println("Unable to query the transfer links:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content := transfersPageContent{Detected: detected}
+	for _, link := range links {
+		if link.Status == transferStatusConfirmed {
+			content.Confirmed = append(content.Confirmed, link)
+		} else {
+			content.Candidates = append(content.Candidates, link)
+		}
+	}
+
+	tmpl, err := template.ParseFiles("../templates/transfers.html")
+	if err != nil {
+		log.Fatal("Unable to load the transfers.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, content)
+	if err != nil {
+		log.Println("Unable to render the transfers template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *storeHandlers) transfersHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.renderTransfers(w, "transfers.html", 0)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	detected := 0
+	switch action := r.FormValue("action"); action {
+	case "detect":
+		windowDays, err := strconv.Atoi(r.FormValue("window_days"))
+		if err != nil || windowDays < 0 {
+			windowDays = transferMatchWindowDays
+		}
+		detected, err = h.transfers.DetectTransferCandidates(windowDays, actorFromRequest(r))
+		if err != nil {
+			log.Println("Unable to detect transfer candidates:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "confirm", "reject", "unlink":
+		linkId, err := strconv.Atoi(r.FormValue("link_id"))
+		if err != nil {
+			http.Error(w, "Invalid link_id", http.StatusBadRequest)
+			return
+		}
+
+		// Unlinking a confirmed transfer rejects it so the pair is not immediately suggested again:
+		status := transferStatusConfirmed
+		if action != "confirm" {
+			status = transferStatusRejected
+		}
+
+		err = h.transfers.UpdateTransferStatus(linkId, status, actorFromRequest(r))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err == errTransferConflict {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Println("Unable to update the status of a transfer link:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "Unknown transfer action", http.StatusBadRequest)
+		return
+	}
+
+	h.renderTransfers(w, "transferLists", detected)
+}
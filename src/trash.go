@@ -0,0 +1,504 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Number of days trashed transactions and uploads are kept before they are purged, overridden by the
+// FINANCE_TRASH_RETENTION_DAYS environment variable:
+const defaultTrashRetentionDays = 30
+
+// Actor recorded in the audit log for everything purged once the retention period runs out:
+const trashRetentionActor = "trash retention"
+
+func trashRetentionDays() int {
+	retentionDays, err := strconv.Atoi(os.Getenv("FINANCE_TRASH_RETENTION_DAYS"))
+	if err != nil || retentionDays < 1 {
+		return defaultTrashRetentionDays
+	}
+	return retentionDays
+}
+
+type TrashedTransaction struct {
+	Transaction
+	DeletedAt string
+}
+
+type TrashedUpload struct {
+	TransactionHistory
+	DeletedAt       string
+	NumTransactions int
+}
+
+// SoftDeleteTransaction moves a transaction to the trash, returning sql.ErrNoRows when it is already there.
+func SoftDeleteTransaction(db *sql.DB, transaction Transaction, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE transactions SET deleted_at = ? WHERE unique_id = ? AND deleted_at IS NULL",
+		time.Now().Format("2006-01-02 15:04:05"), transaction.UniqueId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transaction.UniqueId,
+		Field:    "deleted_at",
+		OldValue: describeTransaction(transaction),
+		NewValue: "trashed",
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RestoreTransaction takes a transaction back out of the trash, returning sql.ErrNoRows when it is not in the trash.
+func RestoreTransaction(db *sql.DB, transactionId string, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE transactions SET deleted_at = NULL WHERE unique_id = ? AND deleted_at IS NOT NULL", transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{
+		Entity:   auditEntityTransaction,
+		EntityId: transactionId,
+		Field:    "deleted_at",
+		OldValue: "trashed",
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SoftDeleteUpload trashes an upload together with every transaction that came from it. They all share the same
+// deleted_at so restoring the upload only brings back the transactions that were trashed along with it. It returns
+// sql.ErrNoRows when the upload does not exist or is already in the trash.
+func SoftDeleteUpload(db *sql.DB, uploadId int, actor string) error {
+	deletedAt := time.Now().Format("2006-01-02 15:04:05")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE uploaded_files SET deleted_at = ? WHERE unique_id = ? AND deleted_at IS NULL", deletedAt, uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET deleted_at = ? WHERE upload_id = ? AND deleted_at IS NULL", deletedAt, uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "deleted_at", NewValue: "trashed"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RestoreUpload takes an upload back out of the trash, returning sql.ErrNoRows when it is not in the trash.
+func RestoreUpload(db *sql.DB, uploadId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE transactions SET deleted_at = NULL
+		WHERE upload_id = ?1 AND deleted_at = (SELECT deleted_at FROM uploaded_files WHERE unique_id = ?1)`, uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE uploaded_files SET deleted_at = NULL WHERE unique_id = ? AND deleted_at IS NOT NULL", uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "deleted_at", OldValue: "trashed"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// purgeTransaction permanently removes a trashed transaction together with its split lines and attachment rows,
+// returning sql.ErrNoRows when the transaction is not in the trash so a live transaction can never be purged. The
+// attachment files are left for removeAttachmentFiles once the db transaction has committed.
+func purgeTransaction(tx *sql.Tx, transactionId string) error {
+	result, err := tx.Exec("DELETE FROM transactions WHERE unique_id = ? AND deleted_at IS NOT NULL", transactionId)
+	if err != nil {
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM attachments WHERE transaction_id = ?",
+		"DELETE FROM transaction_splits WHERE transaction_id = ?",
+		"DELETE FROM transfer_links WHERE debit_transaction_id = ?1 OR credit_transaction_id = ?1",
+	} {
+		_, err = tx.Exec(query, transactionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeAttachmentFiles(transactionIds ...string) {
+	for _, transactionId := range transactionIds {
+		err := os.RemoveAll(filepath.Join(attachmentDir, transactionId))
+		if err != nil {
+			log.Println("Unable to remove the attachment directory for a purged transaction:", err)
+		}
+	}
+}
+
+// PurgeTransaction permanently removes a trashed transaction and the attachment files on disk, returning
+// sql.ErrNoRows when the transaction is not in the trash.
+func PurgeTransaction(db *sql.DB, transactionId string, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = purgeTransaction(tx, transactionId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{Entity: auditEntityTransaction, EntityId: transactionId, Field: "*", OldValue: "purged from trash"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	removeAttachmentFiles(transactionId)
+	return nil
+}
+
+// PurgeUpload permanently removes a trashed upload and the transactions that are still in the trash with it.
+// Transactions from the upload that were restored on their own are kept and unlinked from the upload. It returns
+// sql.ErrNoRows when the upload is not in the trash.
+func PurgeUpload(db *sql.DB, uploadId int, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT unique_id FROM transactions WHERE upload_id = ? AND deleted_at IS NOT NULL", uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	transactionIds := []string{}
+	for rows.Next() {
+		var transactionId string
+		err := rows.Scan(&transactionId)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		transactionIds = append(transactionIds, transactionId)
+	}
+	rows.Close()
+
+	for _, transactionId := range transactionIds {
+		err = purgeTransaction(tx, transactionId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET upload_id = NULL WHERE upload_id = ?", uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM uploaded_files WHERE unique_id = ? AND deleted_at IS NOT NULL", uploadId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = requireAffectedRow(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = RecordAudit(tx, actor, AuditEntry{Entity: auditEntityUpload, EntityId: strconv.Itoa(uploadId), Field: "*", OldValue: "purged from trash"})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	removeAttachmentFiles(transactionIds...)
+	return nil
+}
+
+// PurgeExpiredTrash permanently removes everything that has been in the trash for longer than the retention period
+// and returns the number of transactions and uploads that were purged.
+func PurgeExpiredTrash(store TrashStore, retentionDays int) (purgedTransactions int, purgedUploads int, err error) {
+	cutoff := time.Now().AddDate(0, 0, -retentionDays).Format("2006-01-02 15:04:05")
+
+	uploads, err := store.ReadTrashedUploads()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, upload := range uploads {
+		if upload.DeletedAt >= cutoff {
+			continue
+		}
+		uploadId, err := strconv.Atoi(upload.UniqueId)
+		if err != nil {
+			return purgedTransactions, purgedUploads, err
+		}
+		err = store.PurgeUpload(uploadId, trashRetentionActor)
+		if err != nil {
+			return purgedTransactions, purgedUploads, err
+		}
+		purgedUploads++
+	}
+
+	transactions, err := store.ReadTrashedTransactions()
+	if err != nil {
+		return purgedTransactions, purgedUploads, err
+	}
+	for _, transaction := range transactions {
+		if transaction.DeletedAt >= cutoff {
+			continue
+		}
+		err = store.PurgeTransaction(transaction.UniqueId, trashRetentionActor)
+		if err != nil {
+			return purgedTransactions, purgedUploads, err
+		}
+		purgedTransactions++
+	}
+
+	return purgedTransactions, purgedUploads, nil
+}
+
+// purgeTrashPeriodically runs PurgeExpiredTrash on startup and then once a day for the lifetime of the server.
+func purgeTrashPeriodically(store TrashStore, retentionDays int) {
+	for {
+		purgedTransactions, purgedUploads, err := PurgeExpiredTrash(store, retentionDays)
+		if err != nil {
+			log.Println("Unable to purge the expired trash:", err)
+		} else if purgedTransactions > 0 || purgedUploads > 0 {
+			fmt.Printf("Purged %d transactions and %d uploads from the trash.\n", purgedTransactions, purgedUploads)
+		}
+
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+// trashedRowScanner appends the deleted_at column to the columns read by scanTransaction:
+type trashedRowScanner struct {
+	rows      *sql.Rows
+	deletedAt *string
+}
+
+func (s trashedRowScanner) Scan(dest ...any) error {
+	return s.rows.Scan(append(dest, s.deletedAt)...)
+}
+
+func ReadTrashedTransactions(db *sql.DB) (transactions []TrashedTransaction, err error) {
+	rows, err := db.Query("SELECT " + transactionColumns + ", deleted_at FROM transactions WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var trashed TrashedTransaction
+		trashed.Transaction, err = scanTransaction(trashedRowScanner{rows: rows, deletedAt: &trashed.DeletedAt})
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, trashed)
+	}
+
+	return transactions, rows.Err()
+}
+
+func ReadTrashedUploads(db *sql.DB) (uploads []TrashedUpload, err error) {
+	rows, err := db.Query(`SELECT unique_id, filename, date_uploaded, num_rows, file_size, deleted_at,
+		(SELECT COUNT(*) FROM transactions WHERE transactions.upload_id = uploaded_files.unique_id AND transactions.deleted_at = uploaded_files.deleted_at)
+		FROM uploaded_files WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var upload TrashedUpload
+		err := rows.Scan(&upload.UniqueId, &upload.FileName, &upload.DateUploaded, &upload.NumRows, &upload.FileSize, &upload.DeletedAt, &upload.NumTransactions)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+type trashPageContent struct {
+	Transactions  []TrashedTransaction
+	Uploads       []TrashedUpload
+	RetentionDays int
+}
+
+func (h *storeHandlers) renderTrash(w http.ResponseWriter, templateName string) {
+	transactions, err := h.trash.ReadTrashedTransactions()
+	if err != nil {
+		log.Println("Unable to query the trashed transactions:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	uploads, err := h.trash.ReadTrashedUploads()
+	if err != nil {
+		log.Println("Unable to query the trashed uploads:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("../templates/trash.html")
+	if err != nil {
+		log.Fatal("Unable to load the trash.html template: ", err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, templateName, trashPageContent{
+		Transactions:  transactions,
+		Uploads:       uploads,
+		RetentionDays: trashRetentionDays(),
+	})
+	if err != nil {
+		log.Println("Unable to render the trash template: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *storeHandlers) trashHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodGet {
+		h.renderTrash(w, "trash.html")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	transactionId := r.FormValue("transaction_id")
+	uploadId, _ := strconv.Atoi(r.FormValue("upload_id"))
+
+	var err error
+	actor := actorFromRequest(r)
+	switch action := r.FormValue("action"); action {
+	case "deleteUpload":
+		err = h.trash.SoftDeleteUpload(uploadId, actor)
+	case "restoreUpload":
+		err = h.trash.RestoreUpload(uploadId, actor)
+	case "purgeUpload":
+		err = h.trash.PurgeUpload(uploadId, actor)
+	case "restoreTransaction":
+		err = h.trash.RestoreTransaction(transactionId, actor)
+	case "purgeTransaction":
+		err = h.trash.PurgeTransaction(transactionId, actor)
+	default:
+		http.Error(w, "Unknown trash action", http.StatusBadRequest)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not found in the trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Unable to update the trash:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Trashing an upload happens from the upload history page so it is sent back there:
+	if r.FormValue("action") == "deleteUpload" {
+		http.Redirect(w, r, "/upload_history", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("HX-Trigger", transactionsChangedEvent)
+	h.renderTrash(w, "trashContent")
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rolling averages offered on the dashboard, in days:
+var rollingWindows = []int{7, 30, 90}
+
+// TrendOptions are the computed series drawn over the dashboard chart, selected with repeated trend parameters,
+// e.g. trend=30d&trend=mtd.
+type TrendOptions struct {
+	Rolling     []int
+	MonthToDate bool
+	Slope       bool
+}
+
+// Enabled reports whether a trend option, in its query parameter form, is drawn.
+func (o TrendOptions) Enabled(option string) bool {
+	for _, value := range o.values() {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
+
+func (o TrendOptions) values() (values []string) {
+	for _, days := range o.Rolling {
+		values = append(values, fmt.Sprintf("%dd", days))
+	}
+	if o.MonthToDate {
+		values = append(values, "mtd")
+	}
+	if o.Slope {
+		values = append(values, "slope")
+	}
+	return values
+}
+
+// parseTrendOptions reads the trend query parameters: 7d, 30d and 90d for the rolling averages, mtd for month to
+// date spending against the month before, and slope for the balance trend line.
+func parseTrendOptions(r *http.Request) (options TrendOptions, err error) {
+	for _, value := range r.URL.Query()["trend"] {
+		switch value {
+		case "mtd":
+			options.MonthToDate = true
+		case "slope":
+			options.Slope = true
+		default:
+			days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+			if err != nil || !isRollingWindow(days) {
+				return options, fmt.Errorf("unknown trend %q, expected 7d, 30d, 90d, mtd or slope", value)
+			}
+			options.Rolling = append(options.Rolling, days)
+		}
+	}
+	sort.Ints(options.Rolling)
+
+	return options, nil
+}
+
+func isRollingWindow(days int) bool {
+	for _, window := range rollingWindows {
+		if window == days {
+			return true
+		}
+	}
+	return false
+}
+
+// RollingAverage is the average income and spending over the days before the end of each period of the series,
+// scaled to the length of the period so it can be read against the period's totals. A window that starts before
+// the first transaction is averaged over the days it does cover.
+type RollingAverage struct {
+	Days     int       `json:"days"`
+	Income   []float64 `json:"income"`
+	Expenses []float64 `json:"expenses"`
+}
+
+// MonthToDate compares the spending and income of the month of the latest transaction, up to its day of the month,
+// with the month before up to the same day.
+type MonthToDate struct {
+	AsOf             time.Time `json:"as_of"`
+	Expenses         float64   `json:"expenses"`
+	PreviousExpenses float64   `json:"previous_expenses"`
+	Income           float64   `json:"income"`
+	PreviousIncome   float64   `json:"previous_income"`
+}
+
+// ExpenseChange is the relative change in month to date spending, 0 when the month before had none.
+func (m MonthToDate) ExpenseChange() float64 {
+	if m.PreviousExpenses == 0 {
+		return 0.0
+	}
+	return (m.Expenses - m.PreviousExpenses) / m.PreviousExpenses * 100
+}
+
+// Trends are the statistics computed from a budget statement's daily timeseries. Every series has one value per
+// point of the statement's series.
+type Trends struct {
+	Rolling []RollingAverage `json:"rolling"`
+
+	// Spending since the start of the month at the end of each period, and in the month before up to the same day:
+	MonthToDateExpenses         []float64   `json:"month_to_date_expenses"`
+	PreviousMonthToDateExpenses []float64   `json:"previous_month_to_date_expenses"`
+	MonthToDate                 MonthToDate `json:"month_to_date"`
+
+	// The least squares line through the balance at the end of each period, and its slope in dollars per day:
+	BalanceTrend []float64 `json:"balance_trend"`
+	SlopePerDay  float64   `json:"slope_per_day"`
+}
+
+// SlopePerMonth is the balance trend in dollars per month.
+func (t Trends) SlopePerMonth() float64 {
+	return t.SlopePerDay * daysPerMonth
+}
+
+// dayIndex truncates a transaction date to the day it falls on.
+func dayIndex(date time.Time) time.Time {
+	return FrequencyDay.PeriodStart(date)
+}
+
+// resampleTrends builds the rolling averages, month to date spending and balance trend from the daily income and
+// expenses. It runs after resampleTimeseries, as every series follows the points of the resampled series.
+func (b *BudgetStatement) resampleTrends() {
+	if len(b.series) == 0 {
+		return
+	}
+
+	dailyIncome := make(map[time.Time]float64)
+	dailyExpenses := make(map[time.Time]float64)
+	firstDay, lastDay := dayIndex(b.dateTimeIndex[0]), dayIndex(b.dateTimeIndex[0])
+	for i, date := range b.dateTimeIndex {
+		day := dayIndex(date)
+		dailyIncome[day] += b.incomeTimeseries[i]
+		dailyExpenses[day] += b.expenseTimeseries[i]
+		if day.Before(firstDay) {
+			firstDay = day
+		}
+		if day.After(lastDay) {
+			lastDay = day
+		}
+	}
+
+	// The last day of each period that has happened, so the latest period is not measured past the latest transaction:
+	periodEnds := []time.Time{}
+	for _, point := range b.series {
+		end := b.frequency.NextPeriod(point.PeriodStart).AddDate(0, 0, -1)
+		if end.After(lastDay) {
+			end = lastDay
+		}
+		periodEnds = append(periodEnds, end)
+	}
+
+	sumDays := func(daily map[time.Time]float64, from time.Time, to time.Time) (total float64) {
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			total += daily[day]
+		}
+		return total
+	}
+
+	for _, days := range rollingWindows {
+		rolling := RollingAverage{Days: days}
+		for i, end := range periodEnds {
+			start := end.AddDate(0, 0, 1-days)
+			if start.Before(firstDay) {
+				start = firstDay
+			}
+			covered := end.Sub(start).Hours()/24 + 1
+			periodDays := b.frequency.NextPeriod(b.series[i].PeriodStart).Sub(b.series[i].PeriodStart).Hours() / 24
+
+			rolling.Income = append(rolling.Income, sumDays(dailyIncome, start, end)/covered*periodDays)
+			rolling.Expenses = append(rolling.Expenses, sumDays(dailyExpenses, start, end)/covered*periodDays)
+		}
+		b.trends.Rolling = append(b.trends.Rolling, rolling)
+	}
+
+	for _, end := range periodEnds {
+		b.trends.MonthToDateExpenses = append(b.trends.MonthToDateExpenses, sumDays(dailyExpenses, monthStart(end), end))
+
+		previousStart, previousEnd := sameDayPreviousMonth(end)
+		b.trends.PreviousMonthToDateExpenses = append(b.trends.PreviousMonthToDateExpenses, sumDays(dailyExpenses, previousStart, previousEnd))
+	}
+
+	previousStart, previousEnd := sameDayPreviousMonth(lastDay)
+	b.trends.MonthToDate = MonthToDate{
+		AsOf:             lastDay,
+		Expenses:         sumDays(dailyExpenses, monthStart(lastDay), lastDay),
+		PreviousExpenses: sumDays(dailyExpenses, previousStart, previousEnd),
+		Income:           sumDays(dailyIncome, monthStart(lastDay), lastDay),
+		PreviousIncome:   sumDays(dailyIncome, previousStart, previousEnd),
+	}
+
+	// Least squares fit of the balance against the days since the end of the first period:
+	meanX, meanY := 0.0, 0.0
+	xs := []float64{}
+	for i, end := range periodEnds {
+		x := end.Sub(periodEnds[0]).Hours() / 24
+		xs = append(xs, x)
+		meanX += x
+		meanY += b.series[i].Balance
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(xs))
+
+	covariance, variance := 0.0, 0.0
+	for i, x := range xs {
+		covariance += (x - meanX) * (b.series[i].Balance - meanY)
+		variance += (x - meanX) * (x - meanX)
+	}
+	if variance > 0 {
+		b.trends.SlopePerDay = covariance / variance
+	}
+	for _, x := range xs {
+		b.trends.BalanceTrend = append(b.trends.BalanceTrend, meanY+b.trends.SlopePerDay*(x-meanX))
+	}
+}
+
+// sameDayPreviousMonth returns the start of the month before day and the same day of that month, or its last day
+// when it is shorter.
+func sameDayPreviousMonth(day time.Time) (start time.Time, end time.Time) {
+	start = monthStart(day).AddDate(0, -1, 0)
+	lastDay := monthStart(day).AddDate(0, 0, -1)
+	end = start.AddDate(0, 0, day.Day()-1)
+	if end.After(lastDay) {
+		end = lastDay
+	}
+	return start, end
+}
+
+// Trends returns the rolling averages, month to date spending and balance trend of the statement.
+func (b BudgetStatement) Trends() Trends {
+	return b.trends
+}
+
+func (t Trends) roundedToCents() Trends {
+	rolling := make([]RollingAverage, len(t.Rolling))
+	for i, average := range t.Rolling {
+		average.Income = roundedToCents(average.Income)
+		average.Expenses = roundedToCents(average.Expenses)
+		rolling[i] = average
+	}
+	t.Rolling = rolling
+
+	t.MonthToDateExpenses = roundedToCents(t.MonthToDateExpenses)
+	t.PreviousMonthToDateExpenses = roundedToCents(t.PreviousMonthToDateExpenses)
+	for _, amount := range []*float64{&t.MonthToDate.Expenses, &t.MonthToDate.PreviousExpenses, &t.MonthToDate.Income, &t.MonthToDate.PreviousIncome, &t.SlopePerDay} {
+		*amount = float64(toCents(*amount)) / 100
+	}
+	t.BalanceTrend = roundedToCents(t.BalanceTrend)
+	return t
+}
+
+// withTrends adds the trends picked in the options to the chart.
+func (c chartSeries) withTrends(trends Trends, options TrendOptions) chartSeries {
+	trends = trends.roundedToCents()
+	for _, rolling := range trends.Rolling {
+		for _, days := range options.Rolling {
+			if rolling.Days == days {
+				c.Rolling = append(c.Rolling, rolling)
+			}
+		}
+	}
+	if options.MonthToDate {
+		c.MonthToDate = trends.MonthToDateExpenses
+		c.PreviousMonthToDate = trends.PreviousMonthToDateExpenses
+	}
+	if options.Slope {
+		c.BalanceTrend = trends.BalanceTrend
+	}
+	return c
+}
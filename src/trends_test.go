@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResampleTrends(t *testing.T) {
+	salary := testTransaction("salary", "2023-01-01", "ACME PAYROLL", 0, "Checking")
+	salary.Credit = 3000
+	transfer := testTransaction("transfer", "2023-03-06", "TO SAVINGS", 500, "Checking")
+	transfer.IsTransfer = true
+	transactions := []Transaction{
+		salary,
+		testTransaction("rent", "2023-01-10", "LANDLORD", 100, "Checking"),
+		testTransaction("car", "2023-02-10", "GARAGE", 200, "Checking"),
+		testTransaction("groceries", "2023-03-05", "SUPERMARKET", 50, "Checking"),
+		transfer,
+		testTransaction("fuel", "2023-03-10", "PETROL STATION", 30, "Checking"),
+	}
+
+	statement, err := LoadBudgetAtFrequency(transactions, FrequencyMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trends := statement.Trends().roundedToCents()
+
+	// Each period ends on its last day, or on the latest transaction for March, and every window is scaled to the
+	// length of its period. The 90 day window starts at the first transaction:
+	rolling := []RollingAverage{
+		{Days: 7, Income: []float64{0, 0, 0}, Expenses: []float64{0, 0, 354.29}},
+		{Days: 30, Income: []float64{0, 0, 0}, Expenses: []float64{103.33, 186.67, 289.33}},
+		{Days: 90, Income: []float64{3000, 1423.73, 1347.83}, Expenses: []float64{100, 142.37, 170.72}},
+	}
+	if !reflect.DeepEqual(trends.Rolling, rolling) {
+		t.Errorf("rolling averages %+v, want %+v", trends.Rolling, rolling)
+	}
+
+	tests := []struct {
+		name      string
+		got, want []float64
+	}{
+		{"month to date expenses", trends.MonthToDateExpenses, []float64{100, 200, 80}},
+		{"previous month to date expenses", trends.PreviousMonthToDateExpenses, []float64{0, 100, 200}},
+		// The transfer is not spending but still moves March's balance down to 2120:
+		{"balance trend", trends.BalanceTrend, []float64{2961.17, 2467.56, 2291.27}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s %v, want %v", test.name, test.got, test.want)
+		}
+	}
+
+	monthToDate := MonthToDate{AsOf: testDate("2023-03-10"), Expenses: 80, PreviousExpenses: 200}
+	if trends.MonthToDate != monthToDate || trends.MonthToDate.ExpenseChange() != -60 {
+		t.Errorf("month to date %+v, want %+v", trends.MonthToDate, monthToDate)
+	}
+	if trends.SlopePerDay != -17.63 {
+		t.Errorf("balance trend slope %v a day, want -17.63", trends.SlopePerDay)
+	}
+}
+
+func TestResampleTrendsWithoutTransactions(t *testing.T) {
+	statement, err := LoadBudgetAtFrequency([]Transaction{}, FrequencyMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trends := statement.Trends(); !reflect.DeepEqual(trends, Trends{}) {
+		t.Errorf("trends of an empty statement %+v, want none", trends)
+	}
+}
+
+func TestSameDayPreviousMonth(t *testing.T) {
+	tests := []struct {
+		day        string
+		start, end string
+	}{
+		{"2023-03-10", "2023-02-01", "2023-02-10"},
+		// The previous month is shorter, so it is measured up to its last day:
+		{"2023-03-31", "2023-02-01", "2023-02-28"},
+		{"2024-03-30", "2024-02-01", "2024-02-29"},
+		{"2023-01-15", "2022-12-01", "2022-12-15"},
+	}
+
+	for _, test := range tests {
+		start, end := sameDayPreviousMonth(testDate(test.day))
+		if !start.Equal(testDate(test.start)) || !end.Equal(testDate(test.end)) {
+			t.Errorf("sameDayPreviousMonth(%s) = %s to %s, want %s to %s", test.day, start.Format("2006-01-02"),
+				end.Format("2006-01-02"), test.start, test.end)
+		}
+	}
+}